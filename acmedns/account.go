@@ -0,0 +1,200 @@
+// Package acmedns implements acme-dns compatible HTTP API, /register and /update,
+// backed by Selectel DNS Hosting. ACME clients supporting acme-dns validate domains
+// with CNAME of _acme-challenge to subdomain of account without Selectel credentials.
+package acmedns
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	coreV1 "k8s.io/api/core/v1"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	secretNamePrefix = "acme-dns-"
+	accountLabel     = "acme.selectel.ru/acme-dns-account"
+
+	usernameKey  = "username"
+	passwordKey  = "password"
+	subdomainKey = "subdomain"
+	allowFromKey = "allowfrom"
+)
+
+var (
+	// ErrAccountNotFound is returned by Store when account doesn't exist.
+	ErrAccountNotFound = errors.New("account not found")
+
+	errAccountExists = errors.New("account already exists")
+)
+
+// Account is credentials of subdomain, password is stored as bcrypt hash.
+type Account struct {
+	Username     string   `json:"username"`
+	PasswordHash string   `json:"password"`
+	Subdomain    string   `json:"subdomain"`
+	AllowFrom    []string `json:"allowfrom,omitempty"`
+}
+
+// Store keeps accounts.
+type Store interface {
+	Add(ctx context.Context, account Account) error
+	Get(ctx context.Context, username string) (*Account, error)
+}
+
+// FileStore keeps accounts in json file, the file is rewritten atomically on add.
+type FileStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewFileStore returns store of accounts in file, it is created on the first add.
+func NewFileStore(path string) *FileStore {
+	return &FileStore{path: path}
+}
+
+// Add saves new account.
+func (s *FileStore) Add(_ context.Context, account Account) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	accounts, err := s.read()
+	if err != nil {
+		return err
+	}
+	for _, existing := range accounts {
+		if existing.Username == account.Username {
+			return fmt.Errorf("%w: %s", errAccountExists, account.Username)
+		}
+	}
+	accounts = append(accounts, account)
+
+	return s.write(accounts)
+}
+
+// Get returns account by username.
+func (s *FileStore) Get(_ context.Context, username string) (*Account, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	accounts, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	for _, account := range accounts {
+		if account.Username == username {
+			return &account, nil
+		}
+	}
+
+	return nil, ErrAccountNotFound
+}
+
+func (s *FileStore) read() ([]Account, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read accounts: %w", err)
+	}
+	accounts := []Account{}
+	if err = json.Unmarshal(data, &accounts); err != nil {
+		return nil, fmt.Errorf("unmarshal accounts: %w", err)
+	}
+
+	return accounts, nil
+}
+
+func (s *FileStore) write(accounts []Account) error {
+	data, err := json.MarshalIndent(accounts, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal accounts: %w", err)
+	}
+	file, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return fmt.Errorf("create accounts: %w", err)
+	}
+	defer os.Remove(file.Name())
+	if _, err = file.Write(data); err != nil {
+		file.Close()
+
+		return fmt.Errorf("write accounts: %w", err)
+	}
+	if err = file.Close(); err != nil {
+		return fmt.Errorf("write accounts: %w", err)
+	}
+	if err = os.Rename(file.Name(), s.path); err != nil {
+		return fmt.Errorf("replace accounts: %w", err)
+	}
+
+	return nil
+}
+
+// SecretStore keeps every account in its Secret in namespace.
+type SecretStore struct {
+	client    kubernetes.Interface
+	namespace string
+}
+
+// NewSecretStore returns store of accounts in Secrets of namespace.
+func NewSecretStore(client kubernetes.Interface, namespace string) *SecretStore {
+	return &SecretStore{client: client, namespace: namespace}
+}
+
+// Add creates Secret of account.
+func (s *SecretStore) Add(ctx context.Context, account Account) error {
+	secret := &coreV1.Secret{
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:      secretNamePrefix + account.Username,
+			Namespace: s.namespace,
+			Labels:    map[string]string{accountLabel: "true"},
+		},
+		Data: map[string][]byte{
+			usernameKey:  []byte(account.Username),
+			passwordKey:  []byte(account.PasswordHash),
+			subdomainKey: []byte(account.Subdomain),
+			allowFromKey: []byte(strings.Join(account.AllowFrom, ",")),
+		},
+	}
+	_, err := s.client.CoreV1().Secrets(s.namespace).Create(ctx, secret, metaV1.CreateOptions{})
+	if apiErrors.IsAlreadyExists(err) {
+		return fmt.Errorf("%w: %s", errAccountExists, account.Username)
+	}
+	if err != nil {
+		return fmt.Errorf("create secret of account: %w", err)
+	}
+
+	return nil
+}
+
+// Get reads Secret of account.
+func (s *SecretStore) Get(ctx context.Context, username string) (*Account, error) {
+	secret, err := s.client.CoreV1().Secrets(s.namespace).Get(ctx, secretNamePrefix+username, metaV1.GetOptions{})
+	if apiErrors.IsNotFound(err) {
+		return nil, ErrAccountNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get secret of account: %w", err)
+	}
+	account := &Account{
+		Username:     string(secret.Data[usernameKey]),
+		PasswordHash: string(secret.Data[passwordKey]),
+		Subdomain:    string(secret.Data[subdomainKey]),
+	}
+	if allowFrom := string(secret.Data[allowFromKey]); allowFrom != "" {
+		account.AllowFrom = strings.Split(allowFrom, ",")
+	}
+	// secret of another account or edited by hand doesn't authorize anything
+	if account.Username != username {
+		return nil, ErrAccountNotFound
+	}
+
+	return account, nil
+}
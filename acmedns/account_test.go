@@ -0,0 +1,65 @@
+package acmedns
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	coreV1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestStores(t *testing.T) {
+	t.Parallel()
+	stores := map[string]func(t *testing.T) Store{
+		"file": func(t *testing.T) Store {
+			t.Helper()
+
+			return NewFileStore(filepath.Join(t.TempDir(), "accounts.json"))
+		},
+		"secret": func(t *testing.T) Store {
+			t.Helper()
+
+			return NewSecretStore(fake.NewSimpleClientset(), "acme-dns")
+		},
+	}
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			store := newStore(t)
+			account := Account{
+				Username:     "8e5700ea-a4bf-41c7-8a77-e990661dcc6a",
+				PasswordHash: "hash",
+				Subdomain:    "145ba68e-3f2c-4a4c-9c4e-1e4d5a3b2c1d",
+				AllowFrom:    []string{"10.0.0.0/8", "192.168.1.1/32"},
+			}
+
+			_, err := store.Get(t.Context(), account.Username)
+			require.ErrorIs(t, err, ErrAccountNotFound)
+			require.NoError(t, store.Add(t.Context(), account))
+			require.ErrorIs(t, store.Add(t.Context(), account), errAccountExists)
+			other := Account{Username: "other", PasswordHash: "other-hash", Subdomain: "other"}
+			require.NoError(t, store.Add(t.Context(), other))
+
+			actual, err := store.Get(t.Context(), account.Username)
+			require.NoError(t, err)
+			assert.Equal(t, account, *actual)
+			actual, err = store.Get(t.Context(), other.Username)
+			require.NoError(t, err)
+			assert.Equal(t, other, *actual)
+		})
+	}
+}
+
+func TestSecretStore_OtherSecret(t *testing.T) {
+	t.Parallel()
+	client := fake.NewSimpleClientset(&coreV1.Secret{
+		ObjectMeta: metaV1.ObjectMeta{Name: secretNamePrefix + "user", Namespace: "acme-dns"},
+		Data:       map[string][]byte{usernameKey: []byte("another"), passwordKey: []byte("hash")},
+	})
+
+	_, err := NewSecretStore(client, "acme-dns").Get(t.Context(), "user")
+	assert.ErrorIs(t, err, ErrAccountNotFound)
+}
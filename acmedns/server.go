@@ -0,0 +1,367 @@
+package acmedns
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/selectel/cert-manager-webhook-selectel/selectel"
+	domainsV2 "github.com/selectel/domains-go/pkg/v2"
+	"golang.org/x/crypto/bcrypt"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	headerAPIUser = "X-Api-User"
+	headerAPIKey  = "X-Api-Key"
+
+	passwordLength  = 40
+	passwordLetters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_"
+	// keptValues is number of the latest values of subdomain kept in TXT RRSet,
+	// certificate with domain and its wildcard has two challenges.
+	keptValues = 2
+	// maxBodySize limits body of requests.
+	maxBodySize = 1 << 12
+)
+
+// Errors of acme-dns API.
+const (
+	errorForbidden       = "forbidden"
+	errorBadTXT          = "bad_txt"
+	errorBadSubdomain    = "bad_subdomain"
+	errorMalformedJSON   = "malformed_json_payload"
+	errorBadAllowFrom    = "invalid_allowfrom_cidr"
+	errorInternal        = "internal_error"
+	errorRegistrationOff = "registration_disabled"
+)
+
+var (
+	errForbidden = errors.New("forbidden")
+
+	// value of dns-01 challenge is base64url of sha256.
+	txtRegexp       = regexp.MustCompile(`^[A-Za-z0-9_-]{43}$`)
+	subdomainRegexp = regexp.MustCompile(`^[a-z0-9-]{1,63}$`)
+)
+
+// Provider changes TXT RRSets of Selectel zones, it is implemented by selectel.DNSProvider.
+type Provider interface {
+	Present(zoneName, fqdn, value string) error
+	CleanUp(zoneName, fqdn, value string) error
+	GetRRSet(ctx context.Context, zoneName, fqdn string) (*domainsV2.Zone, *domainsV2.RRSet, error)
+}
+
+// Server is acme-dns API of subdomains of domain in Selectel zone.
+type Server struct {
+	provider Provider
+	store    Store
+	zone     string
+	domain   string
+
+	// Registration allows to register accounts with /register, it is disabled by default.
+	Registration bool
+	// HeaderName is header with client address set by trusted proxy, e.g. X-Forwarded-For,
+	// its last address is checked by allowfrom. Remote address is checked if empty.
+	HeaderName string
+
+	// updates of the same RRSet are serialized to keep the latest values
+	mu sync.Mutex
+}
+
+// NewServer returns server of subdomains of domain, e.g. acme.example.com,
+// in zone of Selectel, e.g. example.com. Registration is disabled.
+func NewServer(provider Provider, store Store, zone, domain string) *Server {
+	return &Server{
+		provider: provider,
+		store:    store,
+		zone:     fqdnOf(zone),
+		domain:   strings.TrimSuffix(domain, "."),
+	}
+}
+
+// Handler returns handler of acme-dns API.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /register", s.register)
+	mux.HandleFunc("POST /update", s.update)
+	mux.HandleFunc("GET /health", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	return mux
+}
+
+type registerRequest struct {
+	AllowFrom []string `json:"allowfrom"`
+}
+
+type registerResponse struct {
+	Username   string   `json:"username"`
+	Password   string   `json:"password"`
+	FullDomain string   `json:"fulldomain"`
+	Subdomain  string   `json:"subdomain"`
+	AllowFrom  []string `json:"allowfrom"`
+}
+
+type updateRequest struct {
+	Subdomain string `json:"subdomain"`
+	TXT       string `json:"txt"`
+}
+
+type updateResponse struct {
+	TXT string `json:"txt"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func (s *Server) register(w http.ResponseWriter, r *http.Request) {
+	if !s.Registration {
+		writeJSON(w, http.StatusForbidden, errorResponse{Error: errorRegistrationOff})
+
+		return
+	}
+	request := registerRequest{}
+	// body is optional, empty one may come chunked without content length
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize)).Decode(&request)
+	if err != nil && !errors.Is(err, io.EOF) {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: errorMalformedJSON})
+
+		return
+	}
+	for _, cidr := range request.AllowFrom {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: errorBadAllowFrom})
+
+			return
+		}
+	}
+	password, err := newPassword()
+	if err != nil {
+		s.internalError(w, err)
+
+		return
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		s.internalError(w, fmt.Errorf("hash password: %w", err))
+
+		return
+	}
+	account := Account{
+		Username:     uuid.NewString(),
+		PasswordHash: string(hash),
+		Subdomain:    uuid.NewString(),
+		AllowFrom:    request.AllowFrom,
+	}
+	if err = s.store.Add(r.Context(), account); err != nil {
+		s.internalError(w, err)
+
+		return
+	}
+	logf.Log.WithName("acme-dns").Info("registered account", "username", account.Username, "subdomain", account.Subdomain)
+	allowFrom := account.AllowFrom
+	if allowFrom == nil {
+		allowFrom = []string{}
+	}
+	writeJSON(w, http.StatusCreated, registerResponse{
+		Username:   account.Username,
+		Password:   password,
+		FullDomain: account.Subdomain + "." + s.domain,
+		Subdomain:  account.Subdomain,
+		AllowFrom:  allowFrom,
+	})
+}
+
+func (s *Server) update(w http.ResponseWriter, r *http.Request) {
+	account, err := s.authenticate(r)
+	if err != nil {
+		if !errors.Is(err, errForbidden) {
+			s.internalError(w, err)
+
+			return
+		}
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: errorForbidden})
+
+		return
+	}
+	request := updateRequest{}
+	if err = json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize)).Decode(&request); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: errorMalformedJSON})
+
+		return
+	}
+	switch {
+	case !subdomainRegexp.MatchString(request.Subdomain):
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: errorBadSubdomain})
+
+		return
+	case !txtRegexp.MatchString(request.TXT):
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: errorBadTXT})
+
+		return
+	case request.Subdomain != account.Subdomain:
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: errorForbidden})
+
+		return
+	}
+	if err = s.setTXT(r.Context(), account.Subdomain+"."+s.domain+".", request.TXT); err != nil {
+		s.internalError(w, err)
+
+		return
+	}
+	writeJSON(w, http.StatusOK, updateResponse{TXT: request.TXT})
+}
+
+// authenticate returns account of credentials in headers allowed from remote address.
+func (s *Server) authenticate(r *http.Request) (*Account, error) {
+	username, password := r.Header.Get(headerAPIUser), r.Header.Get(headerAPIKey)
+	if username == "" || password == "" {
+		return nil, errForbidden
+	}
+	account, err := s.store.Get(r.Context(), username)
+	if errors.Is(err, ErrAccountNotFound) {
+		return nil, errForbidden
+	}
+	if err != nil {
+		return nil, err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(account.PasswordHash), []byte(password)) != nil {
+		return nil, errForbidden
+	}
+	if !allowedFrom(account.AllowFrom, s.clientAddr(r)) {
+		return nil, errForbidden
+	}
+
+	return account, nil
+}
+
+// clientAddr returns address of client. Proxy appends address of its client
+// to the header, so the last one is taken, the previous ones may be forged.
+func (s *Server) clientAddr(r *http.Request) string {
+	if s.HeaderName == "" {
+		return r.RemoteAddr
+	}
+	addrs := strings.Split(r.Header.Get(s.HeaderName), ",")
+
+	return strings.TrimSpace(addrs[len(addrs)-1])
+}
+
+func allowedFrom(cidrs []string, remoteAddr string) bool {
+	if len(cidrs) == 0 {
+		return true
+	}
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err == nil && network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// setTXT adds value to TXT RRSet of subdomain and removes values
+// except the latest ones like acme-dns does.
+func (s *Server) setTXT(ctx context.Context, fqdn, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	values, err := s.values(ctx, fqdn)
+	if err != nil {
+		return err
+	}
+	if !contains(values, value) {
+		if err = s.provider.Present(s.zone, fqdn, value); err != nil {
+			return fmt.Errorf("present: %w", err)
+		}
+		values = append(values, value)
+	}
+	for _, old := range values[:max(0, len(values)-keptValues)] {
+		if old == value {
+			continue
+		}
+		if err = s.provider.CleanUp(s.zone, fqdn, old); err != nil {
+			return fmt.Errorf("cleanup: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// values returns values of TXT RRSet in order of addition.
+func (s *Server) values(ctx context.Context, fqdn string) ([]string, error) {
+	_, rrset, err := s.provider.GetRRSet(ctx, s.zone, fqdn)
+	if errors.Is(err, selectel.ErrRRSetNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get rrset: %w", err)
+	}
+	values := make([]string, 0, len(rrset.Records))
+	for _, record := range rrset.Records {
+		values = append(values, strings.Trim(record.Content, `"`))
+	}
+
+	return values, nil
+}
+
+func (s *Server) internalError(w http.ResponseWriter, err error) {
+	logf.Log.WithName("acme-dns").Error(err, "handle request")
+	writeJSON(w, http.StatusInternalServerError, errorResponse{Error: errorInternal})
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func newPassword() (string, error) {
+	password := make([]byte, passwordLength)
+	letters := big.NewInt(int64(len(passwordLetters)))
+	for i := range password {
+		n, err := rand.Int(rand.Reader, letters)
+		if err != nil {
+			return "", fmt.Errorf("generate password: %w", err)
+		}
+		password[i] = passwordLetters[n.Int64()]
+	}
+
+	return string(password), nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func fqdnOf(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+
+	return name + "."
+}
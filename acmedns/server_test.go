@@ -0,0 +1,249 @@
+package acmedns
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/selectel/cert-manager-webhook-selectel/internal/fakeselectel"
+	"github.com/selectel/cert-manager-webhook-selectel/selectel"
+	domainsV2 "github.com/selectel/domains-go/pkg/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testDomain = "auth.example.com"
+
+type testServer struct {
+	server *Server
+	fake   *fakeselectel.Server
+	zoneID string
+}
+
+// newTestServer serves subdomains of auth.example.com in example.com zone
+// of fake Selectel API.
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	fake := fakeselectel.NewServer()
+	t.Cleanup(fake.Close)
+	zoneID := fake.AddZone("example.com.")
+	config, err := selectel.NewConfigForDNS()
+	require.NoError(t, err)
+	config.BaseURL = fake.BaseURL()
+	config.AllowInsecureBaseURL = true
+	config.AuthURL = fake.AuthURL()
+	config.AllowInsecureAuthURL = true
+	config.CredentialsForDNS = selectel.CredentialsForDNS{
+		Username:  []byte("user"),
+		Password:  []byte("password"),
+		AccountID: []byte("123456"),
+		ProjectID: []byte("project-id"),
+	}
+	provider, err := selectel.NewDNSProviderFromConfig(config)
+	require.NoError(t, err)
+	store := NewFileStore(filepath.Join(t.TempDir(), "accounts.json"))
+
+	server := NewServer(provider, store, "example.com", testDomain)
+	server.Registration = true
+
+	return &testServer{server: server, fake: fake, zoneID: zoneID}
+}
+
+// do sends request to handler from remoteAddr and decodes json response to result.
+func (s *testServer) do(t *testing.T, request *http.Request, remoteAddr string, result any) int {
+	t.Helper()
+	request.RemoteAddr = remoteAddr
+	recorder := httptest.NewRecorder()
+	s.server.Handler().ServeHTTP(recorder, request)
+	if result != nil {
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), result), recorder.Body.String())
+	}
+
+	return recorder.Code
+}
+
+func (s *testServer) register(t *testing.T, body string) registerResponse {
+	t.Helper()
+	response := registerResponse{}
+	request := httptest.NewRequest(http.MethodPost, "/register", strings.NewReader(body))
+	require.Equal(t, http.StatusCreated, s.do(t, request, "192.0.2.1:1234", &response))
+
+	return response
+}
+
+func newUpdateRequest(t *testing.T, account registerResponse, subdomain, txt string) *http.Request {
+	t.Helper()
+	body, err := json.Marshal(updateRequest{Subdomain: subdomain, TXT: txt})
+	require.NoError(t, err)
+	request := httptest.NewRequest(http.MethodPost, "/update", bytes.NewReader(body))
+	request.Header.Set(headerAPIUser, account.Username)
+	request.Header.Set(headerAPIKey, account.Password)
+
+	return request
+}
+
+func testValue(letter string) string {
+	return strings.Repeat(letter, 43)
+}
+
+func TestServer_RegisterAndUpdate(t *testing.T) {
+	t.Parallel()
+	server := newTestServer(t)
+	account := server.register(t, "")
+	assert.Len(t, account.Password, passwordLength)
+	assert.Equal(t, account.Subdomain+"."+testDomain, account.FullDomain)
+	assert.Empty(t, account.AllowFrom)
+	fqdn := account.FullDomain + "."
+
+	// the latest two values are kept for certificate of domain and its wildcard
+	for _, value := range []string{testValue("a"), testValue("b"), testValue("b"), testValue("c")} {
+		response := updateResponse{}
+		code := server.do(t, newUpdateRequest(t, account, account.Subdomain, value), "192.0.2.1:1234", &response)
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, value, response.TXT)
+	}
+	rrsets := server.fake.RRSets(server.zoneID)
+	require.Len(t, rrsets, 1)
+	assert.Equal(t, fqdn, rrsets[0].Name)
+	assert.Equal(t, []domainsV2.RecordItem{
+		{Content: `"` + testValue("b") + `"`},
+		{Content: `"` + testValue("c") + `"`},
+	}, rrsets[0].Records)
+}
+
+func TestServer_AllowFrom(t *testing.T) {
+	t.Parallel()
+	server := newTestServer(t)
+	account := server.register(t, `{"allowfrom":["192.0.2.0/24","2001:db8::/32"]}`)
+	assert.Equal(t, []string{"192.0.2.0/24", "2001:db8::/32"}, account.AllowFrom)
+
+	for remoteAddr, expected := range map[string]int{
+		"192.0.2.10:1234":    http.StatusOK,
+		"[2001:db8::1]:1234": http.StatusOK,
+		"198.51.100.1:1234":  http.StatusUnauthorized,
+	} {
+		code := server.do(t, newUpdateRequest(t, account, account.Subdomain, testValue("a")), remoteAddr, nil)
+		assert.Equal(t, expected, code, remoteAddr)
+	}
+}
+
+func TestServer_AllowFromHeader(t *testing.T) {
+	t.Parallel()
+	server := newTestServer(t)
+	server.server.HeaderName = "X-Forwarded-For"
+	account := server.register(t, `{"allowfrom":["192.0.2.0/24"]}`)
+
+	for header, expected := range map[string]int{
+		"192.0.2.10":               http.StatusOK,
+		"198.51.100.1, 192.0.2.10": http.StatusOK,
+		"192.0.2.10, 198.51.100.1": http.StatusUnauthorized,
+		"":                         http.StatusUnauthorized,
+		"2001:db8::1":              http.StatusUnauthorized,
+	} {
+		request := newUpdateRequest(t, account, account.Subdomain, testValue("a"))
+		if header != "" {
+			request.Header.Set("X-Forwarded-For", header)
+		}
+		// proxy address is not checked
+		code := server.do(t, request, "10.0.0.1:1234", nil)
+		assert.Equal(t, expected, code, header)
+	}
+}
+
+func TestServer_Rejected(t *testing.T) {
+	t.Parallel()
+	server := newTestServer(t)
+	account := server.register(t, "")
+	other := server.register(t, "")
+	testCases := []struct {
+		name     string
+		request  *http.Request
+		code     int
+		expected string
+	}{
+		{
+			name: "unknown user",
+			request: newUpdateRequest(t, registerResponse{Username: "unknown", Password: account.Password},
+				account.Subdomain, testValue("a")),
+			code:     http.StatusUnauthorized,
+			expected: errorForbidden,
+		},
+		{
+			name: "wrong password",
+			request: newUpdateRequest(t, registerResponse{Username: account.Username, Password: other.Password},
+				account.Subdomain, testValue("a")),
+			code:     http.StatusUnauthorized,
+			expected: errorForbidden,
+		},
+		{
+			name:     "subdomain of other account",
+			request:  newUpdateRequest(t, account, other.Subdomain, testValue("a")),
+			code:     http.StatusUnauthorized,
+			expected: errorForbidden,
+		},
+		{
+			name:     "bad subdomain",
+			request:  newUpdateRequest(t, account, "Not.Subdomain", testValue("a")),
+			code:     http.StatusBadRequest,
+			expected: errorBadSubdomain,
+		},
+		{
+			name:     "bad txt",
+			request:  newUpdateRequest(t, account, account.Subdomain, "short"),
+			code:     http.StatusBadRequest,
+			expected: errorBadTXT,
+		},
+		{
+			name:     "invalid allowfrom",
+			request:  httptest.NewRequest(http.MethodPost, "/register", strings.NewReader(`{"allowfrom":["10.0.0.1"]}`)),
+			code:     http.StatusBadRequest,
+			expected: errorBadAllowFrom,
+		},
+		{
+			name:     "malformed json",
+			request:  httptest.NewRequest(http.MethodPost, "/register", strings.NewReader(`{`)),
+			code:     http.StatusBadRequest,
+			expected: errorMalformedJSON,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+			response := errorResponse{}
+			assert.Equal(t, testCase.code, server.do(t, testCase.request, "192.0.2.1:1234", &response))
+			assert.Equal(t, testCase.expected, response.Error)
+		})
+	}
+}
+
+func TestServer_RegisterChunkedEmptyBody(t *testing.T) {
+	t.Parallel()
+	server := newTestServer(t)
+	// body of unknown length, e.g. chunked
+	request := httptest.NewRequest(http.MethodPost, "/register", io.NopCloser(strings.NewReader("")))
+	require.Equal(t, int64(-1), request.ContentLength)
+	response := registerResponse{}
+	require.Equal(t, http.StatusCreated, server.do(t, request, "192.0.2.1:1234", &response))
+	assert.NotEmpty(t, response.Username)
+	assert.Empty(t, response.AllowFrom)
+}
+
+func TestServer_RegistrationDisabled(t *testing.T) {
+	t.Parallel()
+	server := newTestServer(t)
+	// registration is opt-in
+	server.server = NewServer(server.server.provider, server.server.store, "example.com", testDomain)
+
+	response := errorResponse{}
+	request := httptest.NewRequest(http.MethodPost, "/register", nil)
+	assert.Equal(t, http.StatusForbidden, server.do(t, request, "192.0.2.1:1234", &response))
+	assert.Equal(t, errorRegistrationOff, response.Error)
+
+	request = httptest.NewRequest(http.MethodGet, "/health", nil)
+	assert.Equal(t, http.StatusOK, server.do(t, request, "192.0.2.1:1234", nil))
+}
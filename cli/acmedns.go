@@ -0,0 +1,129 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/selectel/cert-manager-webhook-selectel/acmedns"
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/kubernetes"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+const (
+	defaultACMEDNSAddr = ":8080"
+	// acmeDNSReadTimeout limits reading of requests, they are small.
+	acmeDNSReadTimeout = 10 * time.Second
+	// acmeDNSShutdownTimeout limits waiting for updates in progress on stop.
+	acmeDNSShutdownTimeout = 30 * time.Second
+)
+
+var errNoAccountStore = errors.New("setup --accounts-file or --accounts-namespace")
+
+type acmeDNSOptions struct {
+	addr               string
+	domain             string
+	accountsFile       string
+	accountsNamespace  string
+	enableRegistration bool
+	headerName         string
+}
+
+func newACMEDNSCommand(opts *options) *cobra.Command {
+	acmeDNSOpts := &acmeDNSOptions{}
+	command := &cobra.Command{
+		Use:   "acme-dns",
+		Short: "Serve acme-dns compatible API of subdomains of --domain",
+		Long: `Serve acme-dns compatible API, /register and /update, of subdomains of --domain,
+e.g. for ACME clients supporting acme-dns like certbot-dns-acmedns, acme.sh dns_acmedns,
+lego and Caddy. _acme-challenge of validated domain is CNAME to subdomain of account,
+TXT records of subdomains are changed in Selectel zone of --domain with the same provider
+as webhook until the command is interrupted.
+
+Accounts are kept in --accounts-file or in Secrets of --accounts-namespace read with --kubeconfig,
+/register is rejected unless --enable-registration is set.
+The API should be served behind TLS terminating proxy, allowfrom of accounts is checked
+with client address from --header-name set by the proxy.`,
+		Args: cobra.NoArgs,
+		RunE: func(command *cobra.Command, _ []string) error {
+			return opts.serveACMEDNS(command.Context(), acmeDNSOpts)
+		},
+	}
+	flags := command.Flags()
+	flags.StringVar(&acmeDNSOpts.addr, "listen", defaultACMEDNSAddr, "http address of acme-dns api")
+	flags.StringVar(&acmeDNSOpts.domain, "domain", "", "domain of account subdomains in Selectel zone, e.g. auth.example.com")
+	flags.StringVar(&acmeDNSOpts.accountsFile, "accounts-file", "", "json file with accounts")
+	flags.StringVar(&acmeDNSOpts.accountsNamespace, "accounts-namespace", "", "namespace of Secrets with accounts")
+	flags.BoolVar(&acmeDNSOpts.enableRegistration, "enable-registration", false,
+		"allow anyone reaching the api to register accounts with /register")
+	flags.StringVar(&acmeDNSOpts.headerName, "header-name", "",
+		"header with client address set by trusted proxy for allowfrom, e.g. X-Forwarded-For")
+	_ = command.MarkFlagRequired("domain")
+	command.MarkFlagsMutuallyExclusive("accounts-file", "accounts-namespace")
+
+	return command
+}
+
+func (o *options) serveACMEDNS(ctx context.Context, acmeDNSOpts *acmeDNSOptions) error {
+	store, err := o.accountStore(acmeDNSOpts)
+	if err != nil {
+		return err
+	}
+	provider, err := o.provider(ctx)
+	if err != nil {
+		return err
+	}
+	zone, err := provider.FindZone(ctx, fqdnOf(acmeDNSOpts.domain))
+	if err != nil {
+		return err //nolint: wrapcheck
+	}
+	server := acmedns.NewServer(provider, store, zone.Name, acmeDNSOpts.domain)
+	server.Registration = acmeDNSOpts.enableRegistration
+	server.HeaderName = acmeDNSOpts.headerName
+	logf.SetLogger(zap.New())
+	logf.Log.WithName("acme-dns").Info("serving acme-dns api",
+		"addr", acmeDNSOpts.addr, "domain", acmeDNSOpts.domain, "zone", zone.Name, "registration", server.Registration)
+	httpServer := &http.Server{
+		Addr:              acmeDNSOpts.addr,
+		Handler:           server.Handler(),
+		ReadHeaderTimeout: acmeDNSReadTimeout,
+		ReadTimeout:       acmeDNSReadTimeout,
+	}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- httpServer.ListenAndServe()
+	}()
+	select {
+	case err = <-errs:
+		return fmt.Errorf("serve acme-dns: %w", err)
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), acmeDNSShutdownTimeout)
+	defer cancel()
+
+	return httpServer.Shutdown(shutdownCtx) //nolint: wrapcheck,contextcheck
+}
+
+func (o *options) accountStore(acmeDNSOpts *acmeDNSOptions) (acmedns.Store, error) {
+	switch {
+	case acmeDNSOpts.accountsFile != "":
+		return acmedns.NewFileStore(acmeDNSOpts.accountsFile), nil
+	case acmeDNSOpts.accountsNamespace != "":
+		restConfig, err := o.credentials.clientConfig().ClientConfig()
+		if err != nil {
+			return nil, fmt.Errorf("load kubeconfig: %w", err)
+		}
+		client, err := kubernetes.NewForConfig(restConfig)
+		if err != nil {
+			return nil, fmt.Errorf("k8s clientset: %w", err)
+		}
+
+		return acmedns.NewSecretStore(client, acmeDNSOpts.accountsNamespace), nil
+	default:
+		return nil, errNoAccountStore
+	}
+}
@@ -0,0 +1,74 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// challengeResult is output of present and cleanup.
+type challengeResult struct {
+	Action  string `json:"action"`
+	Zone    string `json:"zone"`
+	FQDN    string `json:"fqdn"`
+	Value   string `json:"value"`
+	ZoneID  string `json:"zoneId,omitempty"`
+	RRSetID string `json:"rrsetId,omitempty"`
+}
+
+func (r *challengeResult) printText(w io.Writer) {
+	fmt.Fprintf(w, "%s %q in %s of zone %s\n", r.Action, r.Value, r.FQDN, r.Zone)
+}
+
+func newPresentCommand(opts *options) *cobra.Command {
+	return &cobra.Command{
+		Use:   "present <zone> <fqdn> <value>",
+		Short: "Add record of challenge to TXT RRSet like webhook does",
+		Args:  cobra.ExactArgs(3), //nolint: mnd
+		RunE: func(command *cobra.Command, args []string) error {
+			provider, err := opts.provider(command.Context())
+			if err != nil {
+				return err
+			}
+			result := &challengeResult{Action: "presented", Zone: fqdnOf(args[0]), FQDN: fqdnOf(args[1]), Value: args[2]}
+			record, err := provider.PresentRecord(result.Zone, result.FQDN, result.Value)
+			if err != nil {
+				return err //nolint: wrapcheck
+			}
+			result.ZoneID, result.RRSetID = record.ZoneID, record.RRSetID
+
+			return opts.print(command, result, result.printText)
+		},
+	}
+}
+
+func newCleanUpCommand(opts *options) *cobra.Command {
+	return &cobra.Command{
+		Use:   "cleanup <zone> <fqdn> <value>",
+		Short: "Remove record of challenge from TXT RRSet like webhook does",
+		Args:  cobra.ExactArgs(3), //nolint: mnd
+		RunE: func(command *cobra.Command, args []string) error {
+			provider, err := opts.provider(command.Context())
+			if err != nil {
+				return err
+			}
+			result := &challengeResult{Action: "cleaned up", Zone: fqdnOf(args[0]), FQDN: fqdnOf(args[1]), Value: args[2]}
+			if err = provider.CleanUp(result.Zone, result.FQDN, result.Value); err != nil {
+				return err //nolint: wrapcheck
+			}
+
+			return opts.print(command, result, result.printText)
+		},
+	}
+}
+
+// fqdnOf adds trailing dot like in ChallengeRequest of cert-manager.
+func fqdnOf(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+
+	return name + "."
+}
@@ -0,0 +1,158 @@
+// Package cli implements selectel-dns commands of webhook binary for debugging
+// of issuance: they call Selectel API with the same provider as webhook.
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/selectel/cert-manager-webhook-selectel/selectel"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+)
+
+// CommandName is the first argument or name of binary running commands
+// instead of webhook server.
+const CommandName = "selectel-dns"
+
+const (
+	outputText = "text"
+	outputJSON = "json"
+
+	cliInstance = "selectel-dns"
+)
+
+var errUnknownOutput = errors.New("unknown output format")
+
+// CommandArgs returns arguments of selectel-dns command in os.Args and
+// whether webhook binary is run as selectel-dns, either by the name
+// of binary or by the first argument.
+func CommandArgs(args []string) ([]string, bool) {
+	switch {
+	case len(args) == 0:
+		return nil, false
+	case filepath.Base(args[0]) == CommandName:
+		return args[1:], true
+	case len(args) > 1 && args[1] == CommandName:
+		return args[2:], true
+	default:
+		return nil, false
+	}
+}
+
+// Run executes command of args without binary name and selectel-dns,
+// it returns exit code. Solver config of issuers is loaded by loadConfig.
+func Run(args []string, stdout, stderr io.Writer, loadConfig LoadSolverConfig) int {
+	command := NewCommand(loadConfig)
+	command.SetArgs(args)
+	command.SetOut(stdout)
+	command.SetErr(stderr)
+	// long running commands stop on interrupt
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := command.ExecuteContext(ctx); err != nil {
+		return 1
+	}
+
+	return 0
+}
+
+// options are flags shared by commands.
+type options struct {
+	credentials credentialsOptions
+	configFile  string
+	clusterID   string
+	output      string
+}
+
+// NewCommand returns root selectel-dns command, doctor command is added
+// if loadConfig is set.
+func NewCommand(loadConfig LoadSolverConfig) *cobra.Command {
+	opts := &options{}
+	command := &cobra.Command{
+		Use:   CommandName,
+		Short: "Call Selectel DNS API with the same provider as webhook",
+		Long: `Call Selectel DNS API with the same provider as webhook.
+
+Credentials are read from Secret in --secret with --kubeconfig, from --credentials-file
+with the same keys as the Secret or from SELECTEL_USERNAME, SELECTEL_PASSWORD,
+SELECTEL_ACCOUNT_ID, SELECTEL_PROJECT_ID and SELECTEL_PROJECT_IDS env. Secret and
+--credentials-file may be clouds.yaml, its cloud is selected by cloud of --config,
+or rc.sh of OpenStack clients.`,
+		SilenceUsage: true,
+		PersistentPreRunE: func(*cobra.Command, []string) error {
+			if opts.output != outputText && opts.output != outputJSON {
+				return fmt.Errorf("%w: %s", errUnknownOutput, opts.output)
+			}
+
+			return nil
+		},
+	}
+	flags := command.PersistentFlags()
+	opts.credentials.addFlags(flags)
+	flags.StringVar(&opts.configFile, "config", "",
+		"file with solver config of issuer in json or yaml, e.g. baseUrl, authUrl and ttl")
+	flags.StringVar(&opts.clusterID, "cluster-id", os.Getenv("CLUSTER_ID"),
+		"cluster id marking RRSets created by present")
+	flags.StringVarP(&opts.output, "output", "o", outputText, "output format: text or json")
+
+	command.AddCommand(
+		newZonesCommand(opts),
+		newRRSetsCommand(opts),
+		newPresentCommand(opts),
+		newCleanUpCommand(opts),
+		newHookCommand(opts),
+		newRFC2136Command(opts),
+		newACMEDNSCommand(opts),
+	)
+	if loadConfig != nil {
+		command.AddCommand(newDoctorCommand(opts, loadConfig))
+	}
+
+	return command
+}
+
+// config returns webhook defaults overridden by config file and credentials.
+func (o *options) config(ctx context.Context) (*selectel.Config, error) {
+	config, err := selectel.NewConfigForDNS()
+	if err != nil {
+		return nil, fmt.Errorf("setup selectel config: %w", err)
+	}
+	if o.configFile != "" {
+		data, err := os.ReadFile(o.configFile)
+		if err != nil {
+			return nil, fmt.Errorf("read config: %w", err)
+		}
+		if err = yaml.Unmarshal(data, config); err != nil {
+			return nil, fmt.Errorf("unmarshal config: %w", err)
+		}
+	}
+	if err = config.Validate(); err != nil {
+		return nil, fmt.Errorf("validate config: %w", err)
+	}
+	if err = o.credentials.load(ctx, config); err != nil {
+		return nil, err
+	}
+	config.Owner = selectel.Owner{ClusterID: o.clusterID, Instance: cliInstance}
+
+	return config, nil
+}
+
+func (o *options) provider(ctx context.Context) (*selectel.DNSProvider, error) {
+	config, err := o.config(ctx)
+	if err != nil {
+		return nil, err
+	}
+	provider, err := selectel.NewDNSProviderFromConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("setup dns provider: %w", err)
+	}
+
+	return provider, nil
+}
@@ -0,0 +1,157 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/selectel/cert-manager-webhook-selectel/internal/fakeselectel"
+	domainsV2 "github.com/selectel/domains-go/pkg/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommandArgs(t *testing.T) {
+	t.Parallel()
+	args, ok := CommandArgs([]string{"/webhook", "selectel-dns", "zones", "list"})
+	require.True(t, ok)
+	assert.Equal(t, []string{"zones", "list"}, args)
+
+	args, ok = CommandArgs([]string{"/usr/bin/selectel-dns", "zones", "list"})
+	require.True(t, ok)
+	assert.Equal(t, []string{"zones", "list"}, args)
+
+	_, ok = CommandArgs([]string{"/webhook", "--secure-port=443"})
+	assert.False(t, ok)
+	_, ok = CommandArgs(nil)
+	assert.False(t, ok)
+}
+
+// runCommand runs selectel-dns with flags of fake server and credentials file.
+func runCommand(t *testing.T, server *fakeselectel.Server, args ...string) (string, string, int) {
+	t.Helper()
+	dir := t.TempDir()
+	credentialsFile := filepath.Join(dir, "credentials.yaml")
+	credentials := "username: user\npassword: password\naccount_id: \"123456\"\nproject_id: project-id\n"
+	require.NoError(t, os.WriteFile(credentialsFile, []byte(credentials), 0o600))
+	configFile := filepath.Join(dir, "config.yaml")
+	config := "baseUrl: " + server.BaseURL() + "\nallowInsecureBaseUrl: true\n" +
+		"authUrl: " + server.AuthURL() + "\nallowInsecureAuthUrl: true\n"
+	require.NoError(t, os.WriteFile(configFile, []byte(config), 0o600))
+
+	var stdout, stderr bytes.Buffer
+	args = append(args, "--credentials-file", credentialsFile, "--config", configFile, "--cluster-id", "dev")
+	code := Run(args, &stdout, &stderr, nil)
+
+	return stdout.String(), stderr.String(), code
+}
+
+func TestZonesList(t *testing.T) {
+	t.Parallel()
+	server := fakeselectel.NewServer()
+	t.Cleanup(server.Close)
+	zoneID := server.AddZone("example.com.")
+
+	stdout, stderr, code := runCommand(t, server, "zones", "list")
+	require.Equal(t, 0, code, stderr)
+	assert.Contains(t, stdout, "example.com.")
+	assert.Contains(t, stdout, zoneID)
+
+	stdout, stderr, code = runCommand(t, server, "zones", "list", "-o", "json")
+	require.Equal(t, 0, code, stderr)
+	var zones []domainsV2.Zone
+	require.NoError(t, json.Unmarshal([]byte(stdout), &zones))
+	require.Len(t, zones, 1)
+	assert.Equal(t, zoneID, zones[0].ID)
+}
+
+func TestZonesList_CloudsYAML(t *testing.T) {
+	t.Parallel()
+	server := fakeselectel.NewServer()
+	t.Cleanup(server.Close)
+	server.AddZone("example.com.")
+	dir := t.TempDir()
+	credentialsFile := filepath.Join(dir, "clouds.yaml")
+	clouds := "clouds:\n" +
+		"  prod: {auth: {username: user, password: password, user_domain_name: \"123456\", project_id: project-id}}\n" +
+		"  staging: {auth: {username: staging}}\n"
+	require.NoError(t, os.WriteFile(credentialsFile, []byte(clouds), 0o600))
+	configFile := filepath.Join(dir, "config.yaml")
+	config := "baseUrl: " + server.BaseURL() + "\nallowInsecureBaseUrl: true\n" +
+		"authUrl: " + server.AuthURL() + "\nallowInsecureAuthUrl: true\n"
+	require.NoError(t, os.WriteFile(configFile, []byte(config+"cloud: prod\n"), 0o600))
+
+	var stdout, stderr bytes.Buffer
+	code := Run([]string{"zones", "list", "--credentials-file", credentialsFile, "--config", configFile}, &stdout, &stderr, nil)
+	require.Equal(t, 0, code, stderr.String())
+	assert.Contains(t, stdout.String(), "example.com.")
+
+	require.NoError(t, os.WriteFile(configFile, []byte(config+"cloud: staging\n"), 0o600))
+	stdout.Reset()
+	code = Run([]string{"zones", "list", "--credentials-file", credentialsFile, "--config", configFile}, &stdout, &stdout, nil)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stdout.String(), "setup clouds.staging.auth.password in clouds.yaml or password key")
+}
+
+func TestPresentGetCleanUp(t *testing.T) {
+	t.Parallel()
+	server := fakeselectel.NewServer()
+	t.Cleanup(server.Close)
+	zoneID := server.AddZone("example.com.")
+	fqdn := "_acme-challenge.www.example.com"
+
+	stdout, stderr, code := runCommand(t, server, "present", "example.com", fqdn, "value", "-o", "json")
+	require.Equal(t, 0, code, stderr)
+	var result challengeResult
+	require.NoError(t, json.Unmarshal([]byte(stdout), &result))
+	rrsets := server.RRSets(zoneID)
+	require.Len(t, rrsets, 1)
+	assert.Equal(t, zoneID, result.ZoneID)
+	assert.Equal(t, rrsets[0].ID, result.RRSetID)
+	assert.Equal(t, "cert-manager-webhook-selectel cluster=dev instance=selectel-dns", rrsets[0].Comment)
+
+	// zone is detected from fqdn
+	stdout, stderr, code = runCommand(t, server, "rrsets", "get", fqdn, "-o", "json")
+	require.Equal(t, 0, code, stderr)
+	var rrset domainsV2.RRSet
+	require.NoError(t, json.Unmarshal([]byte(stdout), &rrset))
+	assert.Equal(t, []domainsV2.RecordItem{{Content: `"value"`}}, rrset.Records)
+
+	stdout, stderr, code = runCommand(t, server, "rrsets", "get", fqdn, "--zone", "example.com")
+	require.Equal(t, 0, code, stderr)
+	assert.Contains(t, stdout, `"value"`)
+
+	stdout, stderr, code = runCommand(t, server, "cleanup", "example.com", fqdn, "value")
+	require.Equal(t, 0, code, stderr)
+	assert.Contains(t, stdout, "cleaned up")
+	assert.Empty(t, server.RRSets(zoneID))
+
+	_, stderr, code = runCommand(t, server, "rrsets", "get", fqdn)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "not found")
+}
+
+func TestInvalidOptions(t *testing.T) {
+	t.Parallel()
+	server := fakeselectel.NewServer()
+	t.Cleanup(server.Close)
+
+	_, stderr, code := runCommand(t, server, "zones", "list", "-o", "xml")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "unknown output format: xml")
+
+	var stdout bytes.Buffer
+	code = Run([]string{"zones", "list", "--credentials-file", filepath.Join(t.TempDir(), "missing.yaml")}, &stdout, &stdout, nil)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stdout.String(), "read credentials file")
+
+	_, stderr, code = runCommand(t, server, "rfc2136", "--rfc2136-config", filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "read rfc2136 config")
+
+	_, stderr, code = runCommand(t, server, "acme-dns", "--domain", "auth.example.com")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "setup --accounts-file or --accounts-namespace")
+}
@@ -0,0 +1,133 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/selectel/cert-manager-webhook-selectel/selectel"
+	"github.com/spf13/pflag"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/yaml"
+)
+
+// Env of credentials, keys are the same as in Secret.
+const (
+	usernameEnvVar   = "SELECTEL_USERNAME"
+	passwordEnvVar   = "SELECTEL_PASSWORD"
+	accountIDEnvVar  = "SELECTEL_ACCOUNT_ID"
+	projectIDEnvVar  = "SELECTEL_PROJECT_ID"
+	projectIDsEnvVar = "SELECTEL_PROJECT_IDS"
+)
+
+var errInvalidSecretRef = errors.New("secret must be namespace/name")
+
+type credentialsOptions struct {
+	kubeconfig string
+	secret     string
+	file       string
+}
+
+func (o *credentialsOptions) addFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&o.kubeconfig, "kubeconfig", "",
+		"kubeconfig to read --secret, default is KUBECONFIG env, ~/.kube/config or in-cluster config")
+	flags.StringVar(&o.secret, "secret", "", "Secret with credentials as namespace/name")
+	flags.StringVar(&o.file, "credentials-file", "",
+		"file with credentials in json or yaml with keys of Secret, clouds.yaml or rc.sh")
+}
+
+// load reads credentials of config from Secret, file or env and validates them,
+// auth url and region of clouds.yaml and rc.sh are applied like in webhook.
+func (o *credentialsOptions) load(ctx context.Context, config *selectel.Config) error {
+	var err error
+	switch {
+	case o.secret != "":
+		err = o.fromSecret(ctx, config)
+	case o.file != "":
+		err = o.fromFile(config)
+	default:
+		fromEnv(&config.CredentialsForDNS)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err = config.CredentialsForDNS.Validate(); err != nil {
+		return fmt.Errorf("validate credentials: %w", err)
+	}
+
+	return nil
+}
+
+func (o *credentialsOptions) fromSecret(ctx context.Context, config *selectel.Config) error {
+	namespace, name, ok := strings.Cut(o.secret, "/")
+	if !ok {
+		return fmt.Errorf("%w: %s", errInvalidSecretRef, o.secret)
+	}
+	restConfig, err := o.clientConfig().ClientConfig()
+	if err != nil {
+		return fmt.Errorf("load kubeconfig: %w", err)
+	}
+	client, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return fmt.Errorf("k8s clientset: %w", err)
+	}
+	secret, err := client.CoreV1().Secrets(namespace).Get(ctx, name, metaV1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("getting secret from k8s: %w", err)
+	}
+	if err = config.FromSecretData(secret.Data); err != nil {
+		return fmt.Errorf("setup credentials from secret: %w", err)
+	}
+
+	return nil
+}
+
+// clientConfig loads --kubeconfig or default kubeconfig.
+func (o *credentialsOptions) clientConfig() clientcmd.ClientConfig {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = o.kubeconfig
+
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, nil)
+}
+
+func (o *credentialsOptions) fromFile(config *selectel.Config) error {
+	data, err := os.ReadFile(o.file)
+	if err != nil {
+		return fmt.Errorf("read credentials file: %w", err)
+	}
+	// clouds.yaml and rc.sh are read like keys of Secret with the same names
+	if name := filepath.Base(o.file); name == selectel.CloudsYAMLKey || name == selectel.OpenRCKey {
+		if err = config.FromSecretData(map[string][]byte{name: data}); err != nil {
+			return fmt.Errorf("setup credentials from file: %w", err)
+		}
+
+		return nil
+	}
+	values := map[string]string{}
+	if err = yaml.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("unmarshal credentials file: %w", err)
+	}
+	secretData := make(map[string][]byte, len(values))
+	for key, value := range values {
+		secretData[key] = []byte(value)
+	}
+	if err = config.CredentialsForDNS.FromMapBytes(secretData); err != nil {
+		return fmt.Errorf("setup credentials from file: %w", err)
+	}
+
+	return nil
+}
+
+func fromEnv(credentials *selectel.CredentialsForDNS) {
+	credentials.Username = []byte(os.Getenv(usernameEnvVar))
+	credentials.Password = []byte(os.Getenv(passwordEnvVar))
+	credentials.AccountID = []byte(os.Getenv(accountIDEnvVar))
+	credentials.ProjectID = []byte(os.Getenv(projectIDEnvVar))
+	credentials.ProjectIDs = []byte(os.Getenv(projectIDsEnvVar))
+}
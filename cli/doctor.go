@@ -0,0 +1,415 @@
+package cli
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	cmacme "github.com/cert-manager/cert-manager/pkg/apis/acme/v1"
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"github.com/selectel/cert-manager-webhook-selectel/selectel"
+	"github.com/spf13/cobra"
+	extAPI "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	kindIssuer        = "issuer"
+	kindClusterIssuer = "clusterissuer"
+
+	defaultSolverName = "selectel"
+	// Namespace of Secrets of ClusterIssuers by default in cert-manager.
+	defaultClusterResourceNamespace = "cert-manager"
+
+	checkPass = "pass"
+	checkFail = "fail"
+	checkSkip = "skip"
+
+	// challengePrefix is label of challenge records, canary record is created in it too.
+	challengePrefix = "_acme-challenge."
+	// canaryValueBytes is length of random part of canary record.
+	canaryValueBytes = 8
+)
+
+var (
+	issuersResource        = schema.GroupVersionResource{Group: "cert-manager.io", Version: "v1", Resource: "issuers"}
+	clusterIssuersResource = schema.GroupVersionResource{Group: "cert-manager.io", Version: "v1", Resource: "clusterissuers"}
+
+	// selectelNameservers are suffixes of nameservers of DNS Hosting.
+	selectelNameservers = []string{".ns.selectel.ru.", ".ns.selectel.com."}
+
+	errChecksFailed      = errors.New("checks failed")
+	errUnknownIssuerKind = errors.New("kind must be issuer or clusterissuer")
+	errSolverNotFound    = errors.New("no selectel webhook solver")
+	errConfigNotSetup    = errors.New("config of solver is not set")
+	errNotDelegated      = errors.New("zone is not delegated to Selectel")
+)
+
+// SolverConfig is solver config of issuer loaded by webhook.
+type SolverConfig interface {
+	// Setup reads Secrets referenced by config in namespace and validates credentials.
+	Setup(ctx context.Context, client kubernetes.Interface, namespace string) (*selectel.Config, error)
+}
+
+// LoadSolverConfig decodes solver config of issuer strictly and validates it
+// like webhook does, webhook owns format of the config. Resources referenced
+// by the config, e.g. SelectelDNSConfig, are read with client. Defaults of
+// the config depend on solverName of issuer.
+type LoadSolverConfig func(ctx context.Context, client dynamic.Interface, solverName string, config *extAPI.JSON) (SolverConfig, error)
+
+// CheckResult is a result of a doctor check.
+type CheckResult struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+// issuerRef is kind/name of issuer as in kubectl, name without kind is Issuer.
+type issuerRef struct {
+	kind      string
+	namespace string
+	name      string
+}
+
+func parseIssuerRef(value, namespace string) (issuerRef, error) {
+	kind, name, ok := strings.Cut(value, "/")
+	if !ok {
+		kind, name = kindIssuer, value
+	}
+	kind = strings.ToLower(kind)
+	switch kind {
+	case kindIssuer:
+		return issuerRef{kind: kind, namespace: namespace, name: name}, nil
+	case kindClusterIssuer:
+		return issuerRef{kind: kind, name: name}, nil
+	default:
+		return issuerRef{}, fmt.Errorf("%w: %s", errUnknownIssuerKind, kind)
+	}
+}
+
+func (r issuerRef) String() string {
+	if r.namespace == "" {
+		return r.kind + "/" + r.name
+	}
+
+	return r.kind + "/" + r.namespace + "/" + r.name
+}
+
+// doctor runs checks of issuer one by one, checks after a failed one are skipped.
+type doctor struct {
+	client     kubernetes.Interface
+	dynamic    dynamic.Interface
+	loadConfig LoadSolverConfig
+	lookupNS   func(ctx context.Context, name string) ([]*net.NS, error)
+
+	groupName                string
+	solverName               string
+	clusterResourceNamespace string
+	owner                    selectel.Owner
+
+	results []CheckResult
+	// blocked is set by a failed check, the next checks depend on it.
+	blocked bool
+}
+
+// check runs fn unless a previous check failed, message of fn is reported on success.
+func (d *doctor) check(name string, fn func() (string, error)) {
+	if d.blocked {
+		d.results = append(d.results, CheckResult{Name: name, Status: checkSkip})
+
+		return
+	}
+	message, err := fn()
+	if err != nil {
+		d.results = append(d.results, CheckResult{Name: name, Status: checkFail, Message: err.Error()})
+		d.blocked = true
+
+		return
+	}
+	d.results = append(d.results, CheckResult{Name: name, Status: checkPass, Message: message})
+}
+
+func (d *doctor) failed() bool {
+	for _, result := range d.results {
+		if result.Status == checkFail {
+			return true
+		}
+	}
+
+	return false
+}
+
+// run checks solver of issuer for zone: config, Secret, Keystone authentication,
+// zone, its delegation and creation of canary record.
+func (d *doctor) run(ctx context.Context, ref issuerRef, zoneName string) []CheckResult {
+	d.results, d.blocked = nil, false
+	zoneName = fqdnOf(zoneName)
+	var (
+		webhook  *cmacme.ACMEIssuerDNS01ProviderWebhook
+		solver   SolverConfig
+		config   *selectel.Config
+		provider *selectel.DNSProvider
+	)
+	d.check("issuer", func() (string, error) {
+		var err error
+		webhook, err = d.webhookSolver(ctx, ref, zoneName)
+		if err != nil {
+			return "", err
+		}
+
+		return fmt.Sprintf("%s has selectel webhook solver for %s", ref, zoneName), nil
+	})
+	d.check("config", func() (string, error) {
+		if webhook.Config == nil {
+			return "", errConfigNotSetup
+		}
+		var err error
+		if solver, err = d.loadConfig(ctx, d.dynamic, webhook.SolverName, webhook.Config); err != nil {
+			return "", err
+		}
+
+		return "config of solver is valid", nil
+	})
+	d.check("secret", func() (string, error) {
+		namespace := ref.namespace
+		if ref.kind == kindClusterIssuer {
+			namespace = d.clusterResourceNamespace
+		}
+		var err error
+		if config, err = solver.Setup(ctx, d.client, namespace); err != nil {
+			return "", err //nolint: wrapcheck
+		}
+		config.Owner = d.owner
+
+		return "credentials in " + namespace + " are valid", nil
+	})
+	d.check("auth", func() (string, error) {
+		var err error
+		if provider, err = selectel.NewDNSProviderFromConfig(config); err != nil {
+			return "", fmt.Errorf("setup dns provider: %w", err)
+		}
+
+		return "token is issued by " + config.AuthURL, nil
+	})
+	d.check("zone", func() (string, error) {
+		zone, err := provider.GetZone(ctx, zoneName)
+		if err != nil {
+			return "", err //nolint: wrapcheck
+		}
+
+		return fmt.Sprintf("zone %s is found in project %s", zone.ID, zone.ProjectID), nil
+	})
+	blocked := d.blocked
+	d.check("delegation", func() (string, error) {
+		return d.delegation(ctx, zoneName)
+	})
+	// records of zone which is not delegated are not seen by ACME server,
+	// but API calls are checked anyway
+	d.blocked = blocked
+	d.check("canary", func() (string, error) {
+		if err := config.CheckDomain(zoneName); err != nil {
+			return "", err //nolint: wrapcheck
+		}
+		fqdn := challengePrefix + zoneName
+		value, err := canaryValue()
+		if err != nil {
+			return "", err
+		}
+		if _, err = provider.PresentRecord(zoneName, fqdn, value); err != nil {
+			return "", err //nolint: wrapcheck
+		}
+		if err = provider.CleanUp(zoneName, fqdn, value); err != nil {
+			return "", err //nolint: wrapcheck
+		}
+
+		return "TXT record in " + fqdn + " is created and deleted", nil
+	})
+
+	return d.results
+}
+
+// webhookSolver returns the first selectel webhook solver of issuer
+// which selects zone or has no dns zones in selector.
+func (d *doctor) webhookSolver(ctx context.Context, ref issuerRef, zoneName string) (*cmacme.ACMEIssuerDNS01ProviderWebhook, error) {
+	resource := d.dynamic.Resource(issuersResource).Namespace(ref.namespace)
+	if ref.kind == kindClusterIssuer {
+		resource = d.dynamic.Resource(clusterIssuersResource)
+	}
+	object, err := resource.Get(ctx, ref.name, metaV1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("get %s: %w", ref, err)
+	}
+	issuer := &cmapi.Issuer{}
+	if err = runtime.DefaultUnstructuredConverter.FromUnstructured(object.Object, issuer); err != nil {
+		return nil, fmt.Errorf("convert %s: %w", ref, err)
+	}
+	if issuer.Spec.ACME == nil {
+		return nil, fmt.Errorf("%w in %s: it is not acme issuer", errSolverNotFound, ref)
+	}
+	for _, solver := range issuer.Spec.ACME.Solvers {
+		if solver.DNS01 == nil || solver.DNS01.Webhook == nil {
+			continue
+		}
+		webhook := solver.DNS01.Webhook
+		if webhook.SolverName != d.solverName || (d.groupName != "" && webhook.GroupName != d.groupName) {
+			continue
+		}
+		if solver.Selector == nil || len(solver.Selector.DNSZones) == 0 || selectsZone(solver.Selector.DNSZones, zoneName) {
+			return webhook, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w for %s in %s", errSolverNotFound, zoneName, ref)
+}
+
+func selectsZone(dnsZones []string, zoneName string) bool {
+	zoneName = strings.TrimSuffix(zoneName, ".")
+	for _, dnsZone := range dnsZones {
+		dnsZone = strings.TrimSuffix(dnsZone, ".")
+		if zoneName == dnsZone || strings.HasSuffix(zoneName, "."+dnsZone) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// delegation checks that public NS records of zone point to Selectel.
+func (d *doctor) delegation(ctx context.Context, zoneName string) (string, error) {
+	nameservers, err := d.lookupNS(ctx, zoneName)
+	if err != nil {
+		return "", fmt.Errorf("lookup NS: %w", err)
+	}
+	hosts := make([]string, 0, len(nameservers))
+	delegated := len(nameservers) > 0
+	for _, nameserver := range nameservers {
+		host := strings.ToLower(fqdnOf(nameserver.Host))
+		hosts = append(hosts, host)
+		delegated = delegated && isSelectelNameserver(host)
+	}
+	if !delegated {
+		return "", fmt.Errorf("%w: NS are %s", errNotDelegated, strings.Join(hosts, ", "))
+	}
+
+	return "NS are " + strings.Join(hosts, ", "), nil
+}
+
+func isSelectelNameserver(host string) bool {
+	for _, suffix := range selectelNameservers {
+		if strings.HasSuffix(host, suffix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func canaryValue() (string, error) {
+	random := make([]byte, canaryValueBytes)
+	if _, err := rand.Read(random); err != nil {
+		return "", fmt.Errorf("generate canary value: %w", err)
+	}
+
+	return cliInstance + "-doctor-" + hex.EncodeToString(random), nil
+}
+
+func newDoctorCommand(opts *options, loadConfig LoadSolverConfig) *cobra.Command {
+	var (
+		namespace                string
+		zoneName                 string
+		groupName                string
+		solverName               string
+		clusterResourceNamespace string
+	)
+	command := &cobra.Command{
+		Use:   "doctor [issuer/|clusterissuer/]<name>",
+		Short: "Check solver of issuer end to end",
+		Long: `Check solver of issuer end to end: config of solver is decoded strictly,
+Secret with credentials is valid, Keystone token is issued, zone is found,
+public NS of zone point to Selectel and a canary TXT record is created and deleted.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(command *cobra.Command, args []string) error {
+			clientConfig := opts.credentials.clientConfig()
+			if namespace == "" {
+				var err error
+				if namespace, _, err = clientConfig.Namespace(); err != nil {
+					return fmt.Errorf("namespace of kubeconfig: %w", err)
+				}
+			}
+			ref, err := parseIssuerRef(args[0], namespace)
+			if err != nil {
+				return err
+			}
+			restConfig, err := clientConfig.ClientConfig()
+			if err != nil {
+				return fmt.Errorf("load kubeconfig: %w", err)
+			}
+			client, err := kubernetes.NewForConfig(restConfig)
+			if err != nil {
+				return fmt.Errorf("k8s clientset: %w", err)
+			}
+			dynamicClient, err := dynamic.NewForConfig(restConfig)
+			if err != nil {
+				return fmt.Errorf("k8s dynamic client: %w", err)
+			}
+			owner := selectel.Owner{ClusterID: opts.clusterID, Instance: cliInstance}
+			if owner.ClusterID == "" {
+				// cluster id of webhook without CLUSTER_ID
+				kubeSystem, err := client.CoreV1().Namespaces().Get(command.Context(), "kube-system", metaV1.GetOptions{})
+				if err == nil {
+					owner.ClusterID = string(kubeSystem.UID)
+				}
+			}
+			d := &doctor{
+				client:                   client,
+				dynamic:                  dynamicClient,
+				loadConfig:               loadConfig,
+				lookupNS:                 net.DefaultResolver.LookupNS,
+				groupName:                groupName,
+				solverName:               solverName,
+				clusterResourceNamespace: clusterResourceNamespace,
+				owner:                    owner,
+			}
+
+			return d.report(command, opts, ref, zoneName)
+		},
+	}
+	flags := command.Flags()
+	flags.StringVarP(&namespace, "namespace", "n", "", "namespace of Issuer, default is namespace of kubeconfig")
+	flags.StringVar(&zoneName, "zone", "", "zone to check, e.g. example.com")
+	flags.StringVar(&groupName, "group-name", "", "groupName of webhook solver, any by default")
+	flags.StringVar(&solverName, "solver-name", defaultSolverName, "solverName of webhook solver, e.g. named solver of defaults file")
+	flags.StringVar(&clusterResourceNamespace, "cluster-resource-namespace", defaultClusterResourceNamespace,
+		"namespace of Secrets of ClusterIssuer")
+	_ = command.MarkFlagRequired("zone")
+
+	return command
+}
+
+// report prints results of checks and fails if any check failed.
+func (d *doctor) report(command *cobra.Command, opts *options, ref issuerRef, zoneName string) error {
+	results := d.run(command.Context(), ref, zoneName)
+	err := opts.print(command, results, func(w io.Writer) {
+		fmt.Fprintln(w, "CHECK\tSTATUS\tMESSAGE")
+		for _, result := range results {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", result.Name, strings.ToUpper(result.Status), result.Message)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if d.failed() {
+		return errChecksFailed
+	}
+
+	return nil
+}
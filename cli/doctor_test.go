@@ -0,0 +1,316 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/selectel/cert-manager-webhook-selectel/internal/fakeselectel"
+	"github.com/selectel/cert-manager-webhook-selectel/selectel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	coreV1 "k8s.io/api/core/v1"
+	extAPI "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	dynamicFake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const (
+	testNamespace  = "team-a"
+	testSecretName = "selectel-dns-credentials"
+)
+
+// testSolverConfig decodes config like webhook with dnsSecretRef only.
+type testSolverConfig struct {
+	DNSSecretRef coreV1.SecretReference `json:"dnsSecretRef"`
+	*selectel.Config
+}
+
+func loadTestSolverConfig(_ context.Context, _ dynamic.Interface, _ string, config *extAPI.JSON) (SolverConfig, error) {
+	defaults, err := selectel.NewConfigForDNS()
+	if err != nil {
+		return nil, err //nolint: wrapcheck
+	}
+	cfg := &testSolverConfig{Config: defaults}
+	decoder := json.NewDecoder(bytes.NewReader(config.Raw))
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(cfg); err != nil {
+		return nil, fmt.Errorf("decode config strictly: %w", err)
+	}
+
+	return cfg, nil
+}
+
+func (c *testSolverConfig) Setup(ctx context.Context, client kubernetes.Interface, namespace string) (*selectel.Config, error) {
+	secret, err := client.CoreV1().Secrets(namespace).Get(ctx, c.DNSSecretRef.Name, metaV1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("getting secret from k8s: %w", err)
+	}
+	if err = c.CredentialsForDNS.FromMapBytes(secret.Data); err != nil {
+		return nil, err //nolint: wrapcheck
+	}
+
+	return c.Config, c.CredentialsForDNS.Validate() //nolint: wrapcheck
+}
+
+func newTestIssuer(kind, namespace, name string, config map[string]any) *unstructured.Unstructured {
+	issuer := &unstructured.Unstructured{Object: map[string]any{
+		"spec": map[string]any{
+			"acme": map[string]any{
+				"server":              "https://acme-staging-v02.api.letsencrypt.org/directory",
+				"privateKeySecretRef": map[string]any{"name": "letsencrypt-staging"},
+				"solvers": []any{
+					map[string]any{"http01": map[string]any{"ingress": map[string]any{}}},
+					map[string]any{
+						"dns01": map[string]any{
+							"webhook": map[string]any{
+								"groupName":  "acme.selectel.ru",
+								"solverName": "selectel",
+								"config":     config,
+							},
+						},
+					},
+				},
+			},
+		},
+	}}
+	issuer.SetAPIVersion("cert-manager.io/v1")
+	issuer.SetKind(kind)
+	issuer.SetNamespace(namespace)
+	issuer.SetName(name)
+
+	return issuer
+}
+
+func newTestSecret(namespace string) *coreV1.Secret {
+	return &coreV1.Secret{
+		ObjectMeta: metaV1.ObjectMeta{Namespace: namespace, Name: testSecretName},
+		Data: map[string][]byte{
+			"username":   []byte("user"),
+			"password":   []byte("password"),
+			"account_id": []byte("123456"),
+			"project_id": []byte("project-id"),
+		},
+	}
+}
+
+func newTestSolverConfigMap(server *fakeselectel.Server) map[string]any {
+	return map[string]any{
+		"dnsSecretRef":         map[string]any{"name": testSecretName},
+		"baseUrl":              server.BaseURL(),
+		"allowInsecureBaseUrl": true,
+		"authUrl":              server.AuthURL(),
+		"allowInsecureAuthUrl": true,
+	}
+}
+
+func lookupSelectelNS(_ context.Context, _ string) ([]*net.NS, error) {
+	return []*net.NS{{Host: "a.ns.selectel.ru."}, {Host: "b.ns.selectel.ru."}}, nil
+}
+
+func newTestDoctor(client kubernetes.Interface, dynamicClient dynamic.Interface) *doctor {
+	return &doctor{
+		client:                   client,
+		dynamic:                  dynamicClient,
+		loadConfig:               loadTestSolverConfig,
+		lookupNS:                 lookupSelectelNS,
+		solverName:               defaultSolverName,
+		clusterResourceNamespace: defaultClusterResourceNamespace,
+		owner:                    selectel.Owner{ClusterID: "dev", Instance: cliInstance},
+	}
+}
+
+func statuses(results []CheckResult) map[string]string {
+	statuses := map[string]string{}
+	for _, result := range results {
+		statuses[result.Name] = result.Status
+	}
+
+	return statuses
+}
+
+func TestDoctor_Run(t *testing.T) {
+	t.Parallel()
+	server := fakeselectel.NewServer()
+	t.Cleanup(server.Close)
+	zoneID := server.AddZone("example.com.")
+	otherZoneConfig := newTestSolverConfigMap(server)
+	otherZoneConfig["allowedDomains"] = []any{"example.org"}
+	unknownFieldConfig := newTestSolverConfigMap(server)
+	unknownFieldConfig["tll"] = int64(120)
+	dynamicClient := dynamicFake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{
+			issuersResource:        "IssuerList",
+			clusterIssuersResource: "ClusterIssuerList",
+		},
+		newTestIssuer("Issuer", testNamespace, "selectel", newTestSolverConfigMap(server)),
+		newTestIssuer("Issuer", testNamespace, "unknown-field", unknownFieldConfig),
+		newTestIssuer("Issuer", testNamespace, "not-allowed", otherZoneConfig),
+		newTestIssuer("Issuer", "team-b", "without-secret", newTestSolverConfigMap(server)),
+		newTestIssuer("ClusterIssuer", "", "selectel", newTestSolverConfigMap(server)),
+	)
+	client := fake.NewSimpleClientset(newTestSecret(testNamespace), newTestSecret(defaultClusterResourceNamespace))
+
+	testCases := []struct {
+		name      string
+		namespace string
+		issuer    string
+		zone      string
+		expected  map[string]string
+	}{
+		{
+			name:   "issuer",
+			issuer: "selectel",
+			zone:   "example.com",
+			expected: map[string]string{
+				"issuer": checkPass, "config": checkPass, "secret": checkPass, "auth": checkPass,
+				"zone": checkPass, "delegation": checkPass, "canary": checkPass,
+			},
+		},
+		{
+			name:   "cluster issuer",
+			issuer: "clusterissuer/selectel",
+			zone:   "example.com.",
+			expected: map[string]string{
+				"issuer": checkPass, "config": checkPass, "secret": checkPass, "auth": checkPass,
+				"zone": checkPass, "delegation": checkPass, "canary": checkPass,
+			},
+		},
+		{
+			name:   "issuer not found",
+			issuer: "missing",
+			zone:   "example.com",
+			expected: map[string]string{
+				"issuer": checkFail, "config": checkSkip, "secret": checkSkip, "auth": checkSkip,
+				"zone": checkSkip, "delegation": checkSkip, "canary": checkSkip,
+			},
+		},
+		{
+			name:   "unknown field",
+			issuer: "unknown-field",
+			zone:   "example.com",
+			expected: map[string]string{
+				"issuer": checkPass, "config": checkFail, "secret": checkSkip, "auth": checkSkip,
+				"zone": checkSkip, "delegation": checkSkip, "canary": checkSkip,
+			},
+		},
+		{
+			name:      "secret not found",
+			namespace: "team-b",
+			issuer:    "without-secret",
+			zone:      "example.com",
+			expected: map[string]string{
+				"issuer": checkPass, "config": checkPass, "secret": checkFail, "auth": checkSkip,
+				"zone": checkSkip, "delegation": checkSkip, "canary": checkSkip,
+			},
+		},
+		{
+			name:   "zone not found",
+			issuer: "selectel",
+			zone:   "example.org",
+			expected: map[string]string{
+				"issuer": checkPass, "config": checkPass, "secret": checkPass, "auth": checkPass,
+				"zone": checkFail, "delegation": checkSkip, "canary": checkSkip,
+			},
+		},
+		{
+			name:   "domain not allowed",
+			issuer: "not-allowed",
+			zone:   "example.com",
+			expected: map[string]string{
+				"issuer": checkPass, "config": checkPass, "secret": checkPass, "auth": checkPass,
+				"zone": checkPass, "delegation": checkPass, "canary": checkFail,
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+			namespace := testNamespace
+			if testCase.namespace != "" {
+				namespace = testCase.namespace
+			}
+			ref, err := parseIssuerRef(testCase.issuer, namespace)
+			require.NoError(t, err)
+			d := newTestDoctor(client, dynamicClient)
+
+			results := d.run(t.Context(), ref, testCase.zone)
+			assert.Equal(t, testCase.expected, statuses(results), results)
+		})
+	}
+	// canary records are deleted
+	assert.Empty(t, server.RRSets(zoneID))
+}
+
+func TestDoctor_NotDelegated(t *testing.T) {
+	t.Parallel()
+	server := fakeselectel.NewServer()
+	t.Cleanup(server.Close)
+	server.AddZone("example.com.")
+	dynamicClient := dynamicFake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{issuersResource: "IssuerList"},
+		newTestIssuer("Issuer", testNamespace, "selectel", newTestSolverConfigMap(server)),
+	)
+	d := newTestDoctor(fake.NewSimpleClientset(newTestSecret(testNamespace)), dynamicClient)
+	d.lookupNS = func(context.Context, string) ([]*net.NS, error) {
+		return []*net.NS{{Host: "ns1.example.net."}, {Host: "a.ns.selectel.ru."}}, nil
+	}
+
+	results := d.run(t.Context(), issuerRef{kind: kindIssuer, namespace: testNamespace, name: "selectel"}, "example.com")
+	// canary is checked in zone which is not delegated
+	assert.Equal(t, checkFail, statuses(results)["delegation"])
+	assert.Equal(t, checkPass, statuses(results)["canary"])
+	assert.True(t, d.failed())
+	for _, result := range results {
+		if result.Name == "delegation" {
+			assert.Equal(t, "zone is not delegated to Selectel: NS are ns1.example.net., a.ns.selectel.ru.", result.Message)
+		}
+	}
+}
+
+func TestParseIssuerRef(t *testing.T) {
+	t.Parallel()
+	ref, err := parseIssuerRef("selectel", testNamespace)
+	require.NoError(t, err)
+	assert.Equal(t, issuerRef{kind: kindIssuer, namespace: testNamespace, name: "selectel"}, ref)
+
+	ref, err = parseIssuerRef("ClusterIssuer/selectel", testNamespace)
+	require.NoError(t, err)
+	assert.Equal(t, issuerRef{kind: kindClusterIssuer, name: "selectel"}, ref)
+	assert.Equal(t, "clusterissuer/selectel", ref.String())
+
+	_, err = parseIssuerRef("certificate/selectel", testNamespace)
+	require.ErrorIs(t, err, errUnknownIssuerKind)
+}
+
+func TestDoctor_SolverName(t *testing.T) {
+	t.Parallel()
+	server := fakeselectel.NewServer()
+	t.Cleanup(server.Close)
+	issuer := newTestIssuer("Issuer", testNamespace, "selectel", newTestSolverConfigMap(server))
+	solvers, _, err := unstructured.NestedSlice(issuer.Object, "spec", "acme", "solvers")
+	require.NoError(t, err)
+	require.NoError(t, unstructured.SetNestedField(solvers[1].(map[string]any), "selectel-staging", "dns01", "webhook", "solverName"))
+	require.NoError(t, unstructured.SetNestedSlice(issuer.Object, solvers, "spec", "acme", "solvers"))
+	dynamicClient := dynamicFake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{issuersResource: "IssuerList"}, issuer)
+	d := newTestDoctor(fake.NewSimpleClientset(newTestSecret(testNamespace)), dynamicClient)
+	ref := issuerRef{kind: kindIssuer, namespace: testNamespace, name: "selectel"}
+
+	_, err = d.webhookSolver(t.Context(), ref, "example.com.")
+	require.ErrorIs(t, err, errSolverNotFound)
+
+	d.solverName = "selectel-staging"
+	webhook, err := d.webhookSolver(t.Context(), ref, "example.com.")
+	require.NoError(t, err)
+	assert.Equal(t, "selectel-staging", webhook.SolverName)
+}
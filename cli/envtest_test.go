@@ -0,0 +1,90 @@
+package cli
+
+import (
+	"os"
+	"testing"
+
+	"github.com/selectel/cert-manager-webhook-selectel/internal/fakeselectel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	coreV1 "k8s.io/api/core/v1"
+	extAPI "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+)
+
+// newIssuerCRD returns CRD of Issuer without schema, enough to store issuers.
+func newIssuerCRD(kind, plural string, scope extAPI.ResourceScope) *extAPI.CustomResourceDefinition {
+	return &extAPI.CustomResourceDefinition{
+		ObjectMeta: metaV1.ObjectMeta{Name: plural + ".cert-manager.io"},
+		Spec: extAPI.CustomResourceDefinitionSpec{
+			Group: "cert-manager.io",
+			Names: extAPI.CustomResourceDefinitionNames{Kind: kind, ListKind: kind + "List", Plural: plural},
+			Scope: scope,
+			Versions: []extAPI.CustomResourceDefinitionVersion{{
+				Name:    "v1",
+				Served:  true,
+				Storage: true,
+				Schema: &extAPI.CustomResourceValidation{
+					OpenAPIV3Schema: &extAPI.JSONSchemaProps{
+						Type:                   "object",
+						XPreserveUnknownFields: ptr.To(true),
+					},
+				},
+			}},
+		},
+	}
+}
+
+// TestDoctor_Envtest checks issuer stored in real API server, it is
+// skipped without kubebuilder assets, run it with make test.
+func TestDoctor_Envtest(t *testing.T) {
+	if os.Getenv("KUBEBUILDER_ASSETS") == "" && os.Getenv("TEST_ASSET_KUBE_APISERVER") == "" {
+		t.Skip("kubebuilder assets are not set up")
+	}
+	env := &envtest.Environment{
+		CRDs: []*extAPI.CustomResourceDefinition{
+			newIssuerCRD("Issuer", "issuers", extAPI.NamespaceScoped),
+			newIssuerCRD("ClusterIssuer", "clusterissuers", extAPI.ClusterScoped),
+		},
+	}
+	cfg, err := env.Start()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = env.Stop() })
+	client, err := kubernetes.NewForConfig(cfg)
+	require.NoError(t, err)
+	dynamicClient, err := dynamic.NewForConfig(cfg)
+	require.NoError(t, err)
+
+	server := fakeselectel.NewServer()
+	t.Cleanup(server.Close)
+	zoneID := server.AddZone("example.com.")
+	for _, namespace := range []string{testNamespace, defaultClusterResourceNamespace} {
+		_, err = client.CoreV1().Namespaces().Create(t.Context(),
+			&coreV1.Namespace{ObjectMeta: metaV1.ObjectMeta{Name: namespace}}, metaV1.CreateOptions{})
+		require.NoError(t, err)
+		_, err = client.CoreV1().Secrets(namespace).Create(t.Context(), newTestSecret(namespace), metaV1.CreateOptions{})
+		require.NoError(t, err)
+	}
+	_, err = dynamicClient.Resource(issuersResource).Namespace(testNamespace).Create(t.Context(),
+		newTestIssuer("Issuer", testNamespace, "selectel", newTestSolverConfigMap(server)), metaV1.CreateOptions{})
+	require.NoError(t, err)
+	_, err = dynamicClient.Resource(clusterIssuersResource).Create(t.Context(),
+		newTestIssuer("ClusterIssuer", "", "selectel", newTestSolverConfigMap(server)), metaV1.CreateOptions{})
+	require.NoError(t, err)
+
+	d := newTestDoctor(client, dynamicClient)
+	for _, ref := range []issuerRef{
+		{kind: kindIssuer, namespace: testNamespace, name: "selectel"},
+		{kind: kindClusterIssuer, name: "selectel"},
+	} {
+		results := d.run(t.Context(), ref, "example.com")
+		for _, result := range results {
+			assert.Equal(t, checkPass, result.Status, result)
+		}
+	}
+	assert.Empty(t, server.RRSets(zoneID))
+}
@@ -0,0 +1,148 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// Env of certbot manual hooks.
+const (
+	certbotDomainEnvVar     = "CERTBOT_DOMAIN"
+	certbotValidationEnvVar = "CERTBOT_VALIDATION"
+)
+
+var errCertbotEnvNotSetup = errors.New("setup " + certbotDomainEnvVar + " and " + certbotValidationEnvVar + " env")
+
+// hookOptions are flags of hooks presenting records.
+type hookOptions struct {
+	// wait after record is presented, e.g. for propagation to nameservers.
+	wait time.Duration
+}
+
+func newHookCommand(opts *options) *cobra.Command {
+	command := &cobra.Command{
+		Use:   "hook",
+		Short: "Hooks of certbot and acme.sh with zone detected from fqdn",
+		Long: `Hooks of certbot and acme.sh with zone detected from fqdn.
+
+certbot:
+  certbot certonly --manual --preferred-challenges dns \
+    --manual-auth-hook "webhook selectel-dns hook auth" \
+    --manual-cleanup-hook "webhook selectel-dns hook cleanup"
+
+acme.sh calls dns_selectel_dns_add and dns_selectel_dns_rm functions of
+scripts/acme.sh/dns_selectel_dns.sh with fqdn and value, they run "hook add" and "hook rm":
+  acme.sh --issue --dns dns_selectel_dns -d example.com`,
+	}
+	hookOpts := &hookOptions{}
+	auth := &cobra.Command{
+		Use:   "auth",
+		Short: "Present record of certbot challenge from CERTBOT_DOMAIN and CERTBOT_VALIDATION env",
+		Args:  cobra.NoArgs,
+		RunE: func(command *cobra.Command, _ []string) error {
+			fqdn, value, err := certbotChallenge()
+			if err != nil {
+				return err
+			}
+
+			return opts.hook(command, hookOpts, fqdn, value, true)
+		},
+	}
+	cleanUp := &cobra.Command{
+		Use:   "cleanup",
+		Short: "Clean up record of certbot challenge from CERTBOT_DOMAIN and CERTBOT_VALIDATION env",
+		Args:  cobra.NoArgs,
+		RunE: func(command *cobra.Command, _ []string) error {
+			fqdn, value, err := certbotChallenge()
+			if err != nil {
+				return err
+			}
+
+			return opts.hook(command, hookOpts, fqdn, value, false)
+		},
+	}
+	add := &cobra.Command{
+		Use:   "add <fqdn> <value>",
+		Short: "Present record of acme.sh challenge, run by dns_selectel_dns_add",
+		Args:  cobra.ExactArgs(2), //nolint: mnd
+		RunE: func(command *cobra.Command, args []string) error {
+			return opts.hook(command, hookOpts, fqdnOf(args[0]), args[1], true)
+		},
+	}
+	remove := &cobra.Command{
+		Use:   "rm <fqdn> <value>",
+		Short: "Clean up record of acme.sh challenge, run by dns_selectel_dns_rm",
+		Args:  cobra.ExactArgs(2), //nolint: mnd
+		RunE: func(command *cobra.Command, args []string) error {
+			return opts.hook(command, hookOpts, fqdnOf(args[0]), args[1], false)
+		},
+	}
+	for _, presentCommand := range []*cobra.Command{auth, add} {
+		presentCommand.Flags().DurationVar(&hookOpts.wait, "wait", 0,
+			"time to wait after record is presented, e.g. 30s for propagation to nameservers")
+	}
+	command.AddCommand(auth, cleanUp, add, remove)
+
+	return command
+}
+
+// certbotChallenge returns fqdn and value of challenge from env of certbot hook,
+// domain of wildcard certificate is passed without "*.".
+func certbotChallenge() (string, string, error) {
+	domain, value := os.Getenv(certbotDomainEnvVar), os.Getenv(certbotValidationEnvVar)
+	if domain == "" || value == "" {
+		return "", "", errCertbotEnvNotSetup
+	}
+
+	return fqdnOf(challengePrefix + strings.TrimPrefix(domain, "*.")), value, nil
+}
+
+// hook presents or cleans up record in zone detected from fqdn.
+func (o *options) hook(command *cobra.Command, hookOpts *hookOptions, fqdn, value string, present bool) error {
+	ctx := command.Context()
+	provider, err := o.provider(ctx)
+	if err != nil {
+		return err
+	}
+	zone, err := provider.FindZone(ctx, fqdn)
+	if err != nil {
+		return err //nolint: wrapcheck
+	}
+	result := &challengeResult{Zone: zone.Name, FQDN: fqdn, Value: value}
+	if present {
+		record, err := provider.PresentRecord(zone.Name, fqdn, value)
+		if err != nil {
+			return err //nolint: wrapcheck
+		}
+		result.Action, result.ZoneID, result.RRSetID = "presented", record.ZoneID, record.RRSetID
+		if err = sleep(ctx, hookOpts.wait); err != nil {
+			return err
+		}
+	} else {
+		if err = provider.CleanUp(zone.Name, fqdn, value); err != nil {
+			return err //nolint: wrapcheck
+		}
+		result.Action = "cleaned up"
+	}
+
+	return o.print(command, result, result.printText)
+}
+
+func sleep(ctx context.Context, duration time.Duration) error {
+	if duration <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err() //nolint: wrapcheck
+	case <-timer.C:
+		return nil
+	}
+}
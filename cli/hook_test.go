@@ -0,0 +1,62 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/selectel/cert-manager-webhook-selectel/internal/fakeselectel"
+	domainsV2 "github.com/selectel/domains-go/pkg/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHook_Certbot(t *testing.T) {
+	server := fakeselectel.NewServer()
+	t.Cleanup(server.Close)
+	zoneID := server.AddZone("example.com.")
+	t.Setenv(certbotDomainEnvVar, "*.www.example.com")
+	t.Setenv(certbotValidationEnvVar, "value")
+
+	stdout, stderr, code := runCommand(t, server, "hook", "auth")
+	require.Equal(t, 0, code, stderr)
+	assert.Contains(t, stdout, `presented "value" in _acme-challenge.www.example.com. of zone example.com.`)
+	rrsets := server.RRSets(zoneID)
+	require.Len(t, rrsets, 1)
+	assert.Equal(t, "_acme-challenge.www.example.com.", rrsets[0].Name)
+	assert.Equal(t, []domainsV2.RecordItem{{Content: `"value"`}}, rrsets[0].Records)
+
+	_, stderr, code = runCommand(t, server, "hook", "cleanup")
+	require.Equal(t, 0, code, stderr)
+	assert.Empty(t, server.RRSets(zoneID))
+
+	t.Setenv(certbotValidationEnvVar, "")
+	_, stderr, code = runCommand(t, server, "hook", "auth")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "setup CERTBOT_DOMAIN and CERTBOT_VALIDATION env")
+}
+
+func TestHook_AcmeSh(t *testing.T) {
+	t.Parallel()
+	server := fakeselectel.NewServer()
+	t.Cleanup(server.Close)
+	server.AddZone("www.example.com.au.")
+	zoneID := server.AddZone("example.com.")
+	fqdn := "_acme-challenge.www.example.com"
+
+	_, stderr, code := runCommand(t, server, "hook", "add", fqdn, "first")
+	require.Equal(t, 0, code, stderr)
+	_, stderr, code = runCommand(t, server, "hook", "add", fqdn, "second", "--wait", "1ms")
+	require.Equal(t, 0, code, stderr)
+	rrsets := server.RRSets(zoneID)
+	require.Len(t, rrsets, 1)
+	assert.Equal(t, []domainsV2.RecordItem{{Content: `"first"`}, {Content: `"second"`}}, rrsets[0].Records)
+
+	_, stderr, code = runCommand(t, server, "hook", "rm", fqdn, "first")
+	require.Equal(t, 0, code, stderr)
+	rrsets = server.RRSets(zoneID)
+	require.Len(t, rrsets, 1)
+	assert.Equal(t, []domainsV2.RecordItem{{Content: `"second"`}}, rrsets[0].Records)
+
+	_, stderr, code = runCommand(t, server, "hook", "add", "_acme-challenge.example.org", "value")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "zone not found")
+}
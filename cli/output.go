@@ -0,0 +1,27 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+// print writes value as json or as text written by printText.
+func (o *options) print(command *cobra.Command, value any, printText func(w io.Writer)) error {
+	if o.output == outputJSON {
+		encoder := json.NewEncoder(command.OutOrStdout())
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(value); err != nil {
+			return fmt.Errorf("encode output: %w", err)
+		}
+
+		return nil
+	}
+	writer := tabwriter.NewWriter(command.OutOrStdout(), 0, 0, 2, ' ', 0) //nolint: mnd
+	printText(writer)
+
+	return writer.Flush() //nolint: wrapcheck
+}
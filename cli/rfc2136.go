@@ -0,0 +1,48 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/selectel/cert-manager-webhook-selectel/rfc2136"
+	"github.com/spf13/cobra"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+const defaultRFC2136Addr = ":53"
+
+func newRFC2136Command(opts *options) *cobra.Command {
+	var addr, configFile string
+	command := &cobra.Command{
+		Use:   "rfc2136",
+		Short: "Serve DNS UPDATE (RFC 2136) of TXT records signed with TSIG",
+		Long: `Serve DNS UPDATE (RFC 2136) of TXT records signed with TSIG, e.g. of nsupdate,
+external-dns rfc2136 provider or rfc2136 solver of cert-manager.
+Records are added and deleted with the same provider as webhook until the command is interrupted.`,
+		Args: cobra.NoArgs,
+		RunE: func(command *cobra.Command, _ []string) error {
+			data, err := os.ReadFile(configFile)
+			if err != nil {
+				return fmt.Errorf("read rfc2136 config: %w", err)
+			}
+			config, err := rfc2136.ParseConfig(data)
+			if err != nil {
+				return err //nolint: wrapcheck
+			}
+			provider, err := opts.provider(command.Context())
+			if err != nil {
+				return err
+			}
+			logf.SetLogger(zap.New())
+			logf.Log.WithName("rfc2136").Info("serving dns updates", "addr", addr, "zones", len(config.Zones))
+
+			return rfc2136.NewServer(provider, config).ListenAndServe(command.Context(), addr) //nolint: wrapcheck
+		},
+	}
+	command.Flags().StringVar(&addr, "listen", defaultRFC2136Addr, "udp and tcp address of dns server")
+	command.Flags().StringVar(&configFile, "rfc2136-config", "", "file with tsig keys and zones in json or yaml")
+	_ = command.MarkFlagRequired("rfc2136-config")
+
+	return command
+}
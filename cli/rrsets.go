@@ -0,0 +1,55 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/spf13/cobra"
+)
+
+func newRRSetsCommand(opts *options) *cobra.Command {
+	command := &cobra.Command{
+		Use:   "rrsets",
+		Short: "TXT RRSets of challenges",
+	}
+	var zoneName string
+	get := &cobra.Command{
+		Use:   "get <fqdn>",
+		Short: "Show TXT RRSet, zone is detected unless --zone is set",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(command *cobra.Command, args []string) error {
+			ctx := command.Context()
+			provider, err := opts.provider(ctx)
+			if err != nil {
+				return err
+			}
+			fqdn := fqdnOf(args[0])
+			if zoneName == "" {
+				zone, err := provider.FindZone(ctx, fqdn)
+				if err != nil {
+					return err //nolint: wrapcheck
+				}
+				zoneName = zone.Name
+			}
+			_, rrset, err := provider.GetRRSet(ctx, fqdnOf(zoneName), fqdn)
+			if err != nil {
+				return err //nolint: wrapcheck
+			}
+
+			return opts.print(command, rrset, func(w io.Writer) {
+				fmt.Fprintf(w, "Name:\t%s\n", rrset.Name)
+				fmt.Fprintf(w, "ID:\t%s\n", rrset.ID)
+				fmt.Fprintf(w, "Zone ID:\t%s\n", rrset.ZoneID)
+				fmt.Fprintf(w, "TTL:\t%d\n", rrset.TTL)
+				fmt.Fprintf(w, "Comment:\t%s\n", rrset.Comment)
+				for _, record := range rrset.Records {
+					fmt.Fprintf(w, "Record:\t%s\n", record.Content)
+				}
+			})
+		},
+	}
+	get.Flags().StringVar(&zoneName, "zone", "", "zone of RRSet")
+	command.AddCommand(get)
+
+	return command
+}
@@ -0,0 +1,39 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/spf13/cobra"
+)
+
+func newZonesCommand(opts *options) *cobra.Command {
+	command := &cobra.Command{
+		Use:   "zones",
+		Short: "Zones of credentials",
+	}
+	command.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List zones of all projects of credentials",
+		Args:  cobra.NoArgs,
+		RunE: func(command *cobra.Command, _ []string) error {
+			provider, err := opts.provider(command.Context())
+			if err != nil {
+				return err
+			}
+			zones, err := provider.ListZones(command.Context())
+			if err != nil {
+				return err //nolint: wrapcheck
+			}
+
+			return opts.print(command, zones, func(w io.Writer) {
+				fmt.Fprintln(w, "NAME\tID\tPROJECT\tDISABLED")
+				for _, zone := range zones {
+					fmt.Fprintf(w, "%s\t%s\t%s\t%t\n", zone.Name, zone.ID, zone.ProjectID, zone.Disabled)
+				}
+			})
+		},
+	})
+
+	return command
+}
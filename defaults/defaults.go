@@ -0,0 +1,208 @@
+// Package defaults loads webhook-wide defaults of solver config from a file,
+// usually mounted from ConfigMap, and reloads them when the file is changed.
+package defaults
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/selectel/cert-manager-webhook-selectel/selectel"
+	coreV1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+var (
+	errInvalidLimits    = errors.New("apiLimits must be non-negative")
+	errInvalidSecretRef = errors.New("dnsSecretRef must have name and namespace")
+	// ErrSecretNamespace is returned for challenge not allowed to use dnsSecretRef.
+	ErrSecretNamespace = errors.New("namespace is not allowed to use dnsSecretRef of defaults")
+	errEmptySolverName = errors.New("name of solver must not be empty")
+)
+
+// Defaults are layered under solver config of issuers.
+type Defaults struct {
+	// Config is solver config without references, e.g. baseUrl, ttl, httpTimeout and maxRetries.
+	Config json.RawMessage `json:"config,omitempty"`
+	// APILimits override limits of requests to Domains API set by env.
+	APILimits *Limits `json:"apiLimits,omitempty"`
+	// DNSSecretRef is Secret with credentials used by issuers without dnsSecretRef.
+	DNSSecretRef *coreV1.SecretReference `json:"dnsSecretRef,omitempty"`
+	// AllowedNamespaces of Issuers allowed to use DNSSecretRef, "*" allows any namespace.
+	// ClusterIssuers and Issuers in namespace of DNSSecretRef are always allowed.
+	AllowedNamespaces []string `json:"allowedNamespaces,omitempty"`
+	// Solvers are named solvers registered besides the default one, their
+	// defaults are layered over the fields above.
+	Solvers map[string]Solver `json:"solvers,omitempty"`
+
+	// parent is set in defaults of named solver, its config is applied first.
+	parent *Defaults
+}
+
+// Solver is defaults of a named solver, issuers pick it by solverName.
+type Solver struct {
+	Config       json.RawMessage         `json:"config,omitempty"`
+	APILimits    *Limits                 `json:"apiLimits,omitempty"`
+	DNSSecretRef *coreV1.SecretReference `json:"dnsSecretRef,omitempty"`
+	// AllowedNamespaces override ones of webhook-wide defaults if set.
+	AllowedNamespaces []string `json:"allowedNamespaces,omitempty"`
+	// PolicyConfigMap is namespace-to-domain policy of solver as "namespace/name"
+	// or "name" in the namespace of webhook, the webhook-wide policy is used if empty.
+	PolicyConfigMap string `json:"policyConfigMap,omitempty"`
+}
+
+// Limits of requests to Domains API per Selectel account.
+type Limits struct {
+	Rate        float64 `json:"rate"`
+	Burst       int     `json:"burst"`
+	MaxInFlight int     `json:"maxInFlight"`
+}
+
+// Parse decodes defaults from yaml or json strictly and validates them.
+func Parse(data []byte) (*Defaults, error) {
+	defaults := &Defaults{}
+	if err := yaml.UnmarshalStrict(data, defaults); err != nil {
+		return nil, fmt.Errorf("unmarshal defaults: %w", err)
+	}
+	if err := defaults.validate(); err != nil {
+		return nil, err
+	}
+	for name := range defaults.Solvers {
+		if name == "" {
+			return nil, errEmptySolverName
+		}
+		if err := defaults.ForSolver(name).validate(); err != nil {
+			return nil, fmt.Errorf("solver %s: %w", name, err)
+		}
+	}
+
+	return defaults, nil
+}
+
+func (d *Defaults) validate() error {
+	config, err := selectel.NewConfigForDNS()
+	if err != nil {
+		return fmt.Errorf("setup selectel config: %w", err)
+	}
+	if err = d.Apply(config); err != nil {
+		return err
+	}
+	if err = config.Validate(); err != nil {
+		return fmt.Errorf("validate config: %w", err)
+	}
+	if limits := d.APILimits; limits != nil && (limits.Rate < 0 || limits.Burst < 0 || limits.MaxInFlight < 0) {
+		return errInvalidLimits
+	}
+	if ref := d.DNSSecretRef; ref != nil && (ref.Name == "" || ref.Namespace == "") {
+		return errInvalidSecretRef
+	}
+
+	return nil
+}
+
+// Load reads defaults from file.
+func Load(path string) (*Defaults, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read defaults: %w", err)
+	}
+
+	return Parse(data)
+}
+
+// Apply decodes Config over config, only fields of selectel.Config are allowed.
+func (d *Defaults) Apply(config *selectel.Config) error {
+	if d == nil {
+		return nil
+	}
+	if err := d.parent.Apply(config); err != nil {
+		return err
+	}
+	if len(d.Config) == 0 {
+		return nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(d.Config))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(config); err != nil {
+		return fmt.Errorf("decode config of defaults: %w", err)
+	}
+
+	return nil
+}
+
+// Limits returns APILimits or limits if they are not set.
+func (d *Defaults) Limits(limits selectel.Limits) selectel.Limits {
+	if d == nil || d.APILimits == nil {
+		return limits
+	}
+
+	return selectel.Limits{
+		Rate:        d.APILimits.Rate,
+		Burst:       d.APILimits.Burst,
+		MaxInFlight: d.APILimits.MaxInFlight,
+	}
+}
+
+// ForSolver returns defaults of named solver layered over d, d is returned
+// for the default solver and unknown names.
+func (d *Defaults) ForSolver(name string) *Defaults {
+	if d == nil {
+		return nil
+	}
+	solver, ok := d.Solvers[name]
+	if !ok {
+		return d
+	}
+	defaults := &Defaults{
+		Config:            solver.Config,
+		APILimits:         d.APILimits,
+		DNSSecretRef:      d.DNSSecretRef,
+		AllowedNamespaces: d.AllowedNamespaces,
+		parent:            d,
+	}
+	if solver.APILimits != nil {
+		defaults.APILimits = solver.APILimits
+	}
+	if solver.DNSSecretRef != nil {
+		defaults.DNSSecretRef = solver.DNSSecretRef
+	}
+	if solver.AllowedNamespaces != nil {
+		defaults.AllowedNamespaces = solver.AllowedNamespaces
+	}
+
+	return defaults
+}
+
+// CheckSecretNamespace returns ErrSecretNamespace if challenge in namespace
+// isn't allowed to use DNSSecretRef, otherwise any namespaced Issuer without
+// dnsSecretRef could use credentials of another namespace. Challenges of
+// ClusterIssuers are in clusterResourceNamespace.
+func (d *Defaults) CheckSecretNamespace(namespace, clusterResourceNamespace string) error {
+	if namespace == clusterResourceNamespace || namespace == d.DNSSecretRef.Namespace {
+		return nil
+	}
+	for _, allowed := range d.AllowedNamespaces {
+		if allowed == "*" || allowed == namespace {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %s", ErrSecretNamespace, namespace)
+}
+
+// SolverNames returns sorted names of solvers.
+func (d *Defaults) SolverNames() []string {
+	if d == nil {
+		return nil
+	}
+	names := make([]string, 0, len(d.Solvers))
+	for name := range d.Solvers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,129 @@
+package defaults
+
+import (
+	"testing"
+
+	"github.com/selectel/cert-manager-webhook-selectel/selectel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testDefaults = `
+config:
+  baseUrl: https://api.example.com/domains/v2
+  ttl: 300
+  httpTimeout: 20
+  maxRetries: 5
+apiLimits:
+  rate: 5
+  burst: 2
+  maxInFlight: 3
+dnsSecretRef:
+  name: selectel-dns-credentials
+  namespace: cert-manager
+`
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+	defaults, err := Parse([]byte(testDefaults))
+	require.NoError(t, err)
+
+	config, err := selectel.NewConfigForDNS()
+	require.NoError(t, err)
+	require.NoError(t, defaults.Apply(config))
+	assert.Equal(t, "https://api.example.com/domains/v2", config.BaseURL)
+	assert.Equal(t, 300, config.TTL)
+	assert.Equal(t, 20, config.HTTPTimeout)
+	assert.Equal(t, 5, config.MaxRetries)
+	assert.Equal(t, selectel.Limits{Rate: 5, Burst: 2, MaxInFlight: 3}, defaults.Limits(selectel.DefaultLimits()))
+	assert.Equal(t, "cert-manager", defaults.DNSSecretRef.Namespace)
+
+	var empty *Defaults
+	require.NoError(t, empty.Apply(config))
+	assert.Equal(t, selectel.DefaultLimits(), empty.Limits(selectel.DefaultLimits()))
+}
+
+func TestParse_Invalid(t *testing.T) {
+	t.Parallel()
+	testCases := map[string]string{
+		"unknown field":            "ttl: 300",
+		"reference in config":      "config: {dnsSecretRef: {name: selectel}}",
+		"invalid config":           "config: {ttl: 1}",
+		"negative limits":          "apiLimits: {rate: -1}",
+		"secret without namespace": "dnsSecretRef: {name: selectel}",
+		"invalid solver config":    "solvers: {selectel-prod: {config: {ttl: 1}}}",
+		"unknown solver field":     "solvers: {selectel-prod: {ttl: 300}}",
+	}
+	for name, data := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			_, err := Parse([]byte(data))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestDefaults_ForSolver(t *testing.T) {
+	t.Parallel()
+	defaults, err := Parse([]byte(testDefaults + `
+solvers:
+  selectel-staging:
+    config:
+      baseUrl: https://staging.example.com/domains/v2
+    apiLimits:
+      rate: 1
+      burst: 1
+      maxInFlight: 1
+    dnsSecretRef:
+      name: selectel-staging-credentials
+      namespace: staging
+    allowedNamespaces: [staging-apps]
+    policyConfigMap: staging/selectel-policy
+  selectel-prod: {}
+`))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"selectel-prod", "selectel-staging"}, defaults.SolverNames())
+	assert.Equal(t, "staging/selectel-policy", defaults.Solvers["selectel-staging"].PolicyConfigMap)
+
+	staging := defaults.ForSolver("selectel-staging")
+	config, err := selectel.NewConfigForDNS()
+	require.NoError(t, err)
+	require.NoError(t, staging.Apply(config))
+	assert.Equal(t, "https://staging.example.com/domains/v2", config.BaseURL)
+	assert.Equal(t, 300, config.TTL, "config of solver is layered over webhook-wide config")
+	assert.Equal(t, selectel.Limits{Rate: 1, Burst: 1, MaxInFlight: 1}, staging.Limits(selectel.DefaultLimits()))
+	assert.Equal(t, "selectel-staging-credentials", staging.DNSSecretRef.Name)
+	assert.Equal(t, []string{"staging-apps"}, staging.AllowedNamespaces)
+
+	prod := defaults.ForSolver("selectel-prod")
+	assert.Equal(t, selectel.Limits{Rate: 5, Burst: 2, MaxInFlight: 3}, prod.Limits(selectel.DefaultLimits()))
+	assert.Equal(t, "selectel-dns-credentials", prod.DNSSecretRef.Name)
+
+	assert.Same(t, defaults, defaults.ForSolver("selectel"))
+	var empty *Defaults
+	assert.Nil(t, empty.ForSolver("selectel-prod"))
+}
+
+func TestDefaults_CheckSecretNamespace(t *testing.T) {
+	t.Parallel()
+	defaults, err := Parse([]byte(testDefaults + `
+allowedNamespaces: [team-a]
+solvers:
+  selectel-any:
+    allowedNamespaces: ["*"]
+`))
+	require.NoError(t, err)
+	const clusterResourceNamespace = "cert-manager-resources"
+
+	// ClusterIssuer, Issuer in namespace of the Secret and allowed one
+	require.NoError(t, defaults.CheckSecretNamespace(clusterResourceNamespace, clusterResourceNamespace))
+	require.NoError(t, defaults.CheckSecretNamespace("cert-manager", clusterResourceNamespace))
+	require.NoError(t, defaults.CheckSecretNamespace("team-a", clusterResourceNamespace))
+
+	// namespaced Issuer without dnsSecretRef can't use credentials of another namespace
+	err = defaults.CheckSecretNamespace("team-b", clusterResourceNamespace)
+	require.ErrorIs(t, err, ErrSecretNamespace)
+	assert.Equal(t, "namespace is not allowed to use dnsSecretRef of defaults: team-b", err.Error())
+
+	require.NoError(t, defaults.ForSolver("selectel-any").CheckSecretNamespace("team-b", clusterResourceNamespace))
+}
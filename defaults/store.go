@@ -0,0 +1,168 @@
+package defaults
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	"github.com/fsnotify/fsnotify"
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var (
+	reloadsTotal = metrics.NewCounterVec(&metrics.CounterOpts{
+		Subsystem:      "selectel_webhook",
+		Name:           "defaults_reloads_total",
+		Help:           "Reloads of webhook defaults file by result: success or rejected.",
+		StabilityLevel: metrics.ALPHA,
+	}, []string{"result"})
+
+	registerMetrics sync.Once
+)
+
+// RegisterMetrics registers metrics of defaults reloads in the registry served by webhook.
+func RegisterMetrics() {
+	registerMetrics.Do(func() {
+		legacyregistry.MustRegister(reloadsTotal)
+	})
+}
+
+// Store keeps defaults from file, they are replaced atomically on every valid
+// change of the file. Invalid change is rejected and the last valid defaults stay in use.
+type Store struct {
+	path    string
+	current atomic.Pointer[Defaults]
+	// data is content of the last read file, reload is skipped if it is the same.
+	data []byte
+}
+
+// NewStore loads defaults from file, the file must be valid on start.
+func NewStore(path string) (*Store, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read defaults: %w", err)
+	}
+	defaults, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	store := &Store{path: path, data: data}
+	store.current.Store(defaults)
+
+	return store, nil
+}
+
+// Get returns the last valid defaults.
+func (s *Store) Get() *Defaults {
+	return s.current.Load()
+}
+
+// Watch reloads defaults on changes of file until stopCh is closed. Directory
+// of the file is watched, ConfigMap volumes replace files with symlink swap.
+func (s *Store) Watch(stopCh <-chan struct{}) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("create watcher of defaults: %w", err)
+	}
+	if err = watcher.Add(filepath.Dir(s.path)); err != nil {
+		watcher.Close()
+
+		return fmt.Errorf("watch defaults: %w", err)
+	}
+	go func() {
+		defer watcher.Close()
+		for {
+			select {
+			case <-stopCh:
+				return
+			case _, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				s.reload()
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				logf.Log.WithName("defaults").Error(err, "watch defaults", "path", s.path)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// reload replaces defaults if file is changed and valid. Events are handled
+// by a single goroutine, so data isn't guarded.
+func (s *Store) reload() {
+	log := logf.Log.WithName("defaults").WithValues("path", s.path)
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		// file is missing for a moment while it is replaced
+		log.V(1).Info("defaults are not read", "error", err.Error())
+
+		return
+	}
+	if bytes.Equal(data, s.data) {
+		return
+	}
+	s.data = data
+	defaults, err := Parse(data)
+	if err != nil {
+		log.Error(err, "invalid defaults are rejected, the last valid defaults stay in use")
+		reloadsTotal.WithLabelValues("rejected").Inc()
+
+		return
+	}
+	previous := s.Get()
+	removed := keepRemovedSolvers(previous, defaults)
+	s.current.Store(defaults)
+	log.Info("defaults are reloaded")
+	if len(removed) > 0 {
+		log.Info("removed solvers keep their last defaults until restart of webhook", "solvers", removed)
+	}
+	if solversChanged(previous, defaults) {
+		// solvers are registered and their policies are watched on start
+		log.Info("solvers or their policyConfigMap are changed, they are applied on restart of webhook")
+	}
+	reloadsTotal.WithLabelValues("success").Inc()
+}
+
+// keepRemovedSolvers copies solvers missing in current from previous and returns
+// their names. Removed solvers are still registered, so they keep their defaults
+// instead of falling back to webhook-wide ones, e.g. another dnsSecretRef.
+func keepRemovedSolvers(previous, current *Defaults) []string {
+	removed := []string{}
+	for _, name := range previous.SolverNames() {
+		if _, ok := current.Solvers[name]; ok {
+			continue
+		}
+		if current.Solvers == nil {
+			current.Solvers = map[string]Solver{}
+		}
+		current.Solvers[name] = previous.Solvers[name]
+		removed = append(removed, name)
+	}
+
+	return removed
+}
+
+// solversChanged reports whether names of solvers or their policies differ.
+func solversChanged(previous, current *Defaults) bool {
+	if len(previous.Solvers) != len(current.Solvers) {
+		return true
+	}
+	for name, solver := range current.Solvers {
+		previousSolver, ok := previous.Solvers[name]
+		if !ok || previousSolver.PolicyConfigMap != solver.PolicyConfigMap {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,101 @@
+package defaults
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/component-base/metrics/testutil"
+)
+
+func requireEventually(t *testing.T, condition func() bool) {
+	t.Helper()
+	require.Eventually(t, condition, 5*time.Second, 10*time.Millisecond)
+}
+
+// writeConfigMapFile writes file like kubelet updates ConfigMap volume:
+// data directory is swapped with symlink.
+func writeConfigMapFile(t *testing.T, dir, data string) {
+	t.Helper()
+	dataDir, err := os.MkdirTemp(dir, "..data_")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dataDir, "defaults.yaml"), []byte(data), 0o600))
+	link := filepath.Join(dir, "..data_tmp")
+	require.NoError(t, os.Symlink(filepath.Base(dataDir), link))
+	require.NoError(t, os.Rename(link, filepath.Join(dir, "..data")))
+}
+
+func TestStore_Reload(t *testing.T) {
+	t.Parallel()
+	RegisterMetrics()
+	dir := t.TempDir()
+	writeConfigMapFile(t, dir, "config: {ttl: 120}")
+	path := filepath.Join(dir, "defaults.yaml")
+	require.NoError(t, os.Symlink(filepath.Join("..data", "defaults.yaml"), path))
+	store, err := NewStore(path)
+	require.NoError(t, err)
+	stopCh := make(chan struct{})
+	t.Cleanup(func() { close(stopCh) })
+	require.NoError(t, store.Watch(stopCh))
+	assert.JSONEq(t, `{"ttl":120}`, string(store.Get().Config))
+	rejected, err := testutil.GetCounterMetricValue(reloadsTotal.WithLabelValues("rejected"))
+	require.NoError(t, err)
+
+	writeConfigMapFile(t, dir, "config: {ttl: 300}")
+	requireEventually(t, func() bool {
+		return string(store.Get().Config) == `{"ttl":300}`
+	})
+
+	// invalid defaults are rejected and valid ones stay in use
+	writeConfigMapFile(t, dir, "config: {ttl: 1}")
+	requireEventually(t, func() bool {
+		value, err := testutil.GetCounterMetricValue(reloadsTotal.WithLabelValues("rejected"))
+
+		return err == nil && value == rejected+1
+	})
+	assert.JSONEq(t, `{"ttl":300}`, string(store.Get().Config))
+}
+
+func TestStore_ReloadKeepsRemovedSolvers(t *testing.T) {
+	t.Parallel()
+	RegisterMetrics()
+	dir := t.TempDir()
+	writeConfigMapFile(t, dir, `
+dnsSecretRef: {name: selectel-dns-credentials, namespace: cert-manager}
+solvers:
+  selectel-staging:
+    dnsSecretRef: {name: selectel-staging-credentials, namespace: staging}
+`)
+	path := filepath.Join(dir, "defaults.yaml")
+	require.NoError(t, os.Symlink(filepath.Join("..data", "defaults.yaml"), path))
+	store, err := NewStore(path)
+	require.NoError(t, err)
+	stopCh := make(chan struct{})
+	t.Cleanup(func() { close(stopCh) })
+	require.NoError(t, store.Watch(stopCh))
+
+	writeConfigMapFile(t, dir, `
+config: {ttl: 300}
+dnsSecretRef: {name: selectel-dns-credentials, namespace: cert-manager}
+`)
+	requireEventually(t, func() bool {
+		return string(store.Get().Config) == `{"ttl":300}`
+	})
+	// solver is registered until restart and doesn't fall back to webhook-wide secret
+	assert.Equal(t, []string{"selectel-staging"}, store.Get().SolverNames())
+	assert.Equal(t, "selectel-staging-credentials", store.Get().ForSolver("selectel-staging").DNSSecretRef.Name)
+}
+
+func TestNewStore_Invalid(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "defaults.yaml")
+	_, err := NewStore(path)
+	require.Error(t, err)
+
+	require.NoError(t, os.WriteFile(path, []byte("config: {ttl: 1}"), 0o600))
+	_, err = NewStore(path)
+	assert.Error(t, err)
+}
@@ -46,3 +46,30 @@ Create chart name and version as used by the chart label.
 {{- define "cert-manager-webhook-selectel.servingCertificate" -}}
 {{ printf "%s-webhook-tls" (include "cert-manager-webhook-selectel.fullname" .) }}
 {{- end -}}
+
+{{- define "cert-manager-webhook-selectel.defaultsConfigMap" -}}
+{{- if .Values.defaults.existingConfigMap -}}
+{{ .Values.defaults.existingConfigMap }}
+{{- else -}}
+{{ printf "%s-defaults" (include "cert-manager-webhook-selectel.fullname" .) }}
+{{- end -}}
+{{- end -}}
+
+{{- define "cert-manager-webhook-selectel.policyConfigMap" -}}
+{{- if .Values.policy.existingConfigMap -}}
+{{ .Values.policy.existingConfigMap }}
+{{- else -}}
+{{ printf "%s-policy" (include "cert-manager-webhook-selectel.fullname" .) }}
+{{- end -}}
+{{- end -}}
+
+{{/*
+Non-empty if a named solver of defaults has its own policy ConfigMap.
+*/}}
+{{- define "cert-manager-webhook-selectel.solverPolicies" -}}
+{{- if .Values.defaults.enabled -}}
+{{- range $name, $solver := .Values.defaults.solvers -}}
+{{- if $solver.policyConfigMap -}}true{{- end -}}
+{{- end -}}
+{{- end -}}
+{{- end -}}
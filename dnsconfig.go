@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/selectel/cert-manager-webhook-selectel/dnsconfig"
+	"github.com/selectel/cert-manager-webhook-selectel/selectel"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const dnsConfigStatusTimeout = 10 * time.Second
+
+var (
+	errConfigRefDisabled  = errors.New("configRef is set, but " + dnsConfigsEnabledEnvVar + " is not")
+	errConfigRefOverride  = errors.New("field of SelectelDNSConfig can't be overridden in issuer")
+	errConfigRefNamespace = errors.New("namespace is not allowed to use SelectelDNSConfig")
+)
+
+// configRefProtectedFields can't be overridden by issuer referencing SelectelDNSConfig,
+// otherwise its credentials could be sent to other endpoints or used for other domains,
+// or other credentials of its clouds.yaml could be selected.
+var configRefProtectedFields = []string{
+	"dnsSecretRef", "proxySecretRef", "caBundleRef", "clientCertSecretRef",
+	"baseUrl", "allowInsecureBaseUrl", "authUrl", "allowInsecureAuthUrl", "proxyUrl",
+	"allowedDomains", "deniedDomains", "cloud",
+}
+
+// dnsConfigSpec is part of SelectelDNSConfig spec which is not solver config.
+type dnsConfigSpec struct {
+	// Namespace of Secrets and ConfigMaps referenced by spec.
+	Namespace string `json:"namespace"`
+	// AllowedNamespaces may use Secrets of Namespace, "*" allows any namespace.
+	// Only challenges in Namespace are allowed if empty.
+	AllowedNamespaces []string `json:"allowedNamespaces"`
+}
+
+// mergeDNSConfig decodes spec of SelectelDNSConfig referenced by cfg and inline
+// config over it, so fields set in issuer override the spec.
+func mergeDNSConfig(cfg *selectelDNSProviderConfig, inline []byte, layers configLayers) error {
+	if layers.getConfig == nil {
+		return errConfigRefDisabled
+	}
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(inline, &fields); err != nil {
+		return fmt.Errorf("unmarshal config: %w", err)
+	}
+	for _, field := range configRefProtectedFields {
+		if _, ok := fields[field]; ok {
+			return fmt.Errorf("%w: %s", errConfigRefOverride, field)
+		}
+	}
+	dnsConfig, err := layers.getConfig(context.Background(), cfg.ConfigRef)
+	if err != nil {
+		return fmt.Errorf("resolve configRef: %w", err)
+	}
+	spec := dnsConfigSpec{}
+	if err = json.Unmarshal(dnsConfig.Spec, &spec); err != nil {
+		return fmt.Errorf("unmarshal SelectelDNSConfig %s: %w", dnsConfig.Name, err)
+	}
+	cfgDNS, err := layers.newConfigForDNS()
+	if err != nil {
+		return err
+	}
+	*cfg = selectelDNSProviderConfig{
+		Config:                cfgDNS,
+		refsNamespace:         spec.Namespace,
+		refsAllowedNamespaces: spec.AllowedNamespaces,
+	}
+	if err = json.Unmarshal(dnsConfig.Spec, cfg); err != nil {
+		return fmt.Errorf("unmarshal SelectelDNSConfig %s: %w", dnsConfig.Name, err)
+	}
+	if err = json.Unmarshal(inline, cfg); err != nil {
+		return fmt.Errorf("unmarshal config: %w", err)
+	}
+
+	return nil
+}
+
+// checkRefsNamespace rejects challenge in namespace which isn't allowed to read
+// Secrets in namespace of SelectelDNSConfig, otherwise any namespaced Issuer
+// could use credentials of another namespace.
+func checkRefsNamespace(cfg *selectelDNSProviderConfig, namespace string) error {
+	if cfg.refsNamespace == "" || namespace == cfg.refsNamespace {
+		return nil
+	}
+	for _, allowed := range cfg.refsAllowedNamespaces {
+		if allowed == "*" || allowed == namespace {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w %s: %s", errConfigRefNamespace, cfg.ConfigRef, namespace)
+}
+
+// reportCredentials sets CredentialsValid condition of SelectelDNSConfig referenced
+// by cfg from result of challenge. Failed setup is reported with reason, errors
+// of Selectel API not caused by credentials are not reported.
+func (c *selectelDNSProviderSolver) reportCredentials(cfg *selectelDNSProviderConfig, reason string, err error) {
+	if c.configs == nil || cfg.ConfigRef == "" {
+		return
+	}
+	valid, message := err == nil, ""
+	switch {
+	case err == nil:
+		reason = dnsconfig.ReasonAuthenticated
+	case reason != "":
+		message = err.Error()
+	case errors.Is(err, selectel.ErrUnauthorized), errors.Is(err, selectel.ErrPermissionDenied):
+		reason, message = dnsconfig.ReasonUnauthorized, err.Error()
+	default:
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), dnsConfigStatusTimeout)
+	defer cancel()
+	if err = c.configs.ReportCredentials(ctx, cfg.ConfigRef, valid, reason, message); err != nil {
+		logf.Log.WithName("dnsconfig").Error(err, "status is not updated", "selectelDNSConfig", cfg.ConfigRef)
+	}
+}
@@ -0,0 +1,219 @@
+// Package dnsconfig resolves cluster-scoped SelectelDNSConfig resources referenced
+// by solver config of issuers with configRef and reports on them whether their
+// credentials were last seen valid.
+package dnsconfig
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// ConditionCredentialsValid reports whether credentials of config were valid
+	// on the last challenge of issuers referencing it.
+	ConditionCredentialsValid = "CredentialsValid"
+
+	// Reasons of ConditionCredentialsValid.
+	ReasonAuthenticated = "Authenticated"
+	ReasonUnauthorized  = "Unauthorized"
+	ReasonSetupFailed   = "SetupFailed"
+
+	resyncPeriod = 10 * time.Minute
+)
+
+// Resource is SelectelDNSConfig.
+var Resource = schema.GroupVersionResource{
+	Group:    "dns.selectel.ru",
+	Version:  "v1alpha1",
+	Resource: "selecteldnsconfigs",
+}
+
+var (
+	// ErrNotFound is returned if SelectelDNSConfig doesn't exist.
+	ErrNotFound = errors.New("selectel dns config not found")
+
+	errCacheNotSynced = errors.New("selectel dns config cache is not synced")
+	errInvalidObject  = errors.New("invalid selectel dns config object")
+)
+
+// Config is SelectelDNSConfig.
+type Config struct {
+	Name       string
+	Generation int64
+	// Spec is solver config shared by issuers, inline config of issuer is merged over it.
+	Spec       json.RawMessage
+	Conditions []metaV1.Condition
+}
+
+// GetFunc returns SelectelDNSConfig by name.
+type GetFunc func(ctx context.Context, name string) (*Config, error)
+
+// Get reads SelectelDNSConfig from API server, e.g. in commands without informer.
+func Get(ctx context.Context, client dynamic.Interface, name string) (*Config, error) {
+	object, err := client.Resource(Resource).Get(ctx, name, metaV1.GetOptions{})
+	if err != nil {
+		if apiErrors.IsNotFound(err) {
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+		}
+
+		return nil, fmt.Errorf("get selectel dns config: %w", err)
+	}
+
+	return fromUnstructured(object)
+}
+
+// Store keeps SelectelDNSConfigs in informer cache.
+type Store struct {
+	client dynamic.Interface
+	lister cache.GenericLister
+
+	// status updates are serialized to avoid conflicts between challenges
+	mu sync.Mutex
+}
+
+// NewStore returns store of SelectelDNSConfigs.
+func NewStore(client dynamic.Interface) *Store {
+	return &Store{client: client}
+}
+
+// Run starts watching SelectelDNSConfigs until stopCh is closed and waits
+// for the first list of them.
+func (s *Store) Run(stopCh <-chan struct{}) error {
+	factory := dynamicinformer.NewDynamicSharedInformerFactory(s.client, resyncPeriod)
+	informer := factory.ForResource(Resource)
+	s.lister = informer.Lister()
+	factory.Start(stopCh)
+	for _, synced := range factory.WaitForCacheSync(stopCh) {
+		if !synced {
+			return errCacheNotSynced
+		}
+	}
+
+	return nil
+}
+
+// Get returns SelectelDNSConfig from cache.
+func (s *Store) Get(_ context.Context, name string) (*Config, error) {
+	object, err := s.lister.Get(name)
+	if err != nil {
+		if apiErrors.IsNotFound(err) {
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+		}
+
+		return nil, fmt.Errorf("get selectel dns config from cache: %w", err)
+	}
+	unstructuredObject, ok := object.(*unstructured.Unstructured)
+	if !ok {
+		return nil, fmt.Errorf("%w: %T", errInvalidObject, object)
+	}
+
+	return fromUnstructured(unstructuredObject)
+}
+
+// ReportCredentials sets CredentialsValid condition of SelectelDNSConfig,
+// status is updated only if the condition in cache is changed.
+func (s *Store) ReportCredentials(ctx context.Context, name string, valid bool, reason, message string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cached, err := s.lister.Get(name)
+	if err != nil {
+		return fmt.Errorf("get selectel dns config from cache: %w", err)
+	}
+	cachedObject, ok := cached.(*unstructured.Unstructured)
+	if !ok {
+		return fmt.Errorf("%w: %T", errInvalidObject, cached)
+	}
+	// objects of cache are shared, status is changed in copy
+	object := cachedObject.DeepCopy()
+	config, err := fromUnstructured(object)
+	if err != nil {
+		return err
+	}
+	status := metaV1.ConditionFalse
+	if valid {
+		status = metaV1.ConditionTrue
+	}
+	condition := metaV1.Condition{
+		Type:               ConditionCredentialsValid,
+		Status:             status,
+		ObservedGeneration: config.Generation,
+		Reason:             reason,
+		Message:            message,
+	}
+	if !meta.SetStatusCondition(&config.Conditions, condition) {
+		return nil
+	}
+	conditions, err := toUnstructuredConditions(config.Conditions)
+	if err != nil {
+		return err
+	}
+	if err = unstructured.SetNestedSlice(object.Object, conditions, "status", "conditions"); err != nil {
+		return fmt.Errorf("set conditions: %w", err)
+	}
+	if _, err = s.client.Resource(Resource).UpdateStatus(ctx, object, metaV1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("update status of selectel dns config: %w", err)
+	}
+	logf.Log.WithName("dnsconfig").Info("credentials condition is changed",
+		"selectelDNSConfig", name, "status", status, "reason", reason)
+
+	return nil
+}
+
+func fromUnstructured(object *unstructured.Unstructured) (*Config, error) {
+	config := &Config{Name: object.GetName(), Generation: object.GetGeneration()}
+	spec, found, err := unstructured.NestedMap(object.Object, "spec")
+	if err != nil {
+		return nil, fmt.Errorf("%w: spec: %w", errInvalidObject, err)
+	}
+	if !found {
+		spec = map[string]any{}
+	}
+	if config.Spec, err = json.Marshal(spec); err != nil {
+		return nil, fmt.Errorf("marshal spec: %w", err)
+	}
+	conditions, _, err := unstructured.NestedSlice(object.Object, "status", "conditions")
+	if err != nil {
+		return nil, fmt.Errorf("%w: status: %w", errInvalidObject, err)
+	}
+	for _, item := range conditions {
+		conditionObject, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		condition := metaV1.Condition{}
+		if err = runtime.DefaultUnstructuredConverter.FromUnstructured(conditionObject, &condition); err != nil {
+			return nil, fmt.Errorf("%w: condition: %w", errInvalidObject, err)
+		}
+		config.Conditions = append(config.Conditions, condition)
+	}
+
+	return config, nil
+}
+
+func toUnstructuredConditions(conditions []metaV1.Condition) ([]any, error) {
+	items := make([]any, 0, len(conditions))
+	for i := range conditions {
+		item, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&conditions[i])
+		if err != nil {
+			return nil, fmt.Errorf("convert condition: %w", err)
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
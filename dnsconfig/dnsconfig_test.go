@@ -0,0 +1,107 @@
+package dnsconfig
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicFake "k8s.io/client-go/dynamic/fake"
+)
+
+const testName = "selectel-prod"
+
+func newTestConfig(ttl int64) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": Resource.GroupVersion().String(),
+		"kind":       "SelectelDNSConfig",
+		"metadata":   map[string]any{"name": testName, "generation": int64(2)},
+		"spec": map[string]any{
+			"dnsSecretRef": map[string]any{"name": "selectel-dns-credentials"},
+			"namespace":    "cert-manager",
+			"ttl":          ttl,
+		},
+	}}
+}
+
+func newTestClient(objects ...runtime.Object) *dynamicFake.FakeDynamicClient {
+	return dynamicFake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{Resource: "SelectelDNSConfigList"}, objects...)
+}
+
+func runTestStore(t *testing.T, client *dynamicFake.FakeDynamicClient) *Store {
+	t.Helper()
+	stopCh := make(chan struct{})
+	t.Cleanup(func() { close(stopCh) })
+	store := NewStore(client)
+	require.NoError(t, store.Run(stopCh))
+
+	return store
+}
+
+func TestStore_Get(t *testing.T) {
+	t.Parallel()
+	client := newTestClient(newTestConfig(60))
+	store := runTestStore(t, client)
+
+	config, err := store.Get(t.Context(), testName)
+	require.NoError(t, err)
+	assert.Equal(t, testName, config.Name)
+	assert.Equal(t, int64(2), config.Generation)
+	assert.JSONEq(t, `{"dnsSecretRef":{"name":"selectel-dns-credentials"},"namespace":"cert-manager","ttl":60}`,
+		string(config.Spec))
+
+	_, err = store.Get(t.Context(), "unknown")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	_, err = client.Resource(Resource).Update(t.Context(), newTestConfig(120), metaV1.UpdateOptions{})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		config, err = store.Get(t.Context(), testName)
+
+		return err == nil && strings.Contains(string(config.Spec), `"ttl":120`)
+	}, 5*time.Second, 10*time.Millisecond)
+
+	config, err = Get(t.Context(), client, testName)
+	require.NoError(t, err)
+	assert.Equal(t, testName, config.Name)
+	_, err = Get(t.Context(), client, "unknown")
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestStore_ReportCredentials(t *testing.T) {
+	t.Parallel()
+	client := newTestClient(newTestConfig(60))
+	store := runTestStore(t, client)
+
+	require.NoError(t, store.ReportCredentials(t.Context(), testName, false, ReasonUnauthorized, "selectel api error 401"))
+	var config *Config
+	require.Eventually(t, func() bool {
+		var err error
+		config, err = store.Get(t.Context(), testName)
+
+		return err == nil && len(config.Conditions) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	condition := config.Conditions[0]
+	assert.Equal(t, ConditionCredentialsValid, condition.Type)
+	assert.Equal(t, metaV1.ConditionFalse, condition.Status)
+	assert.Equal(t, ReasonUnauthorized, condition.Reason)
+	assert.Equal(t, int64(2), condition.ObservedGeneration)
+
+	// the same condition isn't written again
+	actions := len(client.Actions())
+	require.NoError(t, store.ReportCredentials(t.Context(), testName, false, ReasonUnauthorized, "selectel api error 401"))
+	assert.Len(t, client.Actions(), actions)
+
+	require.NoError(t, store.ReportCredentials(t.Context(), testName, true, ReasonAuthenticated, ""))
+	require.Eventually(t, func() bool {
+		config, err := store.Get(t.Context(), testName)
+
+		return err == nil && len(config.Conditions) == 1 && config.Conditions[0].Status == metaV1.ConditionTrue
+	}, 5*time.Second, 10*time.Millisecond)
+}
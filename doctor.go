@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/selectel/cert-manager-webhook-selectel/cli"
+	"github.com/selectel/cert-manager-webhook-selectel/defaults"
+	"github.com/selectel/cert-manager-webhook-selectel/dnsconfig"
+	"github.com/selectel/cert-manager-webhook-selectel/selectel"
+	extAPI "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// doctorConfig is solver config of issuer checked by selectel-dns doctor.
+type doctorConfig struct {
+	cfg selectelDNSProviderConfig
+}
+
+// loadDoctorConfig decodes config strictly, because loadConfig ignores
+// unknown fields, e.g. misspelled ones, and then loads it like webhook does.
+func loadDoctorConfig(ctx context.Context, client dynamic.Interface, solverName string, cfgJSON *extAPI.JSON) (cli.SolverConfig, error) {
+	strict := selectelDNSProviderConfig{Config: &selectel.Config{}}
+	decoder := json.NewDecoder(bytes.NewReader(cfgJSON.Raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&strict); err != nil {
+		return nil, fmt.Errorf("decode config strictly: %w", err)
+	}
+	// SelectelDNSConfig is read directly, doctor has no informer
+	layers := configLayers{getConfig: func(_ context.Context, name string) (*dnsconfig.Config, error) {
+		return dnsconfig.Get(ctx, client, name)
+	}}
+	if path := os.Getenv(defaultsFileEnvVar); path != "" {
+		fileDefaults, err := defaults.Load(path)
+		if err != nil {
+			return nil, err //nolint: wrapcheck
+		}
+		layers.defaults = fileDefaults.ForSolver(solverName)
+	}
+	cfg, err := loadConfig(cfgJSON, layers)
+	if err != nil {
+		return nil, fmt.Errorf("load config: %w", err)
+	}
+
+	return &doctorConfig{cfg: cfg}, nil
+}
+
+// Setup reads Secrets like Present does.
+func (d *doctorConfig) Setup(_ context.Context, client kubernetes.Interface, namespace string) (*selectel.Config, error) {
+	solver := &selectelDNSProviderSolver{webhookState: &webhookState{client: client}}
+	if err := solver.setupConfig(&d.cfg, namespace); err != nil {
+		return nil, err
+	}
+
+	return d.cfg.Config, nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"github.com/selectel/cert-manager-webhook-selectel/selectel"
+	coreV1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedCoreV1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+const (
+	eventComponent = "cert-manager-webhook-selectel"
+
+	eventReasonPolicyViolation = "PolicyViolation"
+)
+
+// reportFailure sends event of challenge failed by Selectel API with reason
+// of error, e.g. PermissionDenied, to the requesting namespace.
+func (c *selectelDNSProviderSolver) reportFailure(challengeRequest *v1alpha1.ChallengeRequest, err error) {
+	c.recorder.Eventf(namespaceReference(challengeRequest.ResourceNamespace), coreV1.EventTypeWarning,
+		selectel.ErrorReason(err), "%s challenge for %s failed: %v",
+		challengeRequest.Action, challengeRequest.DNSName, err)
+}
+
+// newEventRecorder returns recorder of events, which are sent until stopCh is closed.
+func newEventRecorder(client kubernetes.Interface, stopCh <-chan struct{}) record.EventRecorder {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedCoreV1.EventSinkImpl{Interface: client.CoreV1().Events("")})
+	go func() {
+		<-stopCh
+		broadcaster.Shutdown()
+	}()
+
+	return broadcaster.NewRecorder(scheme.Scheme, coreV1.EventSource{Component: eventComponent})
+}
+
+// namespaceReference refers to namespace requesting challenge, the event
+// is put in the same namespace, so its users can see why challenge fails.
+func namespaceReference(namespace string) *coreV1.ObjectReference {
+	return &coreV1.ObjectReference{
+		APIVersion: "v1",
+		Kind:       "Namespace",
+		Name:       namespace,
+		Namespace:  namespace,
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/selectel/cert-manager-webhook-selectel/selectel"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	healthStatusOK       = "ok"
+	healthStatusDegraded = "degraded"
+
+	healthReadHeaderTimeout = 10 * time.Second
+	healthShutdownTimeout   = 5 * time.Second
+)
+
+// healthResponse reports state of circuit breakers of Selectel API endpoints,
+// webhook is degraded while any circuit is not closed. Status code is always 200,
+// so outage of Selectel API doesn't restart webhook.
+type healthResponse struct {
+	Status   string            `json:"status"`
+	Circuits map[string]string `json:"circuits"`
+}
+
+func healthHandler(w http.ResponseWriter, _ *http.Request) {
+	response := healthResponse{Status: healthStatusOK, Circuits: map[string]string{}}
+	for endpoint, state := range selectel.CircuitStates() {
+		response.Circuits[endpoint] = state.String()
+		if state != selectel.CircuitClosed {
+			response.Status = healthStatusDegraded
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+// runHealthServer serves /healthz on addr until stopCh is closed.
+func runHealthServer(addr string, stopCh <-chan struct{}) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err //nolint: wrapcheck
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", healthHandler)
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: healthReadHeaderTimeout}
+	go func() {
+		err := server.Serve(listener)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logf.Log.WithName("health").Error(err, "serve health endpoint")
+		}
+	}()
+	go func() {
+		<-stopCh
+		ctx, cancel := context.WithTimeout(context.Background(), healthShutdownTimeout)
+		defer cancel()
+		_ = server.Shutdown(ctx)
+	}()
+
+	return nil
+}
@@ -0,0 +1,490 @@
+// Package fakeselectel implements in-memory Keystone and Domains API v2 of Selectel
+// for tests and benchmarks.
+package fakeselectel
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	domainsV2 "github.com/selectel/domains-go/pkg/v2"
+)
+
+const (
+	// Region of endpoints in service catalog.
+	Region = "ru-1"
+
+	authPath           = "/identity/v3/"
+	domainsPath        = "/domains/v2"
+	defaultTokenTTL    = 24 * time.Hour
+	defaultListLimit   = 100
+	headerSubjectToken = "X-Subject-Token"
+	headerAuthToken    = "X-Auth-Token"
+	headerRequestID    = "X-Request-Id"
+)
+
+// Server is a fake of Keystone and Domains API v2 serving over http or https.
+type Server struct {
+	*httptest.Server
+
+	// TokenTTL is lifetime of issued tokens. Default is 24 hours like in Keystone.
+	TokenTTL time.Duration
+
+	mu           sync.Mutex
+	tokens       map[string]token
+	zones        map[string]*domainsV2.Zone
+	zoneProjects map[string]string
+	rrsets       map[string]map[string]*domainsV2.RRSet
+	authRequests int
+	apiRequests  int
+	nextID       int
+	failures     int
+	failStatus   int
+	denied       map[string]bool
+	blocked      map[string]chan struct{}
+}
+
+type token struct {
+	projectID string
+	expiresAt time.Time
+}
+
+// NewServer starts a fake server over http. Caller must close it.
+func NewServer() *Server {
+	return newServer(httptest.NewServer)
+}
+
+// NewTLSServer starts a fake server over https with certificate from CABundle.
+// Caller must close it.
+func NewTLSServer() *Server {
+	return newServer(httptest.NewTLSServer)
+}
+
+func newServer(start func(http.Handler) *httptest.Server) *Server {
+	server := &Server{
+		TokenTTL:     defaultTokenTTL,
+		tokens:       map[string]token{},
+		zones:        map[string]*domainsV2.Zone{},
+		zoneProjects: map[string]string{},
+		rrsets:       map[string]map[string]*domainsV2.RRSet{},
+		denied:       map[string]bool{},
+		blocked:      map[string]chan struct{}{},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+authPath+"auth/tokens", server.issueToken)
+	mux.HandleFunc("GET "+domainsPath+"/zones", server.authorized(server.listZones))
+	mux.HandleFunc("GET "+domainsPath+"/zones/{zoneID}", server.authorized(server.getZone))
+	mux.HandleFunc("GET "+domainsPath+"/zones/{zoneID}/rrset", server.authorized(server.listRRSets))
+	mux.HandleFunc("POST "+domainsPath+"/zones/{zoneID}/rrset", server.authorized(server.createRRSet))
+	mux.HandleFunc("GET "+domainsPath+"/zones/{zoneID}/rrset/{rrsetID}", server.authorized(server.getRRSet))
+	mux.HandleFunc("PATCH "+domainsPath+"/zones/{zoneID}/rrset/{rrsetID}", server.authorized(server.updateRRSet))
+	mux.HandleFunc("DELETE "+domainsPath+"/zones/{zoneID}/rrset/{rrsetID}", server.authorized(server.deleteRRSet))
+	server.Server = start(mux)
+
+	return server
+}
+
+// AuthURL returns url of identity endpoint.
+func (s *Server) AuthURL() string {
+	return s.URL + authPath
+}
+
+// BaseURL returns url of Domains API v2.
+func (s *Server) BaseURL() string {
+	return s.URL + domainsPath
+}
+
+// CABundle returns PEM encoded certificate of https server.
+func (s *Server) CABundle() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.Certificate().Raw})
+}
+
+// AddZone creates zone visible in every project and returns its id.
+func (s *Server) AddZone(name string) string {
+	return s.AddProjectZone("", name)
+}
+
+// AddProjectZone creates zone visible only with tokens of project and returns its id.
+func (s *Server) AddProjectZone(projectID, name string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	zone := &domainsV2.Zone{ID: s.newID("zone"), Name: name, ProjectID: projectID}
+	s.zones[zone.ID] = zone
+	s.zoneProjects[zone.ID] = projectID
+	s.rrsets[zone.ID] = map[string]*domainsV2.RRSet{}
+
+	return zone.ID
+}
+
+// AddRRSet puts rrset to zone as it was created by another client and returns its id.
+func (s *Server) AddRRSet(zoneID string, rrset domainsV2.RRSet) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rrset.ID = s.newID("rrset")
+	rrset.ZoneID = zoneID
+	s.rrsets[zoneID][rrset.ID] = &rrset
+
+	return rrset.ID
+}
+
+// RRSets returns rrsets of zone sorted by name.
+func (s *Server) RRSets(zoneID string) []domainsV2.RRSet {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := make([]domainsV2.RRSet, 0, len(s.rrsets[zoneID]))
+	for _, rrset := range s.rrsets[zoneID] {
+		result = append(result, *rrset)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+
+	return result
+}
+
+// ExpireTokens makes all issued tokens expired, so Domains API responds with 401.
+func (s *Server) ExpireTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, issued := range s.tokens {
+		issued.expiresAt = time.Time{}
+		s.tokens[id] = issued
+	}
+}
+
+// FailRequests makes next count requests to Domains API respond with statusCode.
+func (s *Server) FailRequests(statusCode, count int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failStatus = statusCode
+	s.failures = count
+}
+
+// DenyProject makes requests to Domains API with tokens of project respond with 403.
+func (s *Server) DenyProject(projectID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.denied[projectID] = true
+}
+
+// BlockAuth makes token requests of project wait until release is called.
+func (s *Server) BlockAuth(projectID string) func() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	blocked := make(chan struct{})
+	s.blocked[projectID] = blocked
+	var once sync.Once
+
+	return func() {
+		once.Do(func() { close(blocked) })
+	}
+}
+
+// AuthRequests returns count of issued tokens.
+func (s *Server) AuthRequests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.authRequests
+}
+
+// APIRequests returns count of requests to Domains API.
+func (s *Server) APIRequests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.apiRequests
+}
+
+func (s *Server) newID(prefix string) string {
+	s.nextID++
+
+	return fmt.Sprintf("%s-%d", prefix, s.nextID)
+}
+
+func (s *Server) issueToken(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Auth struct {
+			Scope struct {
+				Project struct {
+					ID string `json:"id"`
+				} `json:"project"`
+			} `json:"scope"`
+		} `json:"auth"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+
+		return
+	}
+	s.mu.Lock()
+	blocked := s.blocked[request.Auth.Scope.Project.ID]
+	s.mu.Unlock()
+	if blocked != nil {
+		<-blocked
+	}
+	s.mu.Lock()
+	s.authRequests++
+	id := s.newID("token")
+	expiresAt := time.Now().Add(s.TokenTTL).UTC()
+	s.tokens[id] = token{projectID: request.Auth.Scope.Project.ID, expiresAt: expiresAt}
+	s.mu.Unlock()
+
+	w.Header().Set(headerSubjectToken, id)
+	writeJSON(w, http.StatusCreated, map[string]any{
+		"token": map[string]any{
+			"expires_at": expiresAt.Format(time.RFC3339),
+			"catalog": []any{
+				map[string]any{
+					"type": "dns",
+					"endpoints": []any{
+						map[string]any{
+							"interface": "public",
+							"region":    Region,
+							"region_id": Region,
+							"url":       s.BaseURL(),
+						},
+					},
+				},
+			},
+		},
+	})
+}
+
+func (s *Server) authorized(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.apiRequests++
+		w.Header().Set(headerRequestID, fmt.Sprintf("req-%d", s.apiRequests))
+		issued, ok := s.tokens[r.Header.Get(headerAuthToken)]
+		failStatus := 0
+		if s.failures > 0 {
+			s.failures--
+			failStatus = s.failStatus
+		}
+		if ok && s.denied[issued.projectID] {
+			failStatus = http.StatusForbidden
+		}
+		s.mu.Unlock()
+		if !ok || time.Now().After(issued.expiresAt) {
+			writeError(w, http.StatusUnauthorized, "unauthorized")
+
+			return
+		}
+		if failStatus != 0 {
+			writeError(w, failStatus, strings.ReplaceAll(strings.ToLower(http.StatusText(failStatus)), " ", "_"))
+
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), projectKey{}, issued.projectID)))
+	}
+}
+
+type projectKey struct{}
+
+// visible reports whether zone can be accessed with token of request.
+// Caller must hold the lock.
+func (s *Server) visible(r *http.Request, zoneID string) bool {
+	projectID, ok := s.zoneProjects[zoneID]
+
+	return ok && (projectID == "" || projectID == r.Context().Value(projectKey{}))
+}
+
+func (s *Server) listZones(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	zones := []*domainsV2.Zone{}
+	for _, zone := range s.zones {
+		if s.visible(r, zone.ID) && strings.Contains(zone.Name, r.URL.Query().Get("filter")) {
+			zoneCopy := *zone
+			zones = append(zones, &zoneCopy)
+		}
+	}
+	s.mu.Unlock()
+	sort.Slice(zones, func(i, j int) bool { return zones[i].Name < zones[j].Name })
+	writeList(w, r, zones)
+}
+
+func (s *Server) getZone(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	zone, ok := s.zones[r.PathValue("zoneID")]
+	ok = ok && s.visible(r, zone.ID)
+	var zoneCopy domainsV2.Zone
+	if ok {
+		zoneCopy = *zone
+	}
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "zone not found")
+
+		return
+	}
+	writeJSON(w, http.StatusOK, zoneCopy)
+}
+
+func (s *Server) listRRSets(w http.ResponseWriter, r *http.Request) {
+	zoneRRSets, ok := s.zoneRRSets(w, r)
+	if !ok {
+		return
+	}
+	query := r.URL.Query()
+	types := map[string]bool{}
+	for _, rrsetType := range query["rrset_types"] {
+		types[rrsetType] = true
+	}
+	s.mu.Lock()
+	rrsets := []*domainsV2.RRSet{}
+	for _, rrset := range zoneRRSets {
+		if !strings.Contains(rrset.Name, query.Get("name")) {
+			continue
+		}
+		if len(types) > 0 && !types[string(rrset.Type)] {
+			continue
+		}
+		rrsetCopy := *rrset
+		rrsets = append(rrsets, &rrsetCopy)
+	}
+	s.mu.Unlock()
+	sort.Slice(rrsets, func(i, j int) bool { return rrsets[i].Name < rrsets[j].Name })
+	writeList(w, r, rrsets)
+}
+
+func (s *Server) createRRSet(w http.ResponseWriter, r *http.Request) {
+	zoneRRSets, ok := s.zoneRRSets(w, r)
+	if !ok {
+		return
+	}
+	rrset := &domainsV2.RRSet{}
+	if err := json.NewDecoder(r.Body).Decode(rrset); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+
+		return
+	}
+	s.mu.Lock()
+	for _, existing := range zoneRRSets {
+		if existing.Name == rrset.Name && existing.Type == rrset.Type {
+			s.mu.Unlock()
+			writeError(w, http.StatusConflict, "rrset already exists")
+
+			return
+		}
+	}
+	rrset.ID = s.newID("rrset")
+	rrset.ZoneID = r.PathValue("zoneID")
+	zoneRRSets[rrset.ID] = rrset
+	rrsetCopy := *rrset
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, rrsetCopy)
+}
+
+func (s *Server) getRRSet(w http.ResponseWriter, r *http.Request) {
+	rrset, ok := s.rrset(w, r)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	rrsetCopy := *rrset
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, rrsetCopy)
+}
+
+func (s *Server) updateRRSet(w http.ResponseWriter, r *http.Request) {
+	rrset, ok := s.rrset(w, r)
+	if !ok {
+		return
+	}
+	update := &domainsV2.RRSet{}
+	if err := json.NewDecoder(r.Body).Decode(update); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+
+		return
+	}
+	s.mu.Lock()
+	rrset.TTL = update.TTL
+	rrset.Records = update.Records
+	// comment is omitted from update form if it is empty
+	if update.Comment != "" {
+		rrset.Comment = update.Comment
+	}
+	s.mu.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) deleteRRSet(w http.ResponseWriter, r *http.Request) {
+	zoneRRSets, ok := s.zoneRRSets(w, r)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	_, ok = zoneRRSets[r.PathValue("rrsetID")]
+	delete(zoneRRSets, r.PathValue("rrsetID"))
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "rrset not found")
+
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) zoneRRSets(w http.ResponseWriter, r *http.Request) (map[string]*domainsV2.RRSet, bool) {
+	s.mu.Lock()
+	zoneRRSets, ok := s.rrsets[r.PathValue("zoneID")]
+	ok = ok && s.visible(r, r.PathValue("zoneID"))
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "zone not found")
+	}
+
+	return zoneRRSets, ok
+}
+
+func (s *Server) rrset(w http.ResponseWriter, r *http.Request) (*domainsV2.RRSet, bool) {
+	zoneRRSets, ok := s.zoneRRSets(w, r)
+	if !ok {
+		return nil, false
+	}
+	s.mu.Lock()
+	rrset, ok := zoneRRSets[r.PathValue("rrsetID")]
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "rrset not found")
+	}
+
+	return rrset, ok
+}
+
+func writeList[T domainsV2.Zone | domainsV2.RRSet](w http.ResponseWriter, r *http.Request, items []*T) {
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = defaultListLimit
+	}
+	offset, err := strconv.Atoi(r.URL.Query().Get("offset"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+	list := domainsV2.List[T]{Count: len(items), Items: []*T{}}
+	if offset < len(items) {
+		end := min(offset+limit, len(items))
+		list.Items = items[offset:end]
+		if end < len(items) {
+			list.NextOffset = end
+		}
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func writeError(w http.ResponseWriter, statusCode int, message string) {
+	writeJSON(w, statusCode, domainsV2.BadResponseError{ErrorMsg: message})
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(body)
+}
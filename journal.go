@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"github.com/selectel/cert-manager-webhook-selectel/journal"
+	"github.com/selectel/cert-manager-webhook-selectel/selectel"
+	extAPI "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/client-go/dynamic"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const journalTimeout = 30 * time.Second
+
+// journalRecord adds record created by Present to journal. Failure is only
+// logged, failed Present would be retried and add the record once more.
+func (c *selectelDNSProviderSolver) journalRecord(challengeRequest *v1alpha1.ChallengeRequest, record *selectel.Record) {
+	if c.journal == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), journalTimeout)
+	defer cancel()
+	entry := journal.Entry{
+		Namespace: challengeRequest.ResourceNamespace,
+		Zone:      challengeRequest.ResolvedZone,
+		ZoneID:    record.ZoneID,
+		FQDN:      challengeRequest.ResolvedFQDN,
+		RRSetID:   record.RRSetID,
+		Value:     challengeRequest.Key,
+		Solver:    c.name,
+		CreatedAt: time.Now().UTC(),
+	}
+	if challengeRequest.Config != nil {
+		entry.Config = challengeRequest.Config.Raw
+	}
+	if err := c.journal.Add(ctx, entry); err != nil {
+		logf.Log.WithName("journal").Error(err, "record is not journaled", "fqdn", challengeRequest.ResolvedFQDN)
+	}
+}
+
+// journalRemove removes record cleaned up by CleanUp from journal.
+func (c *selectelDNSProviderSolver) journalRemove(challengeRequest *v1alpha1.ChallengeRequest) {
+	if c.journal == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), journalTimeout)
+	defer cancel()
+	key := journal.EntryKey(challengeRequest.ResourceNamespace, challengeRequest.ResolvedFQDN, challengeRequest.Key)
+	if err := c.journal.Remove(ctx, key); err != nil {
+		logf.Log.WithName("journal").Error(err, "record is not removed from journal", "fqdn", challengeRequest.ResolvedFQDN)
+	}
+}
+
+// reconcileJournal cleans up records of challenges deleted while webhook
+// was not running, it is done once on start.
+func (s *webhookState) reconcileJournal(challenges dynamic.Interface, stopCh <-chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stopCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	err := s.journal.Reconcile(ctx, challenges, journalRecords{s})
+	if err != nil {
+		logf.Log.WithName("journal").Error(err, "reconcile journal")
+	}
+}
+
+// journalRecords resolves journal entries with Selectel API.
+type journalRecords struct {
+	*webhookState
+}
+
+func (r journalRecords) Exists(ctx context.Context, entry journal.Entry) (bool, error) {
+	provider, err := r.entryProvider(entry)
+	if err != nil {
+		return false, err
+	}
+	found, err := provider.HasRecord(ctx, entry.Zone, entry.ZoneID, entry.RRSetID, entry.Value)
+	if err != nil {
+		return false, fmt.Errorf("look up record: %w", err)
+	}
+
+	return found, nil
+}
+
+func (r journalRecords) CleanUp(_ context.Context, entry journal.Entry) error {
+	provider, err := r.entryProvider(entry)
+	if err != nil {
+		return err
+	}
+	if err = provider.CleanUp(entry.Zone, entry.FQDN, entry.Value); err != nil {
+		return fmt.Errorf("cleanup: %w", err)
+	}
+
+	return nil
+}
+
+// entryProvider returns provider with defaults of solver which created record.
+func (r journalRecords) entryProvider(entry journal.Entry) (*selectel.DNSProvider, error) {
+	c := r.solverFor(entry.Solver)
+	cfg, err := loadConfig(&extAPI.JSON{Raw: entry.Config}, c.configLayers())
+	if err != nil {
+		return nil, fmt.Errorf("load config: %w", err)
+	}
+	provider, err := c.provider(&cfg, entry.Namespace)
+	if err != nil {
+		return nil, fmt.Errorf("setup selectell dns provider: %w", err)
+	}
+
+	return provider, nil
+}
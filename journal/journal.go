@@ -0,0 +1,167 @@
+// Package journal keeps records created by webhook in ConfigMap, so a record
+// left after webhook is restarted between Present and CleanUp is removed later.
+package journal
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	coreV1 "k8s.io/api/core/v1"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Entry is a record of challenge created by Present.
+type Entry struct {
+	// Namespace of challenge request, the cluster resource namespace for ClusterIssuer.
+	Namespace string `json:"namespace"`
+	Zone      string `json:"zone"`
+	ZoneID    string `json:"zoneId"`
+	// FQDN and Value are resolvedFQDN and key of cert-manager Challenge.
+	FQDN    string `json:"fqdn"`
+	RRSetID string `json:"rrsetId"`
+	Value   string `json:"value"`
+	// Solver is name of solver which created record, the default one if empty.
+	Solver string `json:"solver,omitempty"`
+	// Config of solver from issuer, it is required to clean up record.
+	Config    json.RawMessage `json:"config,omitempty"`
+	CreatedAt time.Time       `json:"createdAt"`
+}
+
+// Key returns ConfigMap key of entry, see EntryKey.
+func (e Entry) Key() string {
+	return EntryKey(e.Namespace, e.FQDN, e.Value)
+}
+
+// EntryKey returns ConfigMap key of entry of challenge, cert-manager doesn't
+// pass UID of Challenge to webhook, so challenge is identified by namespace,
+// FQDN and value of its record.
+func EntryKey(namespace, fqdn, value string) string {
+	sum := sha256.Sum256([]byte(namespace + "\x00" + fqdn + "\x00" + value))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// Store keeps entries in ConfigMap, an entry per key returned by EntryKey.
+// The ConfigMap is created on the first entry.
+type Store struct {
+	client    kubernetes.Interface
+	namespace string
+	name      string
+}
+
+// NewStore returns store of entries in ConfigMap name in namespace.
+func NewStore(client kubernetes.Interface, namespace, name string) *Store {
+	return &Store{
+		client:    client,
+		namespace: namespace,
+		name:      name,
+	}
+}
+
+// Add puts entry, an entry with the same key is replaced.
+func (s *Store) Add(ctx context.Context, entry Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("marshal journal entry: %w", err)
+	}
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		configMap, err := s.get(ctx)
+		if apiErrors.IsNotFound(err) {
+			configMap = &coreV1.ConfigMap{
+				ObjectMeta: metaV1.ObjectMeta{Namespace: s.namespace, Name: s.name},
+				Data:       map[string]string{entry.Key(): string(data)},
+			}
+			_, err = s.client.CoreV1().ConfigMaps(s.namespace).Create(ctx, configMap, metaV1.CreateOptions{})
+			if apiErrors.IsAlreadyExists(err) {
+				// retried as conflict with another replica
+				return apiErrors.NewConflict(coreV1.Resource("configmaps"), s.name, err)
+			}
+
+			return err //nolint: wrapcheck
+		}
+		if err != nil {
+			return err
+		}
+		if configMap.Data == nil {
+			configMap.Data = map[string]string{}
+		}
+		configMap.Data[entry.Key()] = string(data)
+
+		return s.update(ctx, configMap)
+	})
+	if err != nil {
+		return fmt.Errorf("add journal entry: %w", err)
+	}
+
+	return nil
+}
+
+// Remove deletes entry of key, missing entry is ignored.
+func (s *Store) Remove(ctx context.Context, key string) error {
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		configMap, err := s.get(ctx)
+		if apiErrors.IsNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if _, ok := configMap.Data[key]; !ok {
+			return nil
+		}
+		delete(configMap.Data, key)
+
+		return s.update(ctx, configMap)
+	})
+	if err != nil {
+		return fmt.Errorf("remove journal entry: %w", err)
+	}
+
+	return nil
+}
+
+// List returns entries ordered by creation time, entries which can't be
+// decoded are skipped.
+func (s *Store) List(ctx context.Context) ([]Entry, error) {
+	configMap, err := s.get(ctx)
+	if apiErrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("list journal entries: %w", err)
+	}
+	entries := make([]Entry, 0, len(configMap.Data))
+	for key, data := range configMap.Data {
+		entry := Entry{}
+		if err := json.Unmarshal([]byte(data), &entry); err != nil {
+			logf.Log.WithName("journal").Error(err, "invalid journal entry is skipped", "key", key)
+
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].CreatedAt.Before(entries[j].CreatedAt)
+	})
+
+	return entries, nil
+}
+
+func (s *Store) get(ctx context.Context) (*coreV1.ConfigMap, error) {
+	return s.client.CoreV1().ConfigMaps(s.namespace).Get(ctx, s.name, metaV1.GetOptions{}) //nolint: wrapcheck
+}
+
+func (s *Store) update(ctx context.Context, configMap *coreV1.ConfigMap) error {
+	_, err := s.client.CoreV1().ConfigMaps(s.namespace).Update(ctx, configMap, metaV1.UpdateOptions{})
+
+	return err //nolint: wrapcheck
+}
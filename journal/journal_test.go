@@ -0,0 +1,84 @@
+package journal
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const (
+	testNamespace = "cert-manager"
+	testName      = "webhook-journal"
+)
+
+func newTestEntry(name string, createdAt time.Time) Entry {
+	return Entry{
+		Namespace: "team-a",
+		Zone:      "example.com.",
+		ZoneID:    "zone-1",
+		FQDN:      "_acme-challenge." + name + ".example.com.",
+		RRSetID:   "rrset-1",
+		Value:     "value-" + name,
+		Config:    []byte(`{"dnsSecretRef":{"name":"selectel-dns-credentials"}}`),
+		CreatedAt: createdAt.UTC().Truncate(time.Second),
+	}
+}
+
+func TestStore_AddListRemove(t *testing.T) {
+	t.Parallel()
+	store := NewStore(fake.NewSimpleClientset(), testNamespace, testName)
+	entries, err := store.List(t.Context())
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	now := time.Now()
+	second := newTestEntry("second", now)
+	first := newTestEntry("first", now.Add(-time.Minute))
+	require.NoError(t, store.Add(t.Context(), second))
+	require.NoError(t, store.Add(t.Context(), first))
+	entries, err = store.List(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, []Entry{first, second}, entries)
+
+	// CleanUp has only challenge request to find entry added by Present
+	key := EntryKey("team-a", "_acme-challenge.first.example.com.", "value-first")
+	require.NoError(t, store.Remove(t.Context(), key))
+	require.NoError(t, store.Remove(t.Context(), key))
+	entries, err = store.List(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, []Entry{second}, entries)
+}
+
+func TestStore_ConcurrentAdd(t *testing.T) {
+	t.Parallel()
+	store := NewStore(fake.NewSimpleClientset(), testNamespace, testName)
+	const count = 10
+	var wg sync.WaitGroup
+	for i := range count {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, store.Add(t.Context(), newTestEntry(fmt.Sprintf("name-%d", i), time.Now())))
+		}()
+	}
+	wg.Wait()
+
+	entries, err := store.List(t.Context())
+	require.NoError(t, err)
+	assert.Len(t, entries, count)
+}
+
+func TestEntryKey(t *testing.T) {
+	t.Parallel()
+	key := EntryKey("team-a", "_acme-challenge.example.com.", "value")
+	assert.Regexp(t, `^[-._a-zA-Z0-9]+$`, key, "valid ConfigMap key")
+	assert.Equal(t, key, EntryKey("team-a", "_acme-challenge.example.com.", "value"))
+	assert.NotEqual(t, key, EntryKey("team-b", "_acme-challenge.example.com.", "value"))
+	assert.NotEqual(t, key, EntryKey("team-a", "_acme-challenge.example.com.", "other"))
+	assert.NotEqual(t, key, EntryKey("team-a", "_acme-challenge.example.org.", "value"))
+}
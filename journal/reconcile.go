@@ -0,0 +1,100 @@
+package journal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// ChallengesResource is cert-manager Challenge, spec.resolvedFQDN and spec.key
+// of it are FQDN and Value of entry.
+var ChallengesResource = schema.GroupVersionResource{
+	Group:    "acme.cert-manager.io",
+	Version:  "v1",
+	Resource: "challenges",
+}
+
+// Records resolves entries against DNS, record of entry is looked up
+// by ZoneID and RRSetID of entry.
+type Records interface {
+	// Exists reports whether RRSet of entry still has its value.
+	Exists(ctx context.Context, entry Entry) (bool, error)
+	// CleanUp removes value of entry from its RRSet.
+	CleanUp(ctx context.Context, entry Entry) error
+}
+
+// Reconcile resolves entries against DNS: entry of record which is gone, e.g.
+// cleaned up by another replica or rolled back, is removed, record of challenge
+// which doesn't exist anymore is cleaned up, cert-manager is not going to call
+// CleanUp for it. Records of existing challenges are left to cert-manager.
+// Entry is kept if it is not resolved, it is retried on the next reconcile.
+func (s *Store) Reconcile(ctx context.Context, challenges dynamic.Interface, records Records) error {
+	log := logf.Log.WithName("journal")
+	entries, err := s.List(ctx)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	// challenges of ClusterIssuer are not in namespace of entry, so all of them are listed
+	existing, err := challengeRecords(ctx, challenges)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, entry := range entries {
+		entryLog := log.WithValues("namespace", entry.Namespace, "fqdn", entry.FQDN, "rrset", entry.RRSetID)
+		found, err := records.Exists(ctx, entry)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("look up %s: %w", entry.FQDN, err))
+
+			continue
+		}
+		switch {
+		case !found:
+			entryLog.Info("record is already gone, entry is removed")
+		case existing[challengeRecord{fqdn: entry.FQDN, key: entry.Value}]:
+			continue
+		default:
+			if err = records.CleanUp(ctx, entry); err != nil {
+				errs = append(errs, fmt.Errorf("clean up %s: %w", entry.FQDN, err))
+
+				continue
+			}
+			entryLog.Info("record of deleted challenge is cleaned up")
+		}
+		if err = s.Remove(ctx, entry.Key()); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// challengeRecord is a record of challenge by its spec.resolvedFQDN and spec.key.
+type challengeRecord struct {
+	fqdn string
+	key  string
+}
+
+func challengeRecords(ctx context.Context, challenges dynamic.Interface) (map[challengeRecord]bool, error) {
+	list, err := challenges.Resource(ChallengesResource).List(ctx, metaV1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("list challenges: %w", err)
+	}
+	existing := make(map[challengeRecord]bool, len(list.Items))
+	for i := range list.Items {
+		fqdn, _, _ := unstructured.NestedString(list.Items[i].Object, "spec", "resolvedFQDN")
+		key, _, _ := unstructured.NestedString(list.Items[i].Object, "spec", "key")
+		existing[challengeRecord{fqdn: fqdn, key: key}] = true
+	}
+
+	return existing, nil
+}
@@ -0,0 +1,93 @@
+package journal
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicFake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// newTestChallenge returns Challenge of entry newTestEntry(name), it has no UID
+// as one cert-manager passes to webhook.
+func newTestChallenge(namespace, name string) *unstructured.Unstructured {
+	entry := newTestEntry(name, time.Now())
+	challenge := &unstructured.Unstructured{Object: map[string]any{
+		"spec": map[string]any{
+			"dnsName":      name + ".example.com",
+			"resolvedFQDN": entry.FQDN,
+			"key":          entry.Value,
+		},
+	}}
+	challenge.SetAPIVersion("acme.cert-manager.io/v1")
+	challenge.SetKind("Challenge")
+	challenge.SetNamespace(namespace)
+	challenge.SetName(name)
+
+	return challenge
+}
+
+// testRecords are records of entries in DNS by value.
+type testRecords struct {
+	existing map[string]bool
+	failed   map[string]error
+	cleaned  []string
+}
+
+func (r *testRecords) Exists(_ context.Context, entry Entry) (bool, error) {
+	return r.existing[entry.Value], nil
+}
+
+func (r *testRecords) CleanUp(_ context.Context, entry Entry) error {
+	if err := r.failed[entry.Value]; err != nil {
+		return err
+	}
+	r.cleaned = append(r.cleaned, entry.Value)
+
+	return nil
+}
+
+func TestStore_Reconcile(t *testing.T) {
+	t.Parallel()
+	store := NewStore(fake.NewSimpleClientset(), testNamespace, testName)
+	now := time.Now()
+	names := []string{"pending", "pending-cluster", "pending-gone", "deleted", "deleted-gone", "failed"}
+	for _, name := range names {
+		require.NoError(t, store.Add(t.Context(), newTestEntry(name, now)))
+	}
+	challenges := dynamicFake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{ChallengesResource: "ChallengeList"},
+		newTestChallenge("team-a", "pending"),
+		// challenge of ClusterIssuer is not in namespace of entry
+		newTestChallenge("team-b", "pending-cluster"),
+		newTestChallenge("team-a", "pending-gone"),
+	)
+
+	errCleanUp := errors.New("selectel api error 500")
+	records := &testRecords{
+		existing: map[string]bool{
+			"value-pending": true, "value-pending-cluster": true, "value-deleted": true, "value-failed": true,
+		},
+		failed: map[string]error{"value-failed": errCleanUp},
+	}
+	err := store.Reconcile(t.Context(), challenges, records)
+	require.ErrorIs(t, err, errCleanUp)
+	assert.Equal(t, []string{"value-deleted"}, records.cleaned)
+
+	// record of existing challenge is left to cert-manager, failed one is retried later,
+	// entries of records which are gone are removed
+	entries, err := store.List(t.Context())
+	require.NoError(t, err)
+	left := []string{}
+	for _, entry := range entries {
+		left = append(left, entry.Value)
+	}
+	assert.ElementsMatch(t, []string{"value-pending", "value-pending-cluster", "value-failed"}, left)
+}
@@ -0,0 +1,86 @@
+package lock
+
+import (
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	coreV1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+)
+
+// TestLeaseLocker_Envtest checks locking against real API server, it is
+// skipped without kubebuilder assets, run it with make test.
+func TestLeaseLocker_Envtest(t *testing.T) {
+	if os.Getenv("KUBEBUILDER_ASSETS") == "" && os.Getenv("TEST_ASSET_KUBE_APISERVER") == "" {
+		t.Skip("kubebuilder assets are not set up")
+	}
+	env := &envtest.Environment{}
+	cfg, err := env.Start()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = env.Stop() })
+	client, err := kubernetes.NewForConfig(cfg)
+	require.NoError(t, err)
+	_, err = client.CoreV1().Namespaces().Create(t.Context(),
+		&coreV1.Namespace{ObjectMeta: metaV1.ObjectMeta{Name: testNamespace}}, metaV1.CreateOptions{})
+	require.NoError(t, err)
+
+	t.Run("MutualExclusion", func(t *testing.T) {
+		var (
+			wg      sync.WaitGroup
+			mu      sync.Mutex
+			holders int
+			maxSeen int
+		)
+		for _, holder := range []string{"webhook-0", "webhook-1", "webhook-2"} {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				locker := newTestLocker(client, holder)
+				locker.WaitTimeout = 30 * time.Second
+				for range 3 {
+					unlock, err := locker.Lock(t.Context(), testKey)
+					if !assert.NoError(t, err) {
+						return
+					}
+					mu.Lock()
+					holders++
+					maxSeen = max(maxSeen, holders)
+					mu.Unlock()
+					time.Sleep(20 * time.Millisecond)
+					mu.Lock()
+					holders--
+					mu.Unlock()
+					unlock()
+				}
+			}()
+		}
+		wg.Wait()
+		assert.Equal(t, 1, maxSeen)
+	})
+
+	t.Run("ExpiredLeaseOfCrashedHolder", func(t *testing.T) {
+		key := "example.com/_acme-challenge.crashed.example.com"
+		crashed := newTestLocker(client, "webhook-0")
+		crashed.LeaseDuration = time.Second
+		unlockCrashed, err := crashed.Lock(t.Context(), key)
+		require.NoError(t, err)
+
+		locker := newTestLocker(client, "webhook-1")
+		locker.now = func() time.Time { return time.Now().Add(2 * time.Second) }
+		unlock, err := locker.Lock(t.Context(), key)
+		require.NoError(t, err)
+
+		// release by crashed holder after takeover keeps lease of new holder
+		unlockCrashed()
+		lease, err := client.CoordinationV1().Leases(testNamespace).Get(t.Context(), leaseName(key), metaV1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "webhook-1", *lease.Spec.HolderIdentity)
+		unlock()
+	})
+}
@@ -0,0 +1,273 @@
+// Package lock implements distributed lock on coordination.k8s.io Leases,
+// it serializes changes of RRSets between replicas of webhook.
+package lock
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	coordinationV1 "k8s.io/api/coordination/v1"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	defaultLeaseDuration = 30 * time.Second
+	defaultRetryInterval = 500 * time.Millisecond
+	defaultWaitTimeout   = 2 * time.Minute
+	unlockTimeout        = 10 * time.Second
+
+	leaseNamePrefix = "cert-manager-webhook-selectel-"
+	keyAnnotation   = "acme.selectel.ru/lock-key"
+)
+
+// ErrTimeout is returned when lease is not released by another holder in wait timeout.
+var ErrTimeout = errors.New("timeout waiting for lock")
+
+// LeaseLocker takes a Lease per key. The lease is renewed while it is held,
+// lease of crashed holder is taken after it is not renewed for LeaseDuration.
+// Lock of the same key in the replica waits for unlock too, the lease doesn't
+// serialize them, because they have the same holder.
+type LeaseLocker struct {
+	client    kubernetes.Interface
+	namespace string
+	holder    string
+
+	// LeaseDuration after which lease which is not renewed can be taken by another holder.
+	LeaseDuration time.Duration
+	// RetryInterval between attempts to take lease held by another holder.
+	RetryInterval time.Duration
+	// WaitTimeout limits waiting for lease held by another holder.
+	WaitTimeout time.Duration
+
+	now func() time.Time
+
+	// local are keys locked in the replica, a channel is buffered with the key holder.
+	mu    sync.Mutex
+	local map[string]*localLock
+}
+
+type localLock struct {
+	held chan struct{}
+	refs int
+}
+
+// NewLeaseLocker returns locker with leases in namespace, holder identifies
+// the replica, e.g. name of pod.
+func NewLeaseLocker(client kubernetes.Interface, namespace, holder string) *LeaseLocker {
+	return &LeaseLocker{
+		client:        client,
+		namespace:     namespace,
+		holder:        holder,
+		LeaseDuration: defaultLeaseDuration,
+		RetryInterval: defaultRetryInterval,
+		WaitTimeout:   defaultWaitTimeout,
+		now:           time.Now,
+		local:         map[string]*localLock{},
+	}
+}
+
+// Lock takes lease of key waiting at most WaitTimeout, unlock releases it.
+func (l *LeaseLocker) Lock(ctx context.Context, key string) (func(), error) {
+	name := leaseName(key)
+	waitCtx, cancel := context.WithTimeout(ctx, l.WaitTimeout)
+	defer cancel()
+	unlockLocal, err := l.lockLocal(waitCtx, key)
+	if err != nil {
+		return nil, l.waitError(ctx, key)
+	}
+	for {
+		lease, err := l.tryAcquire(waitCtx, name, key)
+		if err != nil && waitCtx.Err() == nil {
+			unlockLocal()
+
+			return nil, fmt.Errorf("acquire lease %s: %w", name, err)
+		}
+		if lease != nil {
+			return l.hold(lease, unlockLocal), nil
+		}
+		timer := time.NewTimer(l.RetryInterval)
+		select {
+		case <-waitCtx.Done():
+			timer.Stop()
+			unlockLocal()
+
+			return nil, l.waitError(ctx, key)
+		case <-timer.C:
+		}
+	}
+}
+
+// waitError returns error of ctx if it is done, otherwise wait timed out.
+func (l *LeaseLocker) waitError(ctx context.Context, key string) error {
+	if ctx.Err() != nil {
+		return ctx.Err() //nolint: wrapcheck
+	}
+
+	return fmt.Errorf("%w %s in %s", ErrTimeout, key, l.WaitTimeout)
+}
+
+// lockLocal waits for unlock of key locked in the replica.
+func (l *LeaseLocker) lockLocal(ctx context.Context, key string) (func(), error) {
+	l.mu.Lock()
+	lock, ok := l.local[key]
+	if !ok {
+		lock = &localLock{held: make(chan struct{}, 1)}
+		l.local[key] = lock
+	}
+	lock.refs++
+	l.mu.Unlock()
+	release := func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		lock.refs--
+		if lock.refs == 0 {
+			delete(l.local, key)
+		}
+	}
+	select {
+	case lock.held <- struct{}{}:
+		return func() {
+			<-lock.held
+			release()
+		}, nil
+	case <-ctx.Done():
+		release()
+
+		return nil, ctx.Err() //nolint: wrapcheck
+	}
+}
+
+// tryAcquire returns nil lease if it is held by another holder.
+func (l *LeaseLocker) tryAcquire(ctx context.Context, name, key string) (*coordinationV1.Lease, error) {
+	leases := l.client.CoordinationV1().Leases(l.namespace)
+	lease, err := leases.Get(ctx, name, metaV1.GetOptions{})
+	if apiErrors.IsNotFound(err) {
+		lease = &coordinationV1.Lease{
+			ObjectMeta: metaV1.ObjectMeta{
+				Name:        name,
+				Namespace:   l.namespace,
+				Annotations: map[string]string{keyAnnotation: key},
+			},
+		}
+		l.setHolder(lease)
+		lease, err = leases.Create(ctx, lease, metaV1.CreateOptions{})
+		if apiErrors.IsAlreadyExists(err) {
+			return nil, nil //nolint: nilnil
+		}
+
+		return lease, err //nolint: wrapcheck
+	}
+	if err != nil {
+		return nil, err //nolint: wrapcheck
+	}
+	if l.heldByAnother(lease) {
+		return nil, nil //nolint: nilnil
+	}
+	l.setHolder(lease)
+	lease, err = leases.Update(ctx, lease, metaV1.UpdateOptions{})
+	if apiErrors.IsConflict(err) {
+		return nil, nil //nolint: nilnil
+	}
+
+	return lease, err //nolint: wrapcheck
+}
+
+func (l *LeaseLocker) heldByAnother(lease *coordinationV1.Lease) bool {
+	spec := lease.Spec
+	if spec.HolderIdentity == nil || *spec.HolderIdentity == "" || *spec.HolderIdentity == l.holder {
+		return false
+	}
+	if spec.RenewTime == nil || spec.LeaseDurationSeconds == nil {
+		return false
+	}
+	expiresAt := spec.RenewTime.Add(time.Duration(*spec.LeaseDurationSeconds) * time.Second)
+
+	return l.now().Before(expiresAt)
+}
+
+func (l *LeaseLocker) setHolder(lease *coordinationV1.Lease) {
+	now := metaV1.NewMicroTime(l.now())
+	durationSeconds := int32(l.LeaseDuration.Seconds())
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != l.holder {
+		transitions := int32(0)
+		if lease.Spec.LeaseTransitions != nil {
+			transitions = *lease.Spec.LeaseTransitions + 1
+		}
+		lease.Spec.LeaseTransitions = &transitions
+		lease.Spec.AcquireTime = &now
+	}
+	lease.Spec.HolderIdentity = &l.holder
+	lease.Spec.LeaseDurationSeconds = &durationSeconds
+	lease.Spec.RenewTime = &now
+}
+
+// hold renews lease until returned unlock is called, unlock deletes lease
+// and then releases the key in the replica.
+func (l *LeaseLocker) hold(lease *coordinationV1.Lease, unlockLocal func()) func() {
+	log := logf.Log.WithName("lock").WithValues("lease", lease.Name)
+	leases := l.client.CoordinationV1().Leases(l.namespace)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	current := lease
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(l.LeaseDuration / 3) //nolint: mnd
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			renewed := current.DeepCopy()
+			l.setHolder(renewed)
+			renewed, err := leases.Update(ctx, renewed, metaV1.UpdateOptions{})
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Error(err, "renew lease")
+				}
+
+				continue
+			}
+			current = renewed
+		}
+	}()
+
+	var once sync.Once
+
+	return func() {
+		once.Do(func() {
+			cancel()
+			<-done
+			deleteCtx, cancelDelete := context.WithTimeout(context.Background(), unlockTimeout)
+			defer cancelDelete()
+			// lease taken by another holder after expiry must not be deleted
+			err := leases.Delete(deleteCtx, current.Name, metaV1.DeleteOptions{
+				Preconditions: &metaV1.Preconditions{
+					UID:             &current.UID,
+					ResourceVersion: &current.ResourceVersion,
+				},
+			})
+			if err != nil && !apiErrors.IsNotFound(err) {
+				log.Error(err, "release lease")
+			}
+			unlockLocal()
+		})
+	}
+}
+
+// leaseName is derived from hash of key, because key may be longer than
+// allowed name or contain characters not allowed in it.
+func leaseName(key string) string {
+	sum := sha256.Sum256([]byte(key))
+
+	return leaseNamePrefix + hex.EncodeToString(sum[:])[:16]
+}
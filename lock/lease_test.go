@@ -0,0 +1,154 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const (
+	testNamespace = "cert-manager"
+	testKey       = "example.com/_acme-challenge.example.com"
+)
+
+func newTestLocker(client kubernetes.Interface, holder string) *LeaseLocker {
+	locker := NewLeaseLocker(client, testNamespace, holder)
+	locker.RetryInterval = 10 * time.Millisecond
+	locker.WaitTimeout = time.Second
+
+	return locker
+}
+
+func TestLeaseLocker_LockUnlock(t *testing.T) {
+	t.Parallel()
+	client := fake.NewSimpleClientset()
+	locker := newTestLocker(client, "webhook-0")
+
+	unlock, err := locker.Lock(t.Context(), testKey)
+	require.NoError(t, err)
+	lease, err := client.CoordinationV1().Leases(testNamespace).Get(t.Context(), leaseName(testKey), metaV1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "webhook-0", *lease.Spec.HolderIdentity)
+	assert.Equal(t, testKey, lease.Annotations[keyAnnotation])
+
+	unlock()
+	unlock()
+	_, err = client.CoordinationV1().Leases(testNamespace).Get(t.Context(), leaseName(testKey), metaV1.GetOptions{})
+	assert.True(t, apiErrors.IsNotFound(err))
+}
+
+func TestLeaseLocker_WaitTimeout(t *testing.T) {
+	t.Parallel()
+	client := fake.NewSimpleClientset()
+	unlock, err := newTestLocker(client, "webhook-0").Lock(t.Context(), testKey)
+	require.NoError(t, err)
+	defer unlock()
+
+	locker := newTestLocker(client, "webhook-1")
+	locker.WaitTimeout = 50 * time.Millisecond
+	_, err = locker.Lock(t.Context(), testKey)
+	require.ErrorIs(t, err, ErrTimeout)
+
+	// another key is not blocked
+	unlockOther, err := locker.Lock(t.Context(), "example.com/_acme-challenge.www.example.com")
+	require.NoError(t, err)
+	unlockOther()
+}
+
+func TestLeaseLocker_WaitsForUnlock(t *testing.T) {
+	t.Parallel()
+	client := fake.NewSimpleClientset()
+	unlock, err := newTestLocker(client, "webhook-0").Lock(t.Context(), testKey)
+	require.NoError(t, err)
+	time.AfterFunc(50*time.Millisecond, unlock)
+
+	unlockNext, err := newTestLocker(client, "webhook-1").Lock(t.Context(), testKey)
+	require.NoError(t, err)
+	unlockNext()
+}
+
+func TestLeaseLocker_TakesExpiredLease(t *testing.T) {
+	t.Parallel()
+	client := fake.NewSimpleClientset()
+	crashed := newTestLocker(client, "webhook-0")
+	_, err := crashed.Lock(t.Context(), testKey)
+	require.NoError(t, err)
+
+	locker := newTestLocker(client, "webhook-1")
+	locker.now = func() time.Time { return time.Now().Add(defaultLeaseDuration + time.Second) }
+	unlock, err := locker.Lock(t.Context(), testKey)
+	require.NoError(t, err)
+	defer unlock()
+
+	lease, err := client.CoordinationV1().Leases(testNamespace).Get(t.Context(), leaseName(testKey), metaV1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "webhook-1", *lease.Spec.HolderIdentity)
+	assert.Equal(t, int32(1), *lease.Spec.LeaseTransitions)
+}
+
+func TestLeaseLocker_ContextCanceled(t *testing.T) {
+	t.Parallel()
+	client := fake.NewSimpleClientset()
+	unlock, err := newTestLocker(client, "webhook-0").Lock(t.Context(), testKey)
+	require.NoError(t, err)
+	defer unlock()
+
+	ctx, cancel := context.WithCancel(t.Context())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	_, err = newTestLocker(client, "webhook-1").Lock(ctx, testKey)
+	require.ErrorIs(t, err, context.Canceled)
+	assert.False(t, errors.Is(err, ErrTimeout))
+}
+
+func TestLeaseName(t *testing.T) {
+	t.Parallel()
+	name := leaseName(testKey)
+	assert.Equal(t, name, leaseName(testKey))
+	assert.NotEqual(t, name, leaseName("example.com/_acme-challenge.www.example.com"))
+	assert.LessOrEqual(t, len(name), 63)
+}
+
+func TestLeaseLocker_SameHolder(t *testing.T) {
+	t.Parallel()
+	client := fake.NewSimpleClientset()
+	locker := newTestLocker(client, "webhook-0")
+	unlock, err := locker.Lock(t.Context(), testKey)
+	require.NoError(t, err)
+
+	// challenges of example.com and *.example.com in the same replica are serialized
+	locked := make(chan func())
+	go func() {
+		unlockNext, err := locker.Lock(t.Context(), testKey)
+		assert.NoError(t, err)
+		locked <- unlockNext
+	}()
+	select {
+	case <-locked:
+		t.Fatal("key is locked twice by the same holder")
+	case <-time.After(100 * time.Millisecond):
+	}
+	unlock()
+	unlockNext := <-locked
+	lease, err := client.CoordinationV1().Leases(testNamespace).Get(t.Context(), leaseName(testKey), metaV1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "webhook-0", *lease.Spec.HolderIdentity)
+	unlockNext()
+	_, err = client.CoordinationV1().Leases(testNamespace).Get(t.Context(), leaseName(testKey), metaV1.GetOptions{})
+	assert.True(t, apiErrors.IsNotFound(err))
+
+	locker.WaitTimeout = 50 * time.Millisecond
+	unlock, err = locker.Lock(t.Context(), testKey)
+	require.NoError(t, err)
+	defer unlock()
+	_, err = locker.Lock(t.Context(), testKey)
+	require.ErrorIs(t, err, ErrTimeout)
+	assert.Len(t, locker.local, 1)
+}
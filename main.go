@@ -6,17 +6,28 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook"
 	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
 	"github.com/cert-manager/cert-manager/pkg/acme/webhook/cmd"
-	"github.com/go-playground/validator/v10"
+	"github.com/selectel/cert-manager-webhook-selectel/cli"
+	"github.com/selectel/cert-manager-webhook-selectel/defaults"
+	"github.com/selectel/cert-manager-webhook-selectel/dnsconfig"
+	"github.com/selectel/cert-manager-webhook-selectel/journal"
+	"github.com/selectel/cert-manager-webhook-selectel/lock"
+	"github.com/selectel/cert-manager-webhook-selectel/policy"
 	"github.com/selectel/cert-manager-webhook-selectel/selectel"
-	"github.com/selectel/cert-manager-webhook-selectel/utils"
 	coreV1 "k8s.io/api/core/v1"
 	extAPI "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 )
@@ -24,28 +35,95 @@ import (
 const (
 	providerName    = "selectel"
 	groupNameEnvVar = "GROUP_NAME"
+
+	// ConfigMap with namespace-to-domain policy as "namespace/name"
+	// or "name" in the namespace of webhook.
+	policyConfigMapEnvVar = "POLICY_CONFIGMAP"
+	podNamespaceEnvVar    = "POD_NAMESPACE"
+	// Cluster id and pod name mark RRSets created by webhook, cluster id
+	// is UID of kube-system namespace if it is not set.
+	clusterIDEnvVar    = "CLUSTER_ID"
+	clusterIDNamespace = "kube-system"
+	podNameEnvVar      = "POD_NAME"
+	// ConfigMap with journal of created records as "namespace/name"
+	// or "name" in the namespace of webhook, journal is disabled if empty.
+	journalConfigMapEnvVar = "JOURNAL_CONFIGMAP"
+	// Limits of requests to Domains API per Selectel account: requests per second,
+	// burst and max requests in flight, zero disables the limit.
+	apiRateLimitEnvVar   = "SELECTEL_API_RATE_LIMIT"
+	apiRateBurstEnvVar   = "SELECTEL_API_RATE_BURST"
+	apiMaxInFlightEnvVar = "SELECTEL_API_MAX_IN_FLIGHT"
+	// Circuit breaker of Selectel API endpoints: failures in a row opening circuit,
+	// zero disables it, and time until probe request, e.g. "30s".
+	apiBreakerFailuresEnvVar    = "SELECTEL_API_BREAKER_FAILURES"
+	apiBreakerOpenTimeoutEnvVar = "SELECTEL_API_BREAKER_OPEN_TIMEOUT"
+	// Address of health endpoint with state of circuit breakers, e.g. ":8080".
+	healthAddrEnvVar = "HEALTH_ADDR"
+	// Namespace of Leases locking RRSets between replicas, locking is disabled if empty.
+	leaseLockNamespaceEnvVar = "LEASE_LOCK_NAMESPACE"
+	// Max wait for Lease held by another replica, e.g. "2m".
+	leaseLockWaitTimeoutEnvVar = "LEASE_LOCK_WAIT_TIMEOUT"
+	// File with webhook-wide defaults of solver config, it is reloaded on change.
+	defaultsFileEnvVar = "SELECTEL_DEFAULTS_FILE"
+	// Watch SelectelDNSConfigs referenced by issuers with configRef if "true".
+	dnsConfigsEnabledEnvVar = "SELECTEL_DNS_CONFIGS_ENABLED"
+	// Cluster resource namespace of cert-manager, challenges of ClusterIssuers are in it.
+	clusterResourceNamespaceEnvVar  = "CLUSTER_RESOURCE_NAMESPACE"
+	defaultClusterResourceNamespace = "cert-manager"
+
+	caBundleKindConfigMap = "ConfigMap"
+	caBundleKindSecret    = "Secret"
+	defaultCABundleKey    = "ca.crt"
 )
 
 var (
-	// use a single instance of Validate, it caches struct info.
-	validate              *validator.Validate = validator.New(validator.WithRequiredStructEnabled())
-	errSecretNameNotSetup                     = errors.New("secret name not setup")
-	errConvertToValidator                     = errors.New("convert to validator")
+	errSecretNameNotSetup  = errors.New("secret name not setup")
+	errUnknownCABundleKind = errors.New("unknown kind of ca bundle reference")
+	errCABundleKeyNotFound = errors.New("ca bundle key not found")
+	errInvalidLimit        = errors.New("limit must be non-negative number")
+	errReservedSolverName  = errors.New("name of solver is reserved by the default solver")
 )
 
 func main() {
+	if args, ok := cli.CommandArgs(os.Args); ok {
+		os.Exit(cli.Run(args, os.Stdout, os.Stderr, loadDoctorConfig))
+	}
 	groupName := os.Getenv("GROUP_NAME")
 	if groupName == "" {
 		panic(groupNameEnvVar + " must be specified")
 	}
+	solvers, err := newSolvers()
+	if err != nil {
+		panic(err)
+	}
 	// This will register our custom DNS provider with the webhook serving
 	// library, making it available as an API under the provided groupName.
-	// You can register multiple DNS provider implementations with a single
-	// webhook, where the Name() method will be used to disambiguate between
-	// the different implementations.
-	cmd.RunWebhookServer(groupName,
-		&selectelDNSProviderSolver{},
-	)
+	// The default solver and named solvers of defaults file are registered,
+	// the Name() method is used to disambiguate between them.
+	cmd.RunWebhookServer(groupName, solvers...)
+}
+
+// newSolvers returns the default solver and named solvers declared in defaults
+// file, names of solvers are read once on start.
+func newSolvers() ([]webhook.Solver, error) {
+	state := newWebhookState()
+	solvers := []webhook.Solver{state.newSolver(providerName, "")}
+	path := os.Getenv(defaultsFileEnvVar)
+	if path == "" {
+		return solvers, nil
+	}
+	fileDefaults, err := defaults.Load(path)
+	if err != nil {
+		return nil, err //nolint: wrapcheck
+	}
+	for _, name := range fileDefaults.SolverNames() {
+		if name == providerName {
+			return nil, fmt.Errorf("%w: %s", errReservedSolverName, name)
+		}
+		solvers = append(solvers, state.newSolver(name, fileDefaults.Solvers[name].PolicyConfigMap))
+	}
+
+	return solvers, nil
 }
 
 // selectelDNSProviderSolver implements the provider-specific logic needed to
@@ -53,41 +131,217 @@ func main() {
 // To do so, it must implement the
 // `https://pkg.go.dev/github.com/cert-manager/cert-manager@v1.14.1/pkg/acme/webhook#Solver` interface.
 type selectelDNSProviderSolver struct {
-	client *kubernetes.Clientset
+	*webhookState
+	// name is solverName of issuers, named solvers have their own defaults.
+	name string
+	// policyConfigMap is policy of named solver, the webhook-wide policy is used if empty.
+	policyConfigMap string
+	// policy is nil if namespace-to-domain policy is not configured.
+	policy *policy.Store
+}
+
+// webhookState is shared by solvers registered in webhook, it is initialized
+// by the first of them.
+type webhookState struct {
+	client   kubernetes.Interface
+	recorder record.EventRecorder
+	// sharedPolicy is nil if webhook-wide namespace-to-domain policy is not configured.
+	sharedPolicy *policy.Store
+	// locker is nil if locking of RRSets between replicas is disabled.
+	locker *lock.LeaseLocker
+	// journal is nil if journal of created records is disabled.
+	journal *journal.Store
+	// configs is nil if SelectelDNSConfigs are disabled.
+	configs *dnsconfig.Store
+	// defaults is nil if webhook-wide defaults file is not set.
+	defaults *defaults.Store
+	limits   selectel.Limits
+	breaker  selectel.BreakerSettings
+	// clusterID marks RRSets created by webhook of this cluster.
+	clusterID string
+	// solvers by name, journal records are cleaned up by solver which created them.
+	solvers map[string]*selectelDNSProviderSolver
+
+	initOnce sync.Once
+	initErr  error
+}
+
+func newWebhookState() *webhookState {
+	return &webhookState{solvers: map[string]*selectelDNSProviderSolver{}}
+}
+
+func (s *webhookState) newSolver(name, policyConfigMap string) *selectelDNSProviderSolver {
+	solver := &selectelDNSProviderSolver{webhookState: s, name: name, policyConfigMap: policyConfigMap}
+	s.solvers[name] = solver
+
+	return solver
+}
+
+// solverFor returns solver by name, the default solver if it is unknown.
+func (s *webhookState) solverFor(name string) *selectelDNSProviderSolver {
+	if solver, ok := s.solvers[name]; ok {
+		return solver
+	}
+
+	return s.solvers[providerName]
 }
 
 // selectelDNSProviderConfig is a structure that is used to decode into when
 // solving a DNS01 challenge.
 type selectelDNSProviderConfig struct {
+	// ConfigRef is name of SelectelDNSConfig, the config is merged over it.
+	ConfigRef    string                 `json:"configRef,omitempty"`
 	DNSSecretRef coreV1.SecretReference `json:"dnsSecretRef" validate:"required"`
+	// Secret with username and password keys for proxy authentication.
+	ProxySecretRef *coreV1.SecretReference `json:"proxySecretRef,omitempty"`
+	// ConfigMap or Secret with extra CA bundle for Selectel API endpoints.
+	CABundleRef *caBundleReference `json:"caBundleRef,omitempty"`
+	// Secret of kubernetes.io/tls type with client certificate for mTLS.
+	ClientCertSecretRef *coreV1.SecretReference `json:"clientCertSecretRef,omitempty"`
 	*selectel.Config
+	// refsNamespace is namespace of Secrets and ConfigMaps set in SelectelDNSConfig,
+	// they are read in namespace of challenge if empty.
+	refsNamespace string
+	// refsAllowedNamespaces may read Secrets in refsNamespace.
+	refsAllowedNamespaces []string
+	// dnsSecretDefaults are defaults with fallback credentials Secret, nil if
+	// dnsSecretRef is set by issuer or SelectelDNSConfig.
+	dnsSecretDefaults *defaults.Defaults
 }
 
-func (c *selectelDNSProviderSolver) provider(cfg *selectelDNSProviderConfig, namespace string) (*selectel.DNSProvider, error) {
-	// setup credentials from secret
+// caBundleReference points to a key with PEM encoded certificates
+// in ConfigMap (default) or Secret.
+type caBundleReference struct {
+	Kind string `json:"kind,omitempty"`
+	Name string `json:"name"`
+	Key  string `json:"key,omitempty"`
+}
+
+func (c *selectelDNSProviderSolver) secretData(namespace, name string) (map[string][]byte, error) {
 	sec, err := c.client.CoreV1().
 		Secrets(namespace).
-		Get(context.Background(), cfg.DNSSecretRef.Name, metaV1.GetOptions{})
+		Get(context.Background(), name, metaV1.GetOptions{})
 	if err != nil {
 		return nil, fmt.Errorf("getting secret from k8s: %w", err)
 	}
-	err = cfg.CredentialsForDNS.FromMapBytes(sec.Data)
-	if err != nil {
-		return nil, fmt.Errorf("setup credentials from secret. %w", err)
+
+	return sec.Data, nil
+}
+
+func (c *selectelDNSProviderSolver) caBundle(ref *caBundleReference, namespace string) ([]byte, error) {
+	key := ref.Key
+	if key == "" {
+		key = defaultCABundleKey
 	}
-	// validate credentials
-	err = validate.Struct(cfg.CredentialsForDNS)
-	if err != nil {
-		//nolint: errorlint
-		validationErrors, ok := err.(validator.ValidationErrors)
-		if !ok {
-			return nil, errConvertToValidator
+	switch ref.Kind {
+	case "", caBundleKindConfigMap:
+		configMap, err := c.client.CoreV1().
+			ConfigMaps(namespace).
+			Get(context.Background(), ref.Name, metaV1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("getting config map from k8s: %w", err)
+		}
+		if data, ok := configMap.Data[key]; ok {
+			return []byte(data), nil
+		}
+		if data, ok := configMap.BinaryData[key]; ok {
+			return data, nil
 		}
-		if err = utils.BuildErrFromValidator(validationErrors); err != nil {
-			return nil, fmt.Errorf("validate credentials: %w", err)
+	case caBundleKindSecret:
+		data, err := c.secretData(namespace, ref.Name)
+		if err != nil {
+			return nil, err
 		}
+		if bundle, ok := data[key]; ok {
+			return bundle, nil
+		}
+	default:
+		return nil, fmt.Errorf("%w: %s", errUnknownCABundleKind, ref.Kind)
 	}
 
+	return nil, fmt.Errorf("%w: %s", errCABundleKeyNotFound, key)
+}
+
+// setupTransport reads proxy credentials, CA bundle and client certificate
+// referenced by config.
+func (c *selectelDNSProviderSolver) setupTransport(cfg *selectelDNSProviderConfig, namespace string) error {
+	if cfg.ProxySecretRef != nil {
+		data, err := c.secretData(namespace, cfg.ProxySecretRef.Name)
+		if err != nil {
+			return err
+		}
+		if err = cfg.ProxyCredentials.FromMapBytes(data); err != nil {
+			return fmt.Errorf("setup proxy credentials from secret: %w", err)
+		}
+	}
+	if cfg.CABundleRef != nil {
+		bundle, err := c.caBundle(cfg.CABundleRef, namespace)
+		if err != nil {
+			return fmt.Errorf("setup ca bundle: %w", err)
+		}
+		cfg.CABundle = bundle
+	}
+	if cfg.ClientCertSecretRef != nil {
+		data, err := c.secretData(namespace, cfg.ClientCertSecretRef.Name)
+		if err != nil {
+			return err
+		}
+		if err = cfg.ClientCertificate.FromMapBytes(data); err != nil {
+			return fmt.Errorf("setup client certificate from secret: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// setupConfig reads and validates credentials and transport settings
+// from Secrets referenced by config.
+func (c *selectelDNSProviderSolver) setupConfig(cfg *selectelDNSProviderConfig, namespace string) error {
+	if err := checkRefsNamespace(cfg, namespace); err != nil {
+		return err
+	}
+	if fallback := cfg.dnsSecretDefaults; fallback != nil {
+		if err := fallback.CheckSecretNamespace(namespace, clusterResourceNamespace()); err != nil {
+			return err //nolint: wrapcheck
+		}
+	}
+	if cfg.refsNamespace != "" {
+		namespace = cfg.refsNamespace
+	}
+	// setup credentials from secret
+	secretNamespace := namespace
+	if cfg.dnsSecretDefaults != nil {
+		secretNamespace = cfg.dnsSecretDefaults.DNSSecretRef.Namespace
+	}
+	data, err := c.secretData(secretNamespace, cfg.DNSSecretRef.Name)
+	if err != nil {
+		return err
+	}
+	err = cfg.FromSecretData(data)
+	if err != nil {
+		return fmt.Errorf("setup credentials from secret. %w", err)
+	}
+	err = c.setupTransport(cfg, namespace)
+	if err != nil {
+		return err
+	}
+	if err = cfg.CredentialsForDNS.Validate(); err != nil {
+		return fmt.Errorf("validate credentials: %w", err)
+	}
+
+	return nil
+}
+
+func (c *selectelDNSProviderSolver) provider(cfg *selectelDNSProviderConfig, namespace string) (*selectel.DNSProvider, error) {
+	if err := c.setupConfig(cfg, namespace); err != nil {
+		return nil, err
+	}
+	if c.locker != nil {
+		cfg.Locker = c.locker
+	}
+	cfg.Limits = c.currentDefaults().Limits(c.limits)
+	cfg.Breaker = c.breaker
+
 	dnsProvider, err := selectel.NewDNSProviderFromConfig(cfg.Config)
 	if err != nil {
 		return nil, fmt.Errorf("setup dns provider: %w", err)
@@ -96,9 +350,28 @@ func (c *selectelDNSProviderSolver) provider(cfg *selectelDNSProviderConfig, nam
 	return dnsProvider, nil
 }
 
+// authorize checks challenge by namespace-to-domain policy before any call
+// to Selectel API, violation is reported with event in the requesting namespace.
+func (c *selectelDNSProviderSolver) authorize(challengeRequest *v1alpha1.ChallengeRequest) error {
+	if c.policy == nil {
+		return nil
+	}
+	err := c.policy.Authorize(context.Background(), challengeRequest.ResourceNamespace, challengeRequest.ResolvedFQDN)
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, policy.ErrForbidden) || errors.Is(err, policy.ErrNotLoaded) {
+		c.recorder.Eventf(namespaceReference(challengeRequest.ResourceNamespace), coreV1.EventTypeWarning,
+			eventReasonPolicyViolation, "%s challenge for %s is denied: %v",
+			challengeRequest.Action, challengeRequest.DNSName, err)
+	}
+
+	return fmt.Errorf("authorize by policy: %w", err)
+}
+
 // Return DNS provider name.
 func (c *selectelDNSProviderSolver) Name() string {
-	return providerName
+	return c.name
 }
 
 // Present is responsible for actually presenting the DNS record with the
@@ -107,18 +380,30 @@ func (c *selectelDNSProviderSolver) Name() string {
 // cert-manager itself will later perform a self check to ensure that the
 // solver has correctly configured the DNS provider.
 func (c *selectelDNSProviderSolver) Present(challengeRequest *v1alpha1.ChallengeRequest) error {
-	cfg, err := loadConfig(challengeRequest.Config)
+	if err := c.authorize(challengeRequest); err != nil {
+		return err
+	}
+	cfg, err := loadConfig(challengeRequest.Config, c.configLayers())
 	if err != nil {
 		return fmt.Errorf("load config: %w", err)
 	}
+	if err = cfg.CheckChallenge(challengeRequest.DNSName, challengeRequest.ResolvedFQDN); err != nil {
+		return fmt.Errorf("check domain: %w", err)
+	}
 	provider, err := c.provider(&cfg, challengeRequest.ResourceNamespace)
 	if err != nil {
+		c.reportCredentials(&cfg, dnsconfig.ReasonSetupFailed, err)
+
 		return fmt.Errorf("setup selectell dns provider: %w", err)
 	}
-	err = provider.Present(challengeRequest.ResolvedZone, challengeRequest.ResolvedFQDN, challengeRequest.Key)
+	record, err := provider.PresentRecord(challengeRequest.ResolvedZone, challengeRequest.ResolvedFQDN, challengeRequest.Key)
+	c.reportCredentials(&cfg, "", err)
 	if err != nil {
+		c.reportFailure(challengeRequest, err)
+
 		return fmt.Errorf("present: %w", err)
 	}
+	c.journalRecord(challengeRequest, record)
 
 	return nil
 }
@@ -130,18 +415,27 @@ func (c *selectelDNSProviderSolver) Present(challengeRequest *v1alpha1.Challenge
 // This is in order to facilitate multiple DNS validations for the same domain
 // concurrently.
 func (c *selectelDNSProviderSolver) CleanUp(challengeRequest *v1alpha1.ChallengeRequest) error {
-	cfg, err := loadConfig(challengeRequest.Config)
+	if err := c.authorize(challengeRequest); err != nil {
+		return err
+	}
+	cfg, err := loadConfig(challengeRequest.Config, c.configLayers())
 	if err != nil {
 		return fmt.Errorf("load config: %w", err)
 	}
 	provider, err := c.provider(&cfg, challengeRequest.ResourceNamespace)
 	if err != nil {
+		c.reportCredentials(&cfg, dnsconfig.ReasonSetupFailed, err)
+
 		return fmt.Errorf("setup selectell dns provider: %w", err)
 	}
 	err = provider.CleanUp(challengeRequest.ResolvedZone, challengeRequest.ResolvedFQDN, challengeRequest.Key)
+	c.reportCredentials(&cfg, "", err)
 	if err != nil {
+		c.reportFailure(challengeRequest, err)
+
 		return fmt.Errorf("cleanup: %w", err)
 	}
+	c.journalRemove(challengeRequest)
 
 	return nil
 }
@@ -155,9 +449,28 @@ func (c *selectelDNSProviderSolver) CleanUp(challengeRequest *v1alpha1.Challenge
 // provider accounts.
 // The stopCh can be used to handle early termination of the webhook, in cases
 // where a SIGTERM or similar signal is sent to the webhook process.
-func (c *selectelDNSProviderSolver) Initialize(kubeClientCfg *rest.Config, _ <-chan struct{}) error {
-	// use name in json tag as field name for validate output errors
-	validate.RegisterTagNameFunc(utils.JSONFieldNameForValidator)
+// Solvers share clients and stores, they are set up by the first initialized solver.
+func (c *selectelDNSProviderSolver) Initialize(kubeClientCfg *rest.Config, stopCh <-chan struct{}) error {
+	c.initOnce.Do(func() {
+		c.initErr = c.initialize(kubeClientCfg, stopCh)
+	})
+	if c.initErr != nil {
+		return c.initErr
+	}
+	c.policy = c.sharedPolicy
+	if c.policyConfigMap != "" {
+		namespace, name := namespacedName(c.policyConfigMap)
+		c.policy = policy.NewStore(c.client, namespace, name)
+		if err := c.policy.Run(stopCh); err != nil {
+			return fmt.Errorf("run policy store of solver %s: %w", c.name, err)
+		}
+	}
+
+	return nil
+}
+
+// initialize sets up clients and stores shared by solvers.
+func (s *webhookState) initialize(kubeClientCfg *rest.Config, stopCh <-chan struct{}) error {
 	// We must setup logger
 	// https://pkg.go.dev/sigs.k8s.io/controller-runtime/pkg/log#pkg-variables
 	// example from https://sdk.operatorframework.io/docs/building-operators/golang/references/logging/
@@ -168,26 +481,231 @@ func (c *selectelDNSProviderSolver) Initialize(kubeClientCfg *rest.Config, _ <-c
 	if err != nil {
 		return fmt.Errorf("k8s clientset: %w", err)
 	}
-	c.client = cl
+	s.client = cl
+	s.recorder = newEventRecorder(cl, stopCh)
+	if s.clusterID, err = clusterID(cl); err != nil {
+		return err
+	}
+	if s.limits, err = limitsFromEnv(); err != nil {
+		return err
+	}
+	if s.breaker, err = breakerSettingsFromEnv(); err != nil {
+		return err
+	}
+	selectel.RegisterMetrics()
+	if path := os.Getenv(defaultsFileEnvVar); path != "" {
+		if s.defaults, err = defaults.NewStore(path); err != nil {
+			return err //nolint: wrapcheck
+		}
+		defaults.RegisterMetrics()
+		if err = s.defaults.Watch(stopCh); err != nil {
+			return err //nolint: wrapcheck
+		}
+	}
+	if addr := os.Getenv(healthAddrEnvVar); addr != "" {
+		if err = runHealthServer(addr, stopCh); err != nil {
+			return fmt.Errorf("run health server: %w", err)
+		}
+	}
+
+	if configMap := os.Getenv(policyConfigMapEnvVar); configMap != "" {
+		namespace, name := namespacedName(configMap)
+		s.sharedPolicy = policy.NewStore(cl, namespace, name)
+		if err = s.sharedPolicy.Run(stopCh); err != nil {
+			return fmt.Errorf("run policy store: %w", err)
+		}
+	}
+	dynamicClient, err := dynamic.NewForConfig(kubeClientCfg)
+	if err != nil {
+		return fmt.Errorf("k8s dynamic client: %w", err)
+	}
+	// configs are watched before journal, its records may reference them
+	if os.Getenv(dnsConfigsEnabledEnvVar) == "true" {
+		s.configs = dnsconfig.NewStore(dynamicClient)
+		if err = s.configs.Run(stopCh); err != nil {
+			return fmt.Errorf("run selectel dns config store: %w", err)
+		}
+	}
+	if namespace := os.Getenv(leaseLockNamespaceEnvVar); namespace != "" {
+		holder := os.Getenv(podNameEnvVar)
+		if holder == "" {
+			if holder, err = os.Hostname(); err != nil {
+				return fmt.Errorf("lease lock holder: %w", err)
+			}
+		}
+		s.locker = lock.NewLeaseLocker(cl, namespace, holder)
+		if waitTimeout := os.Getenv(leaseLockWaitTimeoutEnvVar); waitTimeout != "" {
+			if s.locker.WaitTimeout, err = time.ParseDuration(waitTimeout); err != nil {
+				return fmt.Errorf("parse %s: %w", leaseLockWaitTimeoutEnvVar, err)
+			}
+		}
+	}
+	// records are cleaned up on start under lock, like Present changes them in another replica
+	if configMap := os.Getenv(journalConfigMapEnvVar); configMap != "" {
+		namespace, name := namespacedName(configMap)
+		s.journal = journal.NewStore(cl, namespace, name)
+		go s.reconcileJournal(dynamicClient, stopCh)
+	}
 
 	return nil
 }
 
+// limitsFromEnv returns default limits of requests to Domains API overridden by env.
+func limitsFromEnv() (selectel.Limits, error) {
+	limits := selectel.DefaultLimits()
+	if value := os.Getenv(apiRateLimitEnvVar); value != "" {
+		rate, err := strconv.ParseFloat(value, 64)
+		if err != nil || rate < 0 {
+			return limits, fmt.Errorf("%w: %s=%q", errInvalidLimit, apiRateLimitEnvVar, value)
+		}
+		limits.Rate = rate
+	}
+	for envVar, limit := range map[string]*int{
+		apiRateBurstEnvVar:   &limits.Burst,
+		apiMaxInFlightEnvVar: &limits.MaxInFlight,
+	} {
+		value := os.Getenv(envVar)
+		if value == "" {
+			continue
+		}
+		number, err := strconv.Atoi(value)
+		if err != nil || number < 0 {
+			return limits, fmt.Errorf("%w: %s=%q", errInvalidLimit, envVar, value)
+		}
+		*limit = number
+	}
+
+	return limits, nil
+}
+
+// breakerSettingsFromEnv returns default settings of circuit breakers overridden by env.
+func breakerSettingsFromEnv() (selectel.BreakerSettings, error) {
+	settings := selectel.DefaultBreakerSettings()
+	if value := os.Getenv(apiBreakerFailuresEnvVar); value != "" {
+		failures, err := strconv.Atoi(value)
+		if err != nil || failures < 0 {
+			return settings, fmt.Errorf("%w: %s=%q", errInvalidLimit, apiBreakerFailuresEnvVar, value)
+		}
+		settings.Failures = failures
+	}
+	if value := os.Getenv(apiBreakerOpenTimeoutEnvVar); value != "" {
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout < 0 {
+			return settings, fmt.Errorf("%w: %s=%q", errInvalidLimit, apiBreakerOpenTimeoutEnvVar, value)
+		}
+		settings.OpenTimeout = timeout
+	}
+
+	return settings, nil
+}
+
+// clusterID returns CLUSTER_ID or UID of kube-system namespace, so clusters
+// without CLUSTER_ID don't own RRSets of each other.
+func clusterID(client kubernetes.Interface) (string, error) {
+	if id := os.Getenv(clusterIDEnvVar); id != "" {
+		return id, nil
+	}
+	namespace, err := client.CoreV1().Namespaces().Get(context.Background(), clusterIDNamespace, metaV1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("get %s namespace for cluster id, set %s: %w", clusterIDNamespace, clusterIDEnvVar, err)
+	}
+
+	return string(namespace.UID), nil
+}
+
+// clusterResourceNamespace returns namespace of challenges of ClusterIssuers.
+func clusterResourceNamespace() string {
+	if namespace := os.Getenv(clusterResourceNamespaceEnvVar); namespace != "" {
+		return namespace
+	}
+
+	return defaultClusterResourceNamespace
+}
+
+// namespacedName parses "namespace/name" or "name" in the namespace of webhook.
+func namespacedName(value string) (string, string) {
+	namespace, name, ok := strings.Cut(value, "/")
+	if !ok {
+		return os.Getenv(podNamespaceEnvVar), value
+	}
+
+	return namespace, name
+}
+
+// configLayers are sources of solver config under inline config of issuer,
+// zero value has built-in defaults only.
+type configLayers struct {
+	// defaults are webhook-wide defaults, nil if defaults file is not set.
+	defaults *defaults.Defaults
+	// getConfig resolves configRef, nil if SelectelDNSConfigs are disabled.
+	getConfig dnsconfig.GetFunc
+	// clusterID is owner of RRSets created with config.
+	clusterID string
+}
+
+// newConfigForDNS returns built-in defaults overridden by webhook-wide defaults.
+func (l configLayers) newConfigForDNS() (*selectel.Config, error) {
+	cfg, err := selectel.NewConfigForDNS()
+	if err != nil {
+		return nil, fmt.Errorf("setup selectel config: %w", err)
+	}
+	if err = l.defaults.Apply(cfg); err != nil {
+		return nil, err //nolint: wrapcheck
+	}
+
+	return cfg, nil
+}
+
+// configLayers returns the current sources of solver config.
+func (c *selectelDNSProviderSolver) configLayers() configLayers {
+	layers := configLayers{defaults: c.currentDefaults(), clusterID: c.clusterID}
+	if c.configs != nil {
+		layers.getConfig = c.configs.Get
+	}
+
+	return layers
+}
+
+// currentDefaults returns the last valid defaults of solver, nil if defaults file is not set.
+func (c *selectelDNSProviderSolver) currentDefaults() *defaults.Defaults {
+	if c.defaults == nil {
+		return nil
+	}
+
+	return c.defaults.Get().ForSolver(c.name)
+}
+
 // loadConfig is a small helper function that decodes JSON configuration into
-// the typed config struct.
-func loadConfig(cfgJSON *extAPI.JSON) (selectelDNSProviderConfig, error) {
+// the typed config struct over layers of defaults and SelectelDNSConfig.
+func loadConfig(cfgJSON *extAPI.JSON, layers configLayers) (selectelDNSProviderConfig, error) {
 	cfg := selectelDNSProviderConfig{}
-	cfgDNS, err := selectel.NewConfigForDNS()
+	cfgDNS, err := layers.newConfigForDNS()
 	if err != nil {
-		return cfg, fmt.Errorf("setup selectel config: %w", err)
+		return cfg, err
 	}
 	cfg.Config = cfgDNS
 	if err := json.Unmarshal(cfgJSON.Raw, &cfg); err != nil {
 		return cfg, fmt.Errorf("unmarshal config: %w", err)
 	}
+	if cfg.ConfigRef != "" {
+		if err := mergeDNSConfig(&cfg, cfgJSON.Raw, layers); err != nil {
+			return cfg, err
+		}
+	}
+	if fallback := layers.defaults; cfg.DNSSecretRef.Name == "" && fallback != nil && fallback.DNSSecretRef != nil {
+		cfg.DNSSecretRef.Name = fallback.DNSSecretRef.Name
+		cfg.dnsSecretDefaults = fallback
+	}
 	if cfg.DNSSecretRef.Name == "" {
 		return cfg, errSecretNameNotSetup
 	}
+	cfg.Owner = selectel.Owner{
+		ClusterID: layers.clusterID,
+		Instance:  os.Getenv(podNameEnvVar),
+	}
+	if err := cfg.Validate(); err != nil {
+		return cfg, fmt.Errorf("validate config: %w", err)
+	}
 
 	return cfg, nil
 }
@@ -14,7 +14,7 @@ func TestRunsSuite(t *testing.T) {
 	// The manifest path should contain a file named config.json that is a
 	// snippet of valid configuration that should be included on the
 	// ChallengeRequest passed as part of the test cases.
-	fixture := acmetest.NewFixture(&selectelDNSProviderSolver{},
+	fixture := acmetest.NewFixture(newWebhookState().newSolver(providerName, ""),
 		acmetest.SetResolvedZone(zone),
 		acmetest.SetAllowAmbientCredentials(false),
 		acmetest.SetManifestPath("testdata/selectel"),
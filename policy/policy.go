@@ -0,0 +1,117 @@
+// Package policy authorizes namespaces to solve DNS-01 challenges for domains,
+// so a shared ClusterIssuer can't be used to write records in any zone
+// reachable with its credentials.
+package policy
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/selectel/cert-manager-webhook-selectel/utils"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/yaml"
+)
+
+var (
+	// ErrForbidden is returned when no rule allows namespace to solve challenge for domain.
+	ErrForbidden = errors.New("namespace is not allowed to solve challenge for domain")
+
+	errNoNamespacesInRule = errors.New("setup namespaces or namespaceSelector")
+	errNoDomainsInRule    = errors.New("setup domains")
+)
+
+// Policy is a list of rules, a challenge is allowed if any rule allows it.
+type Policy struct {
+	Rules []Rule `json:"rules"`
+}
+
+// Rule allows namespaces selected by name or labels to solve challenges for domains.
+type Rule struct {
+	// Namespaces are names of namespaces, "*" matches any namespace.
+	Namespaces []string `json:"namespaces,omitempty"`
+	// NamespaceSelector selects namespaces by labels.
+	NamespaceSelector *metaV1.LabelSelector `json:"namespaceSelector,omitempty"`
+	// Domains are patterns of allowed domains, see utils.MatchDomain.
+	Domains []string `json:"domains"`
+
+	selector labels.Selector
+}
+
+// Namespace is a namespace requesting challenge.
+type Namespace struct {
+	Name   string
+	Labels map[string]string
+}
+
+// Parse decodes policy from yaml or json and validates its rules.
+func Parse(data []byte) (*Policy, error) {
+	policy := &Policy{}
+	if err := yaml.UnmarshalStrict(data, policy); err != nil {
+		return nil, fmt.Errorf("unmarshal policy: %w", err)
+	}
+	for i := range policy.Rules {
+		if err := policy.Rules[i].compile(); err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i, err)
+		}
+	}
+
+	return policy, nil
+}
+
+func (r *Rule) compile() error {
+	if len(r.Namespaces) == 0 && r.NamespaceSelector == nil {
+		return errNoNamespacesInRule
+	}
+	if len(r.Domains) == 0 {
+		return errNoDomainsInRule
+	}
+	for _, pattern := range r.Domains {
+		if err := utils.ValidateDomainPattern(pattern); err != nil {
+			return fmt.Errorf("domain pattern %q: %w", pattern, err)
+		}
+	}
+	if r.NamespaceSelector != nil {
+		selector, err := metaV1.LabelSelectorAsSelector(r.NamespaceSelector)
+		if err != nil {
+			return fmt.Errorf("namespace selector: %w", err)
+		}
+		r.selector = selector
+	}
+
+	return nil
+}
+
+// NeedsLabels reports whether namespace labels are required to authorize challenge.
+func (p *Policy) NeedsLabels() bool {
+	for i := range p.Rules {
+		if p.Rules[i].selector != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Authorize returns ErrForbidden if no rule allows namespace to solve challenge
+// for domain of challenge record fqdn.
+func (p *Policy) Authorize(namespace Namespace, fqdn string) error {
+	domain := utils.ChallengeDomain(fqdn)
+	for i := range p.Rules {
+		if p.Rules[i].selects(namespace) && utils.MatchAnyDomain(p.Rules[i].Domains, domain) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: namespace %s, domain %s", ErrForbidden, namespace.Name, domain)
+}
+
+func (r *Rule) selects(namespace Namespace) bool {
+	for _, name := range r.Namespaces {
+		if name == "*" || name == namespace.Name {
+			return true
+		}
+	}
+
+	return r.selector != nil && r.selector.Matches(labels.Set(namespace.Labels))
+}
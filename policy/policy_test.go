@@ -0,0 +1,66 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testPolicy = `
+rules:
+  - namespaces: [team-a]
+    domains: [a.example.com, "*.a.example.com"]
+  - namespaceSelector:
+      matchLabels:
+        team: b
+    domains: ["*.b.example.com"]
+  - namespaces: ["*"]
+    domains: ["*.shared.example.com"]
+`
+
+func TestPolicy_Authorize(t *testing.T) {
+	t.Parallel()
+	policy, err := Parse([]byte(testPolicy))
+	require.NoError(t, err)
+	assert.True(t, policy.NeedsLabels())
+
+	teamA := Namespace{Name: "team-a"}
+	teamB := Namespace{Name: "team-b", Labels: map[string]string{"team": "b"}}
+	other := Namespace{Name: "other"}
+
+	require.NoError(t, policy.Authorize(teamA, "_acme-challenge.a.example.com."))
+	require.NoError(t, policy.Authorize(teamA, "_acme-challenge.www.a.example.com."))
+	require.NoError(t, policy.Authorize(teamB, "_acme-challenge.www.b.example.com."))
+	require.NoError(t, policy.Authorize(other, "_acme-challenge.x.shared.example.com."))
+
+	err = policy.Authorize(teamA, "_acme-challenge.www.b.example.com.")
+	require.ErrorIs(t, err, ErrForbidden)
+	assert.Equal(t, "namespace is not allowed to solve challenge for domain: "+
+		"namespace team-a, domain www.b.example.com", err.Error())
+	require.ErrorIs(t, policy.Authorize(teamB, "_acme-challenge.b.example.com."), ErrForbidden)
+	require.ErrorIs(t, policy.Authorize(other, "_acme-challenge.example.com."), ErrForbidden)
+}
+
+func TestParse_Invalid(t *testing.T) {
+	t.Parallel()
+	testCases := map[string]string{
+		"unknown field":         "rules: [{namespace: [a], domains: [example.com]}]",
+		"no namespaces":         "rules: [{domains: [example.com]}]",
+		"no domains":            "rules: [{namespaces: [a]}]",
+		"bad domain pattern":    "rules: [{namespaces: [a], domains: ['[.example.com']}]",
+		"bad selector operator": "rules: [{namespaceSelector: {matchExpressions: [{key: a, operator: Near}]}, domains: [example.com]}]",
+	}
+	for name, data := range testCases {
+		_, err := Parse([]byte(data))
+		assert.Error(t, err, name)
+	}
+}
+
+func TestParse_Empty(t *testing.T) {
+	t.Parallel()
+	policy, err := Parse([]byte(""))
+	require.NoError(t, err)
+	assert.False(t, policy.NeedsLabels())
+	assert.ErrorIs(t, policy.Authorize(Namespace{Name: "a"}, "_acme-challenge.example.com."), ErrForbidden)
+}
@@ -0,0 +1,142 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	coreV1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// DataKey is a key of policy in ConfigMap.
+	DataKey = "policy.yaml"
+
+	resyncPeriod = 10 * time.Minute
+)
+
+var (
+	// ErrNotLoaded is returned while policy ConfigMap is not found or has never been valid,
+	// all challenges are denied then.
+	ErrNotLoaded = errors.New("policy is not loaded")
+
+	errCacheNotSynced   = errors.New("policy config map cache is not synced")
+	errConfigMapNotRead = errors.New("config map is not read yet")
+	errConfigMapDeleted = errors.New("config map is deleted")
+)
+
+// Store keeps policy from ConfigMap, the policy is reloaded on every change of it.
+// Invalid change is ignored and the last valid policy stays in use.
+type Store struct {
+	client    kubernetes.Interface
+	namespace string
+	name      string
+
+	mu      sync.RWMutex
+	policy  *Policy
+	loadErr error
+}
+
+// NewStore returns store of policy from ConfigMap name in namespace.
+func NewStore(client kubernetes.Interface, namespace, name string) *Store {
+	return &Store{
+		client:    client,
+		namespace: namespace,
+		name:      name,
+		loadErr:   fmt.Errorf("%w: %s/%s", errConfigMapNotRead, namespace, name),
+	}
+}
+
+// Run starts watching ConfigMap until stopCh is closed and waits
+// for the first read of it.
+func (s *Store) Run(stopCh <-chan struct{}) error {
+	factory := informers.NewSharedInformerFactoryWithOptions(s.client, resyncPeriod,
+		informers.WithNamespace(s.namespace),
+		informers.WithTweakListOptions(func(options *metaV1.ListOptions) {
+			options.FieldSelector = fields.OneTermEqualSelector("metadata.name", s.name).String()
+		}),
+	)
+	informer := factory.Core().V1().ConfigMaps().Informer()
+	_, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    s.update,
+		UpdateFunc: func(_, obj any) { s.update(obj) },
+		DeleteFunc: func(any) { s.remove() },
+	})
+	if err != nil {
+		return fmt.Errorf("add policy config map handler: %w", err)
+	}
+	factory.Start(stopCh)
+	for _, synced := range factory.WaitForCacheSync(stopCh) {
+		if !synced {
+			return errCacheNotSynced
+		}
+	}
+
+	return nil
+}
+
+// Authorize returns ErrForbidden if policy doesn't allow namespace
+// to solve challenge for domain of fqdn.
+func (s *Store) Authorize(ctx context.Context, namespace, fqdn string) error {
+	s.mu.RLock()
+	policy, loadErr := s.policy, s.loadErr
+	s.mu.RUnlock()
+	if policy == nil {
+		return fmt.Errorf("%w: %w", ErrNotLoaded, loadErr)
+	}
+
+	requester := Namespace{Name: namespace}
+	err := policy.Authorize(requester, fqdn)
+	if err == nil || !policy.NeedsLabels() {
+		return err
+	}
+	// labels are read only if no rule allows namespace by name
+	object, err := s.client.CoreV1().Namespaces().Get(ctx, namespace, metaV1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("get namespace: %w", err)
+	}
+	requester.Labels = object.Labels
+
+	return policy.Authorize(requester, fqdn)
+}
+
+func (s *Store) update(obj any) {
+	log := logf.Log.WithName("policy")
+	configMap, ok := obj.(*coreV1.ConfigMap)
+	if !ok {
+		return
+	}
+	policy, err := Parse([]byte(configMap.Data[DataKey]))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		log.Error(err, "invalid policy is ignored", "configMap", s.namespace+"/"+s.name)
+		if s.policy == nil {
+			s.loadErr = err
+		}
+
+		return
+	}
+	log.Info("policy is loaded", "configMap", s.namespace+"/"+s.name, "rules", len(policy.Rules))
+	s.policy = policy
+	s.loadErr = nil
+}
+
+func (s *Store) remove() {
+	logf.Log.WithName("policy").Info("policy config map is deleted, all challenges are denied",
+		"configMap", s.namespace+"/"+s.name)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.policy = nil
+	s.loadErr = fmt.Errorf("%w: %s/%s", errConfigMapDeleted, s.namespace, s.name)
+}
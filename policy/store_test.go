@@ -0,0 +1,105 @@
+package policy
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	coreV1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const (
+	testNamespace = "cert-manager"
+	testName      = "webhook-policy"
+	testFQDN      = "_acme-challenge.www.a.example.com."
+)
+
+func newTestConfigMap(policy string) *coreV1.ConfigMap {
+	return &coreV1.ConfigMap{
+		ObjectMeta: metaV1.ObjectMeta{Namespace: testNamespace, Name: testName},
+		Data:       map[string]string{DataKey: policy},
+	}
+}
+
+func runTestStore(t *testing.T, client *fake.Clientset) *Store {
+	t.Helper()
+	stopCh := make(chan struct{})
+	t.Cleanup(func() { close(stopCh) })
+	store := NewStore(client, testNamespace, testName)
+	require.NoError(t, store.Run(stopCh))
+
+	return store
+}
+
+func requireEventually(t *testing.T, condition func() bool) {
+	t.Helper()
+	require.Eventually(t, condition, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestStore_HotReload(t *testing.T) {
+	t.Parallel()
+	client := fake.NewSimpleClientset(
+		newTestConfigMap(testPolicy),
+		&coreV1.Namespace{ObjectMeta: metaV1.ObjectMeta{Name: "team-b", Labels: map[string]string{"team": "b"}}},
+	)
+	store := runTestStore(t, client)
+
+	require.NoError(t, store.Authorize(t.Context(), "team-a", testFQDN))
+	require.NoError(t, store.Authorize(t.Context(), "team-b", "_acme-challenge.www.b.example.com."))
+
+	_, err := client.CoreV1().ConfigMaps(testNamespace).Update(t.Context(),
+		newTestConfigMap("rules: [{namespaces: [team-a], domains: [b.example.com]}]"), metaV1.UpdateOptions{})
+	require.NoError(t, err)
+	requireEventually(t, func() bool {
+		return errors.Is(store.Authorize(t.Context(), "team-a", testFQDN), ErrForbidden)
+	})
+	require.NoError(t, store.Authorize(t.Context(), "team-a", "_acme-challenge.b.example.com."))
+}
+
+func TestStore_InvalidUpdateKeepsPolicy(t *testing.T) {
+	t.Parallel()
+	client := fake.NewSimpleClientset(newTestConfigMap(testPolicy))
+	store := runTestStore(t, client)
+
+	_, err := client.CoreV1().ConfigMaps(testNamespace).Update(t.Context(),
+		newTestConfigMap("rules: [{namespaces: [team-a]}]"), metaV1.UpdateOptions{})
+	require.NoError(t, err)
+	// there is no sign of ignored update, give informer time to handle it
+	time.Sleep(100 * time.Millisecond)
+
+	assert.NoError(t, store.Authorize(t.Context(), "team-a", testFQDN))
+}
+
+func TestStore_DeniesWithoutConfigMap(t *testing.T) {
+	t.Parallel()
+	client := fake.NewSimpleClientset()
+	store := runTestStore(t, client)
+	require.ErrorIs(t, store.Authorize(t.Context(), "team-a", testFQDN), ErrNotLoaded)
+
+	_, err := client.CoreV1().ConfigMaps(testNamespace).Create(t.Context(),
+		newTestConfigMap(testPolicy), metaV1.CreateOptions{})
+	require.NoError(t, err)
+	requireEventually(t, func() bool {
+		return store.Authorize(t.Context(), "team-a", testFQDN) == nil
+	})
+
+	err = client.CoreV1().ConfigMaps(testNamespace).Delete(t.Context(), testName, metaV1.DeleteOptions{})
+	require.NoError(t, err)
+	requireEventually(t, func() bool {
+		return errors.Is(store.Authorize(t.Context(), "team-a", testFQDN), ErrNotLoaded)
+	})
+}
+
+func TestStore_NamespaceNotFound(t *testing.T) {
+	t.Parallel()
+	client := fake.NewSimpleClientset(newTestConfigMap(testPolicy))
+	store := runTestStore(t, client)
+
+	err := store.Authorize(t.Context(), "team-c", testFQDN)
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, ErrForbidden)
+}
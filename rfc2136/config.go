@@ -0,0 +1,185 @@
+// Package rfc2136 implements DNS UPDATE (RFC 2136) frontend of TXT records
+// in Selectel DNS Hosting, so tools speaking RFC 2136, e.g. nsupdate, reuse
+// the provider of webhook. Updates must be signed with TSIG (RFC 8945).
+package rfc2136
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+	"sigs.k8s.io/yaml"
+)
+
+var (
+	errNoKeys            = errors.New("setup keys")
+	errNoZones           = errors.New("setup zones")
+	errUnknownAlgorithm  = errors.New("unknown tsig algorithm")
+	errUnknownKey        = errors.New("unknown key")
+	errDuplicateKey      = errors.New("duplicate key")
+	errDuplicateZone     = errors.New("duplicate zone")
+	errInvalidKeySecret  = errors.New("secret must be base64")
+	errInvalidDomainName = errors.New("invalid domain name")
+)
+
+// algorithms are TSIG algorithms supported by miekg/dns.
+var algorithms = map[string]bool{
+	dns.HmacSHA1:   true,
+	dns.HmacSHA224: true,
+	dns.HmacSHA256: true,
+	dns.HmacSHA384: true,
+	dns.HmacSHA512: true,
+}
+
+// Config is TSIG keys and zones accepting updates.
+type Config struct {
+	Keys  []Key  `json:"keys"`
+	Zones []Zone `json:"zones"`
+}
+
+// Key is TSIG key, e.g. generated with tsig-keygen.
+type Key struct {
+	Name string `json:"name"`
+	// Algorithm is hmac-sha256 by default.
+	Algorithm string `json:"algorithm,omitempty"`
+	// Secret is base64 encoded.
+	Secret string `json:"secret"`
+}
+
+// Zone maps zone of updates to zone in Selectel, names of records
+// are moved to Selectel zone, e.g. _acme-challenge.corp.example
+// of corp.example zone to _acme-challenge.example.com of example.com.
+type Zone struct {
+	Name string `json:"name"`
+	// SelectelZone is Name by default.
+	SelectelZone string `json:"selectelZone,omitempty"`
+	// Keys allowed to update the zone, any key by default.
+	Keys []string `json:"keys,omitempty"`
+}
+
+// ParseConfig decodes config from yaml or json and validates it,
+// names are made fully qualified.
+func ParseConfig(data []byte) (*Config, error) {
+	config := &Config{}
+	if err := yaml.UnmarshalStrict(data, config); err != nil {
+		return nil, fmt.Errorf("unmarshal rfc2136 config: %w", err)
+	}
+	if err := config.compile(); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+func (c *Config) compile() error {
+	if len(c.Keys) == 0 {
+		return errNoKeys
+	}
+	if len(c.Zones) == 0 {
+		return errNoZones
+	}
+	keys := map[string]bool{}
+	for i := range c.Keys {
+		key := &c.Keys[i]
+		if err := key.compile(); err != nil {
+			return fmt.Errorf("keys[%d]: %w", i, err)
+		}
+		if keys[key.Name] {
+			return fmt.Errorf("keys[%d]: %w: %s", i, errDuplicateKey, key.Name)
+		}
+		keys[key.Name] = true
+	}
+	zones := map[string]bool{}
+	for i := range c.Zones {
+		zone := &c.Zones[i]
+		if err := zone.compile(keys); err != nil {
+			return fmt.Errorf("zones[%d]: %w", i, err)
+		}
+		if zones[zone.Name] {
+			return fmt.Errorf("zones[%d]: %w: %s", i, errDuplicateZone, zone.Name)
+		}
+		zones[zone.Name] = true
+	}
+
+	return nil
+}
+
+func (k *Key) compile() error {
+	name, err := canonicalName(k.Name)
+	if err != nil {
+		return err
+	}
+	k.Name = name
+	if k.Algorithm == "" {
+		k.Algorithm = dns.HmacSHA256
+	}
+	k.Algorithm = dns.CanonicalName(k.Algorithm)
+	if !algorithms[k.Algorithm] {
+		return fmt.Errorf("%w: %s", errUnknownAlgorithm, k.Algorithm)
+	}
+	if _, err = base64.StdEncoding.DecodeString(k.Secret); err != nil || k.Secret == "" {
+		return errInvalidKeySecret
+	}
+
+	return nil
+}
+
+func (z *Zone) compile(keys map[string]bool) error {
+	name, err := canonicalName(z.Name)
+	if err != nil {
+		return err
+	}
+	z.Name = name
+	if z.SelectelZone == "" {
+		z.SelectelZone = z.Name
+	}
+	if z.SelectelZone, err = canonicalName(z.SelectelZone); err != nil {
+		return fmt.Errorf("selectelZone: %w", err)
+	}
+	for i, key := range z.Keys {
+		if z.Keys[i], err = canonicalName(key); err != nil {
+			return fmt.Errorf("keys[%d]: %w", i, err)
+		}
+		if !keys[z.Keys[i]] {
+			return fmt.Errorf("keys[%d]: %w: %s", i, errUnknownKey, key)
+		}
+	}
+
+	return nil
+}
+
+// allows reports whether zone may be updated with key.
+func (z *Zone) allows(key string) bool {
+	if len(z.Keys) == 0 {
+		return true
+	}
+	for _, allowed := range z.Keys {
+		if allowed == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+// selectelName moves name of zone to Selectel zone.
+func (z *Zone) selectelName(name string) string {
+	if z.Name == z.SelectelZone {
+		return name
+	}
+	if name == z.Name {
+		return z.SelectelZone
+	}
+
+	return strings.TrimSuffix(name, z.Name) + z.SelectelZone
+}
+
+func canonicalName(name string) (string, error) {
+	if _, ok := dns.IsDomainName(name); !ok || name == "" {
+		return "", fmt.Errorf("%w: %q", errInvalidDomainName, name)
+	}
+
+	return dns.CanonicalName(name), nil
+}
@@ -0,0 +1,110 @@
+package rfc2136
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseConfig(t *testing.T) {
+	t.Parallel()
+	config, err := ParseConfig([]byte(`
+keys:
+- name: external-dns
+  secret: c2VjcmV0
+- name: nsupdate.
+  algorithm: HMAC-SHA512
+  secret: c2VjcmV0
+zones:
+- name: Example.com
+  keys: [external-dns]
+- name: corp.example
+  selectelZone: example.org
+`))
+	require.NoError(t, err)
+	assert.Equal(t, &Config{
+		Keys: []Key{
+			{Name: "external-dns.", Algorithm: dns.HmacSHA256, Secret: "c2VjcmV0"},
+			{Name: "nsupdate.", Algorithm: dns.HmacSHA512, Secret: "c2VjcmV0"},
+		},
+		Zones: []Zone{
+			{Name: "example.com.", SelectelZone: "example.com.", Keys: []string{"external-dns."}},
+			{Name: "corp.example.", SelectelZone: "example.org."},
+		},
+	}, config)
+}
+
+func TestParseConfig_Invalid(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name          string
+		config        string
+		expectedError string
+	}{
+		{
+			name:          "no keys",
+			config:        "zones: [{name: example.com}]",
+			expectedError: "setup keys",
+		},
+		{
+			name:          "no zones",
+			config:        "keys: [{name: key, secret: c2VjcmV0}]",
+			expectedError: "setup zones",
+		},
+		{
+			name:          "unknown field",
+			config:        "keys: [{name: key, secret: c2VjcmV0}]\nzones: [{name: example.com, zone: example.org}]",
+			expectedError: `unmarshal rfc2136 config: error unmarshaling JSON: while decoding JSON: json: unknown field "zone"`,
+		},
+		{
+			name:          "unknown algorithm",
+			config:        "keys: [{name: key, algorithm: hmac-md5, secret: c2VjcmV0}]\nzones: [{name: example.com}]",
+			expectedError: "keys[0]: unknown tsig algorithm: hmac-md5.",
+		},
+		{
+			name:          "invalid secret",
+			config:        "keys: [{name: key, secret: not base64}]\nzones: [{name: example.com}]",
+			expectedError: "keys[0]: secret must be base64",
+		},
+		{
+			name:          "duplicate key",
+			config:        "keys: [{name: key, secret: c2VjcmV0}, {name: key., secret: c2VjcmV0}]\nzones: [{name: example.com}]",
+			expectedError: "keys[1]: duplicate key: key.",
+		},
+		{
+			name:          "unknown key of zone",
+			config:        "keys: [{name: key, secret: c2VjcmV0}]\nzones: [{name: example.com, keys: [other]}]",
+			expectedError: "zones[0]: keys[0]: unknown key: other",
+		},
+		{
+			name:          "duplicate zone",
+			config:        "keys: [{name: key, secret: c2VjcmV0}]\nzones: [{name: example.com}, {name: example.com.}]",
+			expectedError: "zones[1]: duplicate zone: example.com.",
+		},
+		{
+			name:          "invalid zone name",
+			config:        "keys: [{name: key, secret: c2VjcmV0}]\nzones: [{name: ''}]",
+			expectedError: `zones[0]: invalid domain name: ""`,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := ParseConfig([]byte(testCase.config))
+			require.Error(t, err)
+			assert.Equal(t, testCase.expectedError, err.Error())
+		})
+	}
+}
+
+func TestZone_SelectelName(t *testing.T) {
+	t.Parallel()
+	zone := Zone{Name: "corp.example.", SelectelZone: "example.com."}
+	assert.Equal(t, "_acme-challenge.www.example.com.", zone.selectelName("_acme-challenge.www.corp.example."))
+	assert.Equal(t, "example.com.", zone.selectelName("corp.example."))
+
+	zone = Zone{Name: "example.com.", SelectelZone: "example.com."}
+	assert.Equal(t, "_acme-challenge.example.com.", zone.selectelName("_acme-challenge.example.com."))
+}
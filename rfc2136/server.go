@@ -0,0 +1,295 @@
+package rfc2136
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/selectel/cert-manager-webhook-selectel/selectel"
+	domainsV2 "github.com/selectel/domains-go/pkg/v2"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// tsigFudge is allowed difference of time of signed messages.
+	tsigFudge = 300
+	// shutdownTimeout limits waiting for updates in progress on stop.
+	shutdownTimeout = 30 * time.Second
+)
+
+var (
+	errNotZone  = errors.New("name is outside of zone")
+	errNotTXT   = errors.New("only TXT records are supported")
+	errNotClass = errors.New("unsupported class of update")
+)
+
+// Provider changes TXT RRSets of Selectel zones, it is implemented by selectel.DNSProvider.
+type Provider interface {
+	Present(zoneName, fqdn, value string) error
+	CleanUp(zoneName, fqdn, value string) error
+	GetRRSet(ctx context.Context, zoneName, fqdn string) (*domainsV2.Zone, *domainsV2.RRSet, error)
+}
+
+// Server translates DNS UPDATE messages of TXT records into changes
+// of RRSets with Provider.
+type Server struct {
+	provider Provider
+	config   *Config
+}
+
+// NewServer returns server of zones in config.
+func NewServer(provider Provider, config *Config) *Server {
+	return &Server{provider: provider, config: config}
+}
+
+// update is change of TXT RRSet in Selectel zone.
+type update struct {
+	fqdn string
+	// value is empty if the whole RRSet is deleted.
+	value   string
+	present bool
+}
+
+// ServeDNS handles DNS UPDATE message, other opcodes are not implemented.
+func (s *Server) ServeDNS(w dns.ResponseWriter, request *dns.Msg) {
+	response := &dns.Msg{}
+	response.SetRcode(request, s.handle(w, request))
+	if tsig := request.IsTsig(); tsig != nil && w.TsigStatus() == nil && s.key(tsig) != nil {
+		response.SetTsig(tsig.Hdr.Name, tsig.Algorithm, tsigFudge, time.Now().Unix())
+	}
+	if err := w.WriteMsg(response); err != nil {
+		logf.Log.WithName("rfc2136").Error(err, "write response")
+	}
+}
+
+func (s *Server) handle(w dns.ResponseWriter, request *dns.Msg) int {
+	log := logf.Log.WithName("rfc2136").WithValues("remote", w.RemoteAddr().String())
+	if request.Opcode != dns.OpcodeUpdate {
+		return dns.RcodeNotImplemented
+	}
+	if len(request.Question) != 1 || request.Question[0].Qtype != dns.TypeSOA {
+		return dns.RcodeFormatError
+	}
+	tsig := request.IsTsig()
+	if tsig == nil || w.TsigStatus() != nil {
+		log.Info("update is not signed with known key", "error", w.TsigStatus())
+
+		return dns.RcodeNotAuth
+	}
+	if s.key(tsig) == nil {
+		log.Info("update is not signed with algorithm of key", "key", tsig.Hdr.Name, "algorithm", tsig.Algorithm)
+
+		return dns.RcodeNotAuth
+	}
+	zone := s.zone(request.Question[0].Name)
+	if zone == nil {
+		return dns.RcodeNotAuth
+	}
+	log = log.WithValues("zone", zone.Name, "key", tsig.Hdr.Name)
+	if !zone.allows(dns.CanonicalName(tsig.Hdr.Name)) {
+		log.Info("key is not allowed to update zone")
+
+		return dns.RcodeRefused
+	}
+	// prerequisites are not supported, tools updating TXT records don't use them
+	if len(request.Answer) > 0 {
+		return dns.RcodeNotImplemented
+	}
+	// all updates are checked before any change as in RFC 2136 section 3.4.1
+	updates := make([]update, 0, len(request.Ns))
+	for _, rr := range request.Ns {
+		u, err := parseUpdate(zone, rr)
+		if err != nil {
+			log.Info("update is refused", "record", rr.String(), "error", err.Error())
+			if errors.Is(err, errNotZone) {
+				return dns.RcodeNotZone
+			}
+
+			return dns.RcodeRefused
+		}
+		updates = append(updates, u)
+	}
+	for _, u := range updates {
+		if err := s.apply(zone, u); err != nil {
+			log.Error(err, "apply update", "fqdn", u.fqdn)
+
+			return dns.RcodeServerFailure
+		}
+		log.Info("applied update", "fqdn", u.fqdn, "present", u.present)
+	}
+
+	return dns.RcodeSuccess
+}
+
+// zone returns config of zone, nil if zone is not served.
+func (s *Server) zone(name string) *Zone {
+	name = dns.CanonicalName(name)
+	for i := range s.config.Zones {
+		if s.config.Zones[i].Name == name {
+			return &s.config.Zones[i]
+		}
+	}
+
+	return nil
+}
+
+// parseUpdate accepts addition and deletion of TXT records and deletion of TXT RRSet.
+func parseUpdate(zone *Zone, rr dns.RR) (update, error) {
+	header := rr.Header()
+	name := dns.CanonicalName(header.Name)
+	if !dns.IsSubDomain(zone.Name, name) {
+		return update{}, fmt.Errorf("%w: %s", errNotZone, name)
+	}
+	if header.Rrtype != dns.TypeTXT {
+		return update{}, fmt.Errorf("%w: %s", errNotTXT, dns.TypeToString[header.Rrtype])
+	}
+	u := update{fqdn: zone.selectelName(name)}
+	switch header.Class {
+	case dns.ClassINET:
+		u.present = true
+	case dns.ClassNONE:
+	case dns.ClassANY:
+		// the whole RRSet is deleted
+		if header.Rdlength == 0 {
+			return u, nil
+		}
+
+		return update{}, fmt.Errorf("%w: ANY with data", errNotClass)
+	default:
+		return update{}, fmt.Errorf("%w: %s", errNotClass, dns.ClassToString[header.Class])
+	}
+	txt, ok := rr.(*dns.TXT)
+	if !ok || len(txt.Txt) == 0 {
+		return update{}, fmt.Errorf("%w: TXT without data", errNotClass)
+	}
+	// strings of long value are joined like by ACME servers
+	u.value = strings.Join(txt.Txt, "")
+
+	return u, nil
+}
+
+func (s *Server) apply(zone *Zone, u update) error {
+	switch {
+	case u.present:
+		return s.provider.Present(zone.SelectelZone, u.fqdn, u.value) //nolint: wrapcheck
+	case u.value != "":
+		return s.provider.CleanUp(zone.SelectelZone, u.fqdn, u.value) //nolint: wrapcheck
+	}
+	_, rrset, err := s.provider.GetRRSet(context.Background(), zone.SelectelZone, u.fqdn)
+	if errors.Is(err, selectel.ErrRRSetNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err //nolint: wrapcheck
+	}
+	for _, record := range rrset.Records {
+		if err = s.provider.CleanUp(zone.SelectelZone, u.fqdn, strings.Trim(record.Content, `"`)); err != nil {
+			return err //nolint: wrapcheck
+		}
+	}
+
+	return nil
+}
+
+// key returns config of key signing message, nil if the key is unknown or
+// message is signed with another algorithm. miekg/dns verifies signature
+// with algorithm of message, so algorithm of key is checked here.
+func (s *Server) key(tsig *dns.TSIG) *Key {
+	name := dns.CanonicalName(tsig.Hdr.Name)
+	for i := range s.config.Keys {
+		if s.config.Keys[i].Name == name {
+			if s.config.Keys[i].Algorithm != dns.CanonicalName(tsig.Algorithm) {
+				return nil
+			}
+
+			return &s.config.Keys[i]
+		}
+	}
+
+	return nil
+}
+
+// tsigSecrets returns secrets of keys for miekg/dns server.
+func (s *Server) tsigSecrets() map[string]string {
+	secrets := make(map[string]string, len(s.config.Keys))
+	for _, key := range s.config.Keys {
+		secrets[key.Name] = key.Secret
+	}
+
+	return secrets
+}
+
+// acceptUpdate accepts DNS UPDATE messages, which are rejected by default
+// by miekg/dns, other requests are answered by ServeDNS.
+func acceptUpdate(header dns.Header) dns.MsgAcceptAction {
+	const responseBit = 1 << 15
+	if header.Bits&responseBit != 0 {
+		return dns.MsgIgnore
+	}
+
+	return dns.MsgAccept
+}
+
+// Serve handles updates on UDP and TCP listeners until ctx is canceled.
+func (s *Server) Serve(ctx context.Context, packetConn net.PacketConn, listener net.Listener) error {
+	servers := []*dns.Server{
+		{PacketConn: packetConn},
+		{Listener: listener},
+	}
+	errs := make(chan error, len(servers))
+	started := make(chan struct{}, len(servers))
+	for _, server := range servers {
+		server.Handler = s
+		server.TsigSecret = s.tsigSecrets()
+		server.MsgAcceptFunc = acceptUpdate
+		server.NotifyStartedFunc = func() { started <- struct{}{} }
+		go func() {
+			errs <- server.ActivateAndServe()
+		}()
+	}
+	// servers are shut down after start, otherwise they would serve forever
+	var err error
+	for range servers {
+		select {
+		case <-started:
+		case err = <-errs:
+		}
+	}
+	if err == nil {
+		select {
+		case <-ctx.Done():
+		case err = <-errs:
+		}
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	for _, server := range servers {
+		_ = server.ShutdownContext(shutdownCtx)
+	}
+	if err != nil {
+		return fmt.Errorf("serve dns: %w", err)
+	}
+
+	return nil
+}
+
+// ListenAndServe handles updates on UDP and TCP addr until ctx is canceled.
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	var listenConfig net.ListenConfig
+	packetConn, err := listenConfig.ListenPacket(ctx, "udp", addr)
+	if err != nil {
+		return fmt.Errorf("listen udp: %w", err)
+	}
+	listener, err := listenConfig.Listen(ctx, "tcp", addr)
+	if err != nil {
+		packetConn.Close()
+
+		return fmt.Errorf("listen tcp: %w", err)
+	}
+
+	return s.Serve(ctx, packetConn, listener)
+}
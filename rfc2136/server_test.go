@@ -0,0 +1,265 @@
+package rfc2136
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/selectel/cert-manager-webhook-selectel/internal/fakeselectel"
+	"github.com/selectel/cert-manager-webhook-selectel/selectel"
+	domainsV2 "github.com/selectel/domains-go/pkg/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testKey    = "external-dns."
+	testSecret = "c2VjcmV0LW9mLWV4dGVybmFsLWRucw=="
+	otherKey   = "other."
+)
+
+type testServer struct {
+	fake    *fakeselectel.Server
+	zoneID  string
+	addr    string
+	network string
+}
+
+// newTestServer serves example.com and corp.example mapped to example.com
+// with provider of fake Selectel API.
+func newTestServer(t *testing.T, network string) *testServer {
+	t.Helper()
+	fake := fakeselectel.NewServer()
+	t.Cleanup(fake.Close)
+	zoneID := fake.AddZone("example.com.")
+	providerConfig, err := selectel.NewConfigForDNS()
+	require.NoError(t, err)
+	providerConfig.BaseURL = fake.BaseURL()
+	providerConfig.AllowInsecureBaseURL = true
+	providerConfig.AuthURL = fake.AuthURL()
+	providerConfig.AllowInsecureAuthURL = true
+	providerConfig.CredentialsForDNS = selectel.CredentialsForDNS{
+		Username:  []byte("user"),
+		Password:  []byte("password"),
+		AccountID: []byte("123456"),
+		ProjectID: []byte("project-id"),
+	}
+	provider, err := selectel.NewDNSProviderFromConfig(providerConfig)
+	require.NoError(t, err)
+	config, err := ParseConfig([]byte(`
+keys:
+- name: external-dns
+  secret: ` + testSecret + `
+- name: other
+  secret: ` + testSecret + `
+zones:
+- name: example.com
+  keys: [external-dns]
+- name: corp.example
+  selectelZone: example.com
+`))
+	require.NoError(t, err)
+
+	packetConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := packetConn.LocalAddr().String()
+	if network == "tcp" {
+		addr = listener.Addr().String()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- NewServer(provider, config).Serve(ctx, packetConn, listener)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		assert.NoError(t, <-done)
+	})
+
+	return &testServer{fake: fake, zoneID: zoneID, addr: addr, network: network}
+}
+
+func (s *testServer) exchange(t *testing.T, message *dns.Msg, key string) *dns.Msg {
+	t.Helper()
+
+	return s.exchangeAlgorithm(t, message, key, dns.HmacSHA256)
+}
+
+func (s *testServer) exchangeAlgorithm(t *testing.T, message *dns.Msg, key, algorithm string) *dns.Msg {
+	t.Helper()
+	client := &dns.Client{
+		Net:        s.network,
+		TsigSecret: map[string]string{testKey: testSecret, otherKey: testSecret},
+		Timeout:    5 * time.Second,
+	}
+	if key != "" {
+		message.SetTsig(key, algorithm, tsigFudge, time.Now().Unix())
+	}
+	var (
+		response *dns.Msg
+		err      error
+	)
+	// server may not be ready to accept connections yet
+	require.Eventually(t, func() bool {
+		response, _, err = client.Exchange(message, s.addr)
+
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond, "exchange: %v", err)
+
+	return response
+}
+
+func newUpdate(t *testing.T, zone string, insert, remove []string) *dns.Msg {
+	t.Helper()
+	message := &dns.Msg{}
+	message.SetUpdate(zone)
+	for _, record := range insert {
+		rr, err := dns.NewRR(record)
+		require.NoError(t, err)
+		message.Insert([]dns.RR{rr})
+	}
+	for _, record := range remove {
+		rr, err := dns.NewRR(record)
+		require.NoError(t, err)
+		message.Remove([]dns.RR{rr})
+	}
+
+	return message
+}
+
+func TestServer_AddAndRemove(t *testing.T) {
+	t.Parallel()
+	for _, network := range []string{"udp", "tcp"} {
+		t.Run(network, func(t *testing.T) {
+			t.Parallel()
+			server := newTestServer(t, network)
+			fqdn := "_acme-challenge.example.com."
+
+			response := server.exchange(t, newUpdate(t, "example.com.", []string{
+				fqdn + ` 60 IN TXT "first"`,
+				fqdn + ` 60 IN TXT "second"`,
+			}, nil), testKey)
+			require.Equal(t, dns.RcodeSuccess, response.Rcode)
+			require.NotNil(t, response.IsTsig(), "response is signed")
+			rrsets := server.fake.RRSets(server.zoneID)
+			require.Len(t, rrsets, 1)
+			assert.Equal(t, []domainsV2.RecordItem{{Content: `"first"`}, {Content: `"second"`}}, rrsets[0].Records)
+
+			response = server.exchange(t, newUpdate(t, "example.com.", nil, []string{fqdn + ` 60 IN TXT "first"`}), testKey)
+			require.Equal(t, dns.RcodeSuccess, response.Rcode)
+			rrsets = server.fake.RRSets(server.zoneID)
+			require.Len(t, rrsets, 1)
+			assert.Equal(t, []domainsV2.RecordItem{{Content: `"second"`}}, rrsets[0].Records)
+		})
+	}
+}
+
+func TestServer_RemoveRRSet(t *testing.T) {
+	t.Parallel()
+	server := newTestServer(t, "udp")
+	fqdn := "_acme-challenge.www.example.com."
+	response := server.exchange(t, newUpdate(t, "example.com.", []string{
+		fqdn + ` 60 IN TXT "first"`,
+		fqdn + ` 60 IN TXT "second"`,
+	}, nil), testKey)
+	require.Equal(t, dns.RcodeSuccess, response.Rcode)
+
+	message := &dns.Msg{}
+	message.SetUpdate("example.com.")
+	rr, err := dns.NewRR(fqdn + " 0 IN TXT")
+	require.NoError(t, err)
+	message.RemoveRRset([]dns.RR{rr})
+	response = server.exchange(t, message, testKey)
+	require.Equal(t, dns.RcodeSuccess, response.Rcode)
+	assert.Empty(t, server.fake.RRSets(server.zoneID))
+
+	// RRSet which doesn't exist is deleted successfully
+	response = server.exchange(t, message, testKey)
+	assert.Equal(t, dns.RcodeSuccess, response.Rcode)
+}
+
+func TestServer_ZoneMapping(t *testing.T) {
+	t.Parallel()
+	server := newTestServer(t, "udp")
+
+	response := server.exchange(t, newUpdate(t, "corp.example.", []string{
+		`_acme-challenge.www.corp.example. 60 IN TXT "value"`,
+	}, nil), otherKey)
+	require.Equal(t, dns.RcodeSuccess, response.Rcode)
+	rrsets := server.fake.RRSets(server.zoneID)
+	require.Len(t, rrsets, 1)
+	assert.Equal(t, "_acme-challenge.www.example.com.", rrsets[0].Name)
+}
+
+func TestServer_Rejected(t *testing.T) {
+	t.Parallel()
+	server := newTestServer(t, "udp")
+	testCases := []struct {
+		name     string
+		message  *dns.Msg
+		key      string
+		expected int
+	}{
+		{
+			name:     "not signed",
+			message:  newUpdate(t, "example.com.", []string{`_acme-challenge.example.com. 60 IN TXT "value"`}, nil),
+			expected: dns.RcodeNotAuth,
+		},
+		{
+			name:     "key not allowed for zone",
+			message:  newUpdate(t, "example.com.", []string{`_acme-challenge.example.com. 60 IN TXT "value"`}, nil),
+			key:      otherKey,
+			expected: dns.RcodeRefused,
+		},
+		{
+			name:     "unknown zone",
+			message:  newUpdate(t, "example.org.", []string{`_acme-challenge.example.org. 60 IN TXT "value"`}, nil),
+			key:      testKey,
+			expected: dns.RcodeNotAuth,
+		},
+		{
+			name:     "name outside of zone",
+			message:  newUpdate(t, "example.com.", []string{`_acme-challenge.example.org. 60 IN TXT "value"`}, nil),
+			key:      testKey,
+			expected: dns.RcodeNotZone,
+		},
+		{
+			name: "not txt",
+			message: newUpdate(t, "example.com.", []string{
+				`_acme-challenge.example.com. 60 IN TXT "value"`,
+				`www.example.com. 60 IN A 127.0.0.1`,
+			}, nil),
+			key:      testKey,
+			expected: dns.RcodeRefused,
+		},
+		{
+			name:     "query",
+			message:  new(dns.Msg).SetQuestion("example.com.", dns.TypeTXT),
+			key:      testKey,
+			expected: dns.RcodeNotImplemented,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			response := server.exchange(t, testCase.message, testCase.key)
+			assert.Equal(t, testCase.expected, response.Rcode)
+		})
+	}
+	// nothing is changed by rejected updates
+	assert.Empty(t, server.fake.RRSets(server.zoneID))
+}
+
+func TestServer_RejectedAlgorithm(t *testing.T) {
+	t.Parallel()
+	server := newTestServer(t, "udp")
+	// signature with the right secret is valid, but key is hmac-sha256
+	message := newUpdate(t, "example.com.", []string{`_acme-challenge.example.com. 60 IN TXT "value"`}, nil)
+	response := server.exchangeAlgorithm(t, message, testKey, dns.HmacSHA512)
+	assert.Equal(t, dns.RcodeNotAuth, response.Rcode)
+	assert.Nil(t, response.IsTsig(), "response is not signed")
+	assert.Empty(t, server.fake.RRSets(server.zoneID))
+}
@@ -0,0 +1,50 @@
+#!/usr/bin/env sh
+# shellcheck disable=SC2034
+dns_selectel_dns_info='Selectel DNS Hosting (actual) with selectel-dns hook
+Site: github.com/selectel/cert-manager-webhook-selectel
+Options:
+ SELECTEL_DNS_BIN Path of selectel-dns binary. Default: "selectel-dns".
+ SELECTEL_DNS_CREDENTIALS_FILE File with credentials of service user. Optional, credentials are read from env if empty.
+'
+
+# Copy the script to ~/.acme.sh/dnsapi/ and issue certificate with
+#   acme.sh --issue --dns dns_selectel_dns -d example.com
+# Zone is detected from fqdn by selectel-dns, so it is not looked up here.
+
+########  Public functions #####################
+
+# Usage: dns_selectel_dns_add _acme-challenge.www.domain.com "XKrxpRBosdIKFzxW_CT3KLZNf6q0HG9i01zxXp5CPBs"
+dns_selectel_dns_add() {
+  fulldomain=$1
+  txtvalue=$2
+  _info "Adding record with selectel-dns"
+  _selectel_dns_hook add "$fulldomain" "$txtvalue"
+}
+
+# Usage: dns_selectel_dns_rm _acme-challenge.www.domain.com "XKrxpRBosdIKFzxW_CT3KLZNf6q0HG9i01zxXp5CPBs"
+dns_selectel_dns_rm() {
+  fulldomain=$1
+  txtvalue=$2
+  _info "Removing record with selectel-dns"
+  _selectel_dns_hook rm "$fulldomain" "$txtvalue"
+}
+
+####################  Private functions below ##################################
+
+_selectel_dns_hook() {
+  SELECTEL_DNS_BIN="${SELECTEL_DNS_BIN:-$(_readaccountconf_mutable SELECTEL_DNS_BIN)}"
+  SELECTEL_DNS_BIN="${SELECTEL_DNS_BIN:-selectel-dns}"
+  SELECTEL_DNS_CREDENTIALS_FILE="${SELECTEL_DNS_CREDENTIALS_FILE:-$(_readaccountconf_mutable SELECTEL_DNS_CREDENTIALS_FILE)}"
+  _saveaccountconf_mutable SELECTEL_DNS_BIN "$SELECTEL_DNS_BIN"
+  _saveaccountconf_mutable SELECTEL_DNS_CREDENTIALS_FILE "$SELECTEL_DNS_CREDENTIALS_FILE"
+
+  if [ -n "$SELECTEL_DNS_CREDENTIALS_FILE" ]; then
+    set -- "$@" --credentials-file "$SELECTEL_DNS_CREDENTIALS_FILE"
+  fi
+  _debug "Running $SELECTEL_DNS_BIN hook $*"
+  if ! "$SELECTEL_DNS_BIN" hook "$@"; then
+    _err "selectel-dns hook $1 failed for $2"
+    return 1
+  fi
+  return 0
+}
@@ -0,0 +1,218 @@
+package selectel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBreakerFailures    = 5
+	defaultBreakerOpenTimeout = 30 * time.Second
+)
+
+// CircuitState is state of circuit breaker of Selectel API endpoint.
+type CircuitState int
+
+const (
+	// CircuitClosed passes requests, consecutive failures open it.
+	CircuitClosed CircuitState = iota
+	// CircuitHalfOpen passes a single probe request after open timeout,
+	// its result closes or opens the circuit again.
+	CircuitHalfOpen
+	// CircuitOpen fails requests with ErrCircuitOpen without calling API.
+	CircuitOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitHalfOpen:
+		return "half-open"
+	case CircuitOpen:
+		return "open"
+	}
+
+	return "unknown"
+}
+
+// ErrCircuitOpen is returned without request to endpoint while its circuit is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// BreakerSettings of circuit breakers of Selectel API endpoints.
+type BreakerSettings struct {
+	// Failures in a row which open circuit, zero disables circuit breaker.
+	Failures int
+	// OpenTimeout after which a probe request is passed to endpoint.
+	OpenTimeout time.Duration
+}
+
+// DefaultBreakerSettings returns settings used unless they are set by webhook env.
+func DefaultBreakerSettings() BreakerSettings {
+	return BreakerSettings{
+		Failures:    defaultBreakerFailures,
+		OpenTimeout: defaultBreakerOpenTimeout,
+	}
+}
+
+// circuitBreakers are shared between providers, so outage of endpoint seen
+// by one challenge fails others fast.
+var circuitBreakers = newBreakerRegistry()
+
+// circuitBreaker counts outage failures of endpoint: server errors,
+// timeouts and connection errors. Other errors of API, e.g. not found
+// or rate limit, prove endpoint is up.
+type circuitBreaker struct {
+	endpoint string
+	settings BreakerSettings
+	now      func() time.Time
+
+	mu       sync.Mutex
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func newCircuitBreaker(endpoint string, settings BreakerSettings) *circuitBreaker {
+	breaker := &circuitBreaker{
+		endpoint: endpoint,
+		settings: settings,
+		now:      time.Now,
+	}
+	circuitState.WithLabelValues(endpoint).Set(float64(CircuitClosed))
+
+	return breaker
+}
+
+// allow returns ErrCircuitOpen if request must not be sent, otherwise
+// done must be called with result of request.
+func (b *circuitBreaker) allow() (func(err error), error) {
+	if b == nil {
+		return func(error) {}, nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == CircuitOpen && !b.now().Before(b.openedAt.Add(b.settings.OpenTimeout)) {
+		b.setState(CircuitHalfOpen)
+	}
+	switch {
+	case b.state == CircuitOpen:
+		circuitRejectedTotal.WithLabelValues(b.endpoint).Inc()
+		retryIn := b.openedAt.Add(b.settings.OpenTimeout).Sub(b.now()).Round(time.Second)
+
+		return nil, fmt.Errorf("%w for %s, retry in %s", ErrCircuitOpen, b.endpoint, retryIn)
+	case b.state == CircuitHalfOpen && b.probing:
+		circuitRejectedTotal.WithLabelValues(b.endpoint).Inc()
+
+		return nil, fmt.Errorf("%w for %s, probe request is in flight", ErrCircuitOpen, b.endpoint)
+	case b.state == CircuitHalfOpen:
+		b.probing = true
+	}
+
+	return b.done, nil
+}
+
+func (b *circuitBreaker) done(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	probe := b.state == CircuitHalfOpen && b.probing
+	b.probing = false
+	switch {
+	case b.state == CircuitOpen:
+		// result of request sent before circuit is opened
+	case isOutage(err):
+		b.failures++
+		if probe || b.failures >= b.settings.Failures {
+			b.openedAt = b.now()
+			b.setState(CircuitOpen)
+		}
+	case isCanceled(err) || errors.Is(err, ErrCircuitOpen):
+		// canceled request proves nothing, after canceled probe the next request is a probe
+	default:
+		b.failures = 0
+		b.setState(CircuitClosed)
+	}
+}
+
+func (b *circuitBreaker) setState(state CircuitState) {
+	b.state = state
+	circuitState.WithLabelValues(b.endpoint).Set(float64(state))
+}
+
+// State of circuit, open circuit is reported until a probe request is passed.
+func (b *circuitBreaker) State() CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state
+}
+
+// isOutage reports whether err shows endpoint is down.
+func isOutage(err error) bool {
+	var timeoutErr *TimeoutError
+	if errors.As(err, &timeoutErr) {
+		return true
+	}
+	if err == nil || isCanceled(err) {
+		return false
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return errors.Is(apiErr, ErrServer)
+	}
+	var netErr net.Error
+
+	return errors.As(err, &netErr)
+}
+
+// isCanceled reports whether request is canceled by context of caller,
+// e.g. while it waits for limiter.
+func isCanceled(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+type breakerRegistry struct {
+	mu       sync.Mutex
+	breakers map[string]*circuitBreaker
+}
+
+func newBreakerRegistry() *breakerRegistry {
+	return &breakerRegistry{breakers: map[string]*circuitBreaker{}}
+}
+
+// get returns circuit breaker of endpoint, it is replaced if settings are changed.
+func (r *breakerRegistry) get(endpoint string, settings BreakerSettings) *circuitBreaker {
+	if settings.Failures <= 0 {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	breaker, ok := r.breakers[endpoint]
+	if !ok || breaker.settings != settings {
+		breaker = newCircuitBreaker(endpoint, settings)
+		r.breakers[endpoint] = breaker
+	}
+
+	return breaker
+}
+
+func (r *breakerRegistry) states() map[string]CircuitState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	states := make(map[string]CircuitState, len(r.breakers))
+	for endpoint, breaker := range r.breakers {
+		states[endpoint] = breaker.State()
+	}
+
+	return states
+}
+
+// CircuitStates returns state of circuit breaker of every endpoint called by webhook.
+func CircuitStates() map[string]CircuitState {
+	return circuitBreakers.states()
+}
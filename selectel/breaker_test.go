@@ -0,0 +1,144 @@
+package selectel
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/selectel/cert-manager-webhook-selectel/internal/fakeselectel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/component-base/metrics/testutil"
+)
+
+var (
+	errTestServer   = &APIError{StatusCode: http.StatusBadGateway}
+	errTestNotFound = &APIError{StatusCode: http.StatusNotFound}
+)
+
+// testClock is a fake clock of circuit breaker.
+type testClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func newTestBreaker(endpoint string) (*circuitBreaker, *testClock) {
+	clock := &testClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	breaker := newCircuitBreaker(endpoint, BreakerSettings{Failures: 3, OpenTimeout: 30 * time.Second})
+	breaker.now = clock.Now
+
+	return breaker, clock
+}
+
+func requestThroughBreaker(t *testing.T, breaker *circuitBreaker, result error) error {
+	t.Helper()
+	done, err := breaker.allow()
+	if err != nil {
+		return err
+	}
+	done(result)
+
+	return result
+}
+
+func TestCircuitBreaker_States(t *testing.T) {
+	t.Parallel()
+	RegisterMetrics()
+	breaker, clock := newTestBreaker("https://states.example.com")
+
+	// not found proves endpoint is up and resets failures
+	require.ErrorIs(t, requestThroughBreaker(t, breaker, errTestServer), ErrServer)
+	require.ErrorIs(t, requestThroughBreaker(t, breaker, errTestServer), ErrServer)
+	require.ErrorIs(t, requestThroughBreaker(t, breaker, errTestNotFound), ErrNotFound)
+	require.ErrorIs(t, requestThroughBreaker(t, breaker, errTestServer), ErrServer)
+	require.ErrorIs(t, requestThroughBreaker(t, breaker, errTestServer), ErrServer)
+	assert.Equal(t, CircuitClosed, breaker.State())
+	require.ErrorIs(t, requestThroughBreaker(t, breaker, errTestServer), ErrServer)
+	assert.Equal(t, CircuitOpen, breaker.State())
+
+	err := requestThroughBreaker(t, breaker, nil)
+	require.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Equal(t, "CircuitOpen", ErrorReason(err))
+	assert.Equal(t, "circuit breaker is open for https://states.example.com, retry in 30s", err.Error())
+	state, err := testutil.GetGaugeMetricValue(circuitState.WithLabelValues("https://states.example.com"))
+	require.NoError(t, err)
+	assert.InDelta(t, float64(CircuitOpen), state, 0)
+
+	// failed probe opens circuit again
+	clock.Advance(30 * time.Second)
+	require.ErrorIs(t, requestThroughBreaker(t, breaker, errTestServer), ErrServer)
+	assert.Equal(t, CircuitOpen, breaker.State())
+	clock.Advance(29 * time.Second)
+	require.ErrorIs(t, requestThroughBreaker(t, breaker, nil), ErrCircuitOpen)
+
+	// successful probe closes circuit
+	clock.Advance(time.Second)
+	done, err := breaker.allow()
+	require.NoError(t, err)
+	assert.Equal(t, CircuitHalfOpen, breaker.State())
+	require.ErrorIs(t, requestThroughBreaker(t, breaker, nil), ErrCircuitOpen, "single probe in half-open")
+	done(nil)
+	assert.Equal(t, CircuitClosed, breaker.State())
+	require.NoError(t, requestThroughBreaker(t, breaker, nil))
+}
+
+func TestCircuitBreaker_CanceledProbe(t *testing.T) {
+	t.Parallel()
+	breaker, clock := newTestBreaker("https://canceled.example.com")
+	for range 3 {
+		_ = requestThroughBreaker(t, breaker, errTestServer)
+	}
+	clock.Advance(time.Minute)
+
+	require.ErrorIs(t, requestThroughBreaker(t, breaker, context.Canceled), context.Canceled)
+	assert.Equal(t, CircuitHalfOpen, breaker.State())
+	require.NoError(t, requestThroughBreaker(t, breaker, nil))
+	assert.Equal(t, CircuitClosed, breaker.State())
+}
+
+func TestIsOutage(t *testing.T) {
+	t.Parallel()
+	assert.True(t, isOutage(errTestServer))
+	assert.True(t, isOutage(&TimeoutError{Stage: TimeoutStageRequest, Err: context.DeadlineExceeded}))
+	assert.False(t, isOutage(errTestNotFound))
+	assert.False(t, isOutage(&APIError{StatusCode: http.StatusTooManyRequests}))
+	assert.False(t, isOutage(context.DeadlineExceeded))
+	assert.False(t, isOutage(errors.New("unknown")))
+	assert.False(t, isOutage(nil))
+}
+
+func TestAPIClient_CircuitOpen(t *testing.T) {
+	t.Parallel()
+	server := fakeselectel.NewServer()
+	t.Cleanup(server.Close)
+	client := newTestAPIClient(t, server)
+	client.maxRetries = 0
+	client.breaker = circuitBreakers.get(server.BaseURL(), BreakerSettings{Failures: 2, OpenTimeout: time.Minute})
+	server.FailRequests(http.StatusServiceUnavailable, 2)
+
+	for range 2 {
+		_, err := client.ListZones(t.Context(), &map[string]string{})
+		require.ErrorIs(t, err, ErrServer)
+	}
+	_, err := client.ListZones(t.Context(), &map[string]string{})
+	require.ErrorIs(t, err, ErrCircuitOpen)
+	assert.False(t, IsRetryable(err))
+	assert.Equal(t, 2, server.APIRequests())
+	assert.Equal(t, CircuitOpen, CircuitStates()[server.BaseURL()])
+}
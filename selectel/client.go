@@ -0,0 +1,181 @@
+package selectel
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	domainsV2 "github.com/selectel/domains-go/pkg/v2"
+)
+
+const (
+	defaultMaxRetries = 0
+	maxMaxRetries     = 10
+	retryBaseDelay    = time.Second
+	retryMaxDelay     = 30 * time.Second
+)
+
+// apiClient decorates Domains API client: it limits requests of account,
+// converts errors of responses to APIError and repeats requests failed
+// with retryable errors.
+type apiClient struct {
+	next       domainsV2.DNSClient[domainsV2.Zone, domainsV2.RRSet]
+	maxRetries int
+	baseDelay  time.Duration
+	// limiter is nil if requests are not limited.
+	limiter *accountLimiter
+	// breaker is nil if circuit breaker is disabled.
+	breaker *circuitBreaker
+}
+
+func newAPIClient(next domainsV2.DNSClient[domainsV2.Zone, domainsV2.RRSet], maxRetries int) *apiClient {
+	return &apiClient{
+		next:       next,
+		maxRetries: maxRetries,
+		baseDelay:  retryBaseDelay,
+	}
+}
+
+// call runs fn with retries, every attempt is checked by circuit breaker
+// and waits for limiter. Requests which are not idempotent, e.g. creation
+// of rrset, are repeated only when API has rejected them by rate limit.
+func call[T any](ctx context.Context, c *apiClient, idempotent bool, fn func(ctx context.Context) (T, error)) (T, error) {
+	var empty T
+	for attempt := 0; ; attempt++ {
+		done, err := c.breaker.allow()
+		if err != nil {
+			return empty, err
+		}
+		release, err := c.limiter.acquire(ctx)
+		if err != nil {
+			done(err)
+
+			return empty, err
+		}
+		infoCtx, info := withResponseInfo(ctx)
+		result, err := fn(infoCtx)
+		release()
+		err = toAPIError(err, info)
+		done(err)
+		if err == nil || attempt >= c.maxRetries || !c.shouldRetry(err, idempotent) {
+			return result, err
+		}
+		timer := time.NewTimer(c.retryDelay(err, attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+
+			return result, err
+		case <-timer.C:
+		}
+	}
+}
+
+func (c *apiClient) shouldRetry(err error, idempotent bool) bool {
+	if idempotent {
+		return IsRetryable(err)
+	}
+	apiErr, ok := err.(*APIError) //nolint: errorlint
+
+	return ok && apiErr.StatusCode == http.StatusTooManyRequests
+}
+
+// retryDelay grows exponentially unless API has asked to wait with Retry-After.
+func (c *apiClient) retryDelay(err error, attempt int) time.Duration {
+	if apiErr, ok := err.(*APIError); ok && apiErr.RetryAfter > 0 { //nolint: errorlint
+		return min(apiErr.RetryAfter, retryMaxDelay)
+	}
+
+	return min(c.baseDelay<<attempt, retryMaxDelay)
+}
+
+func (c *apiClient) GetZone(ctx context.Context, zoneID string, options *map[string]string) (*domainsV2.Zone, error) {
+	return call(ctx, c, true, func(ctx context.Context) (*domainsV2.Zone, error) {
+		return c.next.GetZone(ctx, zoneID, options)
+	})
+}
+
+func (c *apiClient) ListZones(ctx context.Context, options *map[string]string) (domainsV2.Listable[domainsV2.Zone], error) {
+	return call(ctx, c, true, func(ctx context.Context) (domainsV2.Listable[domainsV2.Zone], error) {
+		return c.next.ListZones(ctx, options)
+	})
+}
+
+func (c *apiClient) CreateZone(ctx context.Context, zone domainsV2.Creatable) (*domainsV2.Zone, error) {
+	return call(ctx, c, false, func(ctx context.Context) (*domainsV2.Zone, error) {
+		return c.next.CreateZone(ctx, zone)
+	})
+}
+
+func (c *apiClient) DeleteZone(ctx context.Context, zoneID string) error {
+	_, err := call(ctx, c, true, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, c.next.DeleteZone(ctx, zoneID)
+	})
+
+	return err
+}
+
+func (c *apiClient) UpdateZoneState(ctx context.Context, zoneID string, disabled bool) error {
+	_, err := call(ctx, c, true, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, c.next.UpdateZoneState(ctx, zoneID, disabled)
+	})
+
+	return err
+}
+
+func (c *apiClient) UpdateZoneComment(ctx context.Context, zoneID string, comment string) error {
+	_, err := call(ctx, c, true, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, c.next.UpdateZoneComment(ctx, zoneID, comment)
+	})
+
+	return err
+}
+
+func (c *apiClient) CreateRRSet(ctx context.Context, zoneID string, rrset domainsV2.Creatable) (*domainsV2.RRSet, error) {
+	return call(ctx, c, false, func(ctx context.Context) (*domainsV2.RRSet, error) {
+		return c.next.CreateRRSet(ctx, zoneID, rrset)
+	})
+}
+
+func (c *apiClient) GetRRSet(ctx context.Context, zoneID, rrsetID string) (*domainsV2.RRSet, error) {
+	return call(ctx, c, true, func(ctx context.Context) (*domainsV2.RRSet, error) {
+		return c.next.GetRRSet(ctx, zoneID, rrsetID)
+	})
+}
+
+func (c *apiClient) ListRRSets(ctx context.Context, zoneID string, options *map[string]string) (domainsV2.Listable[domainsV2.RRSet], error) {
+	return call(ctx, c, true, func(ctx context.Context) (domainsV2.Listable[domainsV2.RRSet], error) {
+		return c.next.ListRRSets(ctx, zoneID, options)
+	})
+}
+
+func (c *apiClient) UpdateRRSet(ctx context.Context, zoneID, rrsetID string, rrset domainsV2.Updatable) error {
+	_, err := call(ctx, c, true, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, c.next.UpdateRRSet(ctx, zoneID, rrsetID, rrset)
+	})
+
+	return err
+}
+
+func (c *apiClient) DeleteRRSet(ctx context.Context, zoneID, rrsetID string) error {
+	attempts := 0
+	_, err := call(ctx, c, true, func(ctx context.Context) (struct{}, error) {
+		attempts++
+
+		return struct{}{}, c.next.DeleteRRSet(ctx, zoneID, rrsetID)
+	})
+	// rrset is already deleted by the failed attempt, e.g. its response was lost
+	if attempts > 1 && errors.Is(err, ErrNotFound) {
+		return nil
+	}
+
+	return err
+}
+
+func (c *apiClient) WithHeaders(headers http.Header) domainsV2.DNSClient[domainsV2.Zone, domainsV2.RRSet] {
+	clone := *c
+	clone.next = c.next.WithHeaders(headers)
+
+	return &clone
+}
@@ -0,0 +1,142 @@
+package selectel
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/selectel/cert-manager-webhook-selectel/internal/fakeselectel"
+	domainsV2 "github.com/selectel/domains-go/pkg/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testMaxRetries = 2
+
+func newTestAPIClient(t *testing.T, server *fakeselectel.Server) *apiClient {
+	t.Helper()
+	dnsClient, err := getDNSClientFromConfig(newFakeServerConfig(t, server))
+	require.NoError(t, err)
+	client, ok := dnsClient.(*apiClient)
+	require.True(t, ok)
+	client.maxRetries = testMaxRetries
+	client.baseDelay = time.Millisecond
+
+	return client
+}
+
+func TestAPIClient_PermissionDenied(t *testing.T) {
+	t.Parallel()
+	server := fakeselectel.NewServer()
+	t.Cleanup(server.Close)
+	client := newTestAPIClient(t, server)
+	server.FailRequests(http.StatusForbidden, 1)
+
+	_, err := client.ListZones(t.Context(), &map[string]string{})
+	require.ErrorIs(t, err, ErrPermissionDenied)
+	assert.False(t, IsRetryable(err))
+	assert.Equal(t, "PermissionDenied", ErrorReason(err))
+	var apiErr *APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusForbidden, apiErr.StatusCode)
+	assert.Equal(t, "forbidden", apiErr.Code)
+	assert.Equal(t, "req-1", apiErr.RequestID)
+	assert.Equal(t, "selectel api error 403 forbidden (request id: req-1)", err.Error())
+	assert.Equal(t, 1, server.APIRequests())
+}
+
+func TestAPIClient_NotFoundKeepsDomainsError(t *testing.T) {
+	t.Parallel()
+	server := fakeselectel.NewServer()
+	t.Cleanup(server.Close)
+	client := newTestAPIClient(t, server)
+
+	_, err := client.GetZone(t.Context(), "unknown", nil)
+	require.ErrorIs(t, err, ErrNotFound)
+	assert.ErrorIs(t, err, domainsV2.ErrNotFound)
+}
+
+func TestAPIClient_RetriesServerError(t *testing.T) {
+	t.Parallel()
+	server := fakeselectel.NewServer()
+	t.Cleanup(server.Close)
+	server.AddZone("example.com.")
+	client := newTestAPIClient(t, server)
+	server.FailRequests(http.StatusServiceUnavailable, 2)
+
+	zones, err := client.ListZones(t.Context(), &map[string]string{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, zones.GetCount())
+	assert.Equal(t, 3, server.APIRequests())
+}
+
+func TestAPIClient_GivesUpAfterMaxRetries(t *testing.T) {
+	t.Parallel()
+	server := fakeselectel.NewServer()
+	t.Cleanup(server.Close)
+	client := newTestAPIClient(t, server)
+	server.FailRequests(http.StatusInternalServerError, testMaxRetries+1)
+
+	_, err := client.ListZones(t.Context(), &map[string]string{})
+	require.ErrorIs(t, err, ErrServer)
+	assert.True(t, IsRetryable(err))
+	assert.Equal(t, testMaxRetries+1, server.APIRequests())
+}
+
+func TestAPIClient_CreateRetriedOnlyOnRateLimit(t *testing.T) {
+	t.Parallel()
+	server := fakeselectel.NewServer()
+	t.Cleanup(server.Close)
+	zoneID := server.AddZone("example.com.")
+	client := newTestAPIClient(t, server)
+	rrset := &domainsV2.RRSet{
+		Name:    "_acme-challenge.example.com.",
+		Type:    domainsV2.TXT,
+		TTL:     minTTL,
+		Records: []domainsV2.RecordItem{{Content: `"value"`}},
+	}
+
+	server.FailRequests(http.StatusInternalServerError, 1)
+	_, err := client.CreateRRSet(t.Context(), zoneID, rrset)
+	require.ErrorIs(t, err, ErrServer)
+	assert.Equal(t, 1, server.APIRequests())
+
+	server.FailRequests(http.StatusTooManyRequests, 1)
+	_, err = client.CreateRRSet(t.Context(), zoneID, rrset)
+	require.NoError(t, err)
+	assert.Equal(t, 3, server.APIRequests())
+
+	_, err = client.CreateRRSet(t.Context(), zoneID, rrset)
+	require.ErrorIs(t, err, ErrConflict)
+	assert.Equal(t, "Conflict", ErrorReason(err))
+}
+
+func TestAPIClient_RetriedDeleteOfDeletedRRSet(t *testing.T) {
+	t.Parallel()
+	server := fakeselectel.NewServer()
+	t.Cleanup(server.Close)
+	zoneID := server.AddZone("example.com.")
+	client := newTestAPIClient(t, server)
+
+	err := client.DeleteRRSet(t.Context(), zoneID, "deleted")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	// rrset deleted by the first attempt is not found by retry
+	server.FailRequests(http.StatusServiceUnavailable, 1)
+	require.NoError(t, client.DeleteRRSet(t.Context(), zoneID, "deleted"))
+	assert.Equal(t, 3, server.APIRequests())
+}
+
+func TestAPIClient_RetryDelay(t *testing.T) {
+	t.Parallel()
+	client := newAPIClient(nil, testMaxRetries)
+
+	assert.Equal(t, retryBaseDelay, client.retryDelay(errors.New("test"), 0)) //nolint: err113
+	assert.Equal(t, 4*retryBaseDelay, client.retryDelay(&APIError{StatusCode: http.StatusBadGateway}, 2))
+	assert.Equal(t, retryMaxDelay, client.retryDelay(&APIError{StatusCode: http.StatusBadGateway}, 10))
+	assert.Equal(t, 5*time.Second, client.retryDelay(&APIError{
+		StatusCode: http.StatusTooManyRequests,
+		RetryAfter: 5 * time.Second,
+	}, 0))
+}
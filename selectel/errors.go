@@ -0,0 +1,256 @@
+package selectel
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	domainsV2 "github.com/selectel/domains-go/pkg/v2"
+)
+
+const (
+	headerRequestID  = "X-Request-Id"
+	headerRetryAfter = "Retry-After"
+)
+
+// Classes of Selectel API errors, use errors.Is to check the class of APIError.
+var (
+	ErrUnauthorized     = errors.New("unauthorized")
+	ErrPermissionDenied = errors.New("permission denied")
+	ErrNotFound         = errors.New("not found")
+	ErrConflict         = errors.New("conflict")
+	ErrRateLimited      = errors.New("rate limited")
+	ErrValidation       = errors.New("validation failed")
+	ErrServer           = errors.New("server error")
+)
+
+// APIError is an error response of Keystone or Domains API.
+type APIError struct {
+	StatusCode int
+	// Code is Selectel error code, e.g. "bad_request".
+	Code        string
+	Description string
+	Location    string
+	// RequestID identifies the request in Selectel support.
+	RequestID  string
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("selectel api error %d", e.StatusCode)
+	if e.Code != "" {
+		msg += " " + e.Code
+	}
+	if e.Description != "" {
+		msg += ": " + e.Description
+	}
+	if e.Location != "" {
+		msg += fmt.Sprintf(" (location: %s)", e.Location)
+	}
+	if e.RequestID != "" {
+		msg += fmt.Sprintf(" (request id: %s)", e.RequestID)
+	}
+
+	return msg
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// Is matches the error with its class by status code.
+func (e *APIError) Is(target error) bool {
+	class := e.class()
+
+	return class != nil && class == target //nolint: errorlint
+}
+
+// Retryable reports whether the request may succeed if it is sent again.
+func (e *APIError) Retryable() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= http.StatusInternalServerError
+}
+
+func (e *APIError) class() error {
+	switch {
+	case e.StatusCode == http.StatusUnauthorized:
+		return ErrUnauthorized
+	case e.StatusCode == http.StatusForbidden:
+		return ErrPermissionDenied
+	case e.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case e.StatusCode == http.StatusConflict:
+		return ErrConflict
+	case e.StatusCode == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case e.StatusCode == http.StatusBadRequest || e.StatusCode == http.StatusUnprocessableEntity:
+		return ErrValidation
+	case e.StatusCode >= http.StatusInternalServerError:
+		return ErrServer
+	}
+
+	return nil
+}
+
+// ErrorReason returns short CamelCase reason of err, it is result label of
+// selectel_api_challenges_total and reason of events of failed challenges.
+func ErrorReason(err error) string {
+	var timeoutErr *TimeoutError
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, ErrCircuitOpen):
+		return "CircuitOpen"
+	case errors.As(err, &timeoutErr):
+		return "Timeout"
+	case errors.Is(err, ErrUnauthorized):
+		return "Unauthorized"
+	case errors.Is(err, ErrPermissionDenied):
+		return "PermissionDenied"
+	case errors.Is(err, ErrNotFound):
+		return "NotFound"
+	case errors.Is(err, ErrConflict):
+		return "Conflict"
+	case errors.Is(err, ErrRateLimited):
+		return "RateLimited"
+	case errors.Is(err, ErrValidation):
+		return "ValidationFailed"
+	case errors.Is(err, ErrServer):
+		return "ServerError"
+	}
+
+	return "Unknown"
+}
+
+// IsRetryable reports whether the failed request may succeed if it is sent again.
+func IsRetryable(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Retryable()
+	}
+	var timeoutErr *TimeoutError
+
+	return errors.As(err, &timeoutErr)
+}
+
+// responseInfo is filled by responseInfoTransport with details of the last response,
+// which are not returned by domains-go client.
+type responseInfo struct {
+	mu         sync.Mutex
+	statusCode int
+	requestID  string
+	retryAfter time.Duration
+}
+
+type responseInfoKey struct{}
+
+func withResponseInfo(ctx context.Context) (context.Context, *responseInfo) {
+	info := &responseInfo{}
+
+	return context.WithValue(ctx, responseInfoKey{}, info), info
+}
+
+// responseInfoTransport records status, request id and Retry-After of responses
+// to responseInfo of request context.
+type responseInfoTransport struct {
+	next http.RoundTripper
+}
+
+func (t *responseInfoTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	response, err := t.next.RoundTrip(request)
+	if err != nil {
+		return nil, err //nolint: wrapcheck
+	}
+	if info, ok := request.Context().Value(responseInfoKey{}).(*responseInfo); ok {
+		info.mu.Lock()
+		info.statusCode = response.StatusCode
+		info.requestID = response.Header.Get(headerRequestID)
+		info.retryAfter = parseRetryAfter(response.Header.Get(headerRetryAfter))
+		info.mu.Unlock()
+	}
+
+	return response, nil
+}
+
+// toAPIError converts error of domains-go client to APIError with details of response.
+func toAPIError(err error, info *responseInfo) error {
+	if err == nil {
+		return nil
+	}
+	info.mu.Lock()
+	defer info.mu.Unlock()
+
+	var badResponseErr *domainsV2.BadResponseError
+	switch {
+	case errors.As(err, &badResponseErr):
+		return &APIError{
+			StatusCode:  badResponseErr.Code,
+			Code:        badResponseErr.ErrorMsg,
+			Description: badResponseErr.Description,
+			Location:    badResponseErr.Location,
+			RequestID:   info.requestID,
+			RetryAfter:  info.retryAfter,
+			Err:         err,
+		}
+	case errors.Is(err, domainsV2.ErrNotFound):
+		return &APIError{StatusCode: http.StatusNotFound, RequestID: info.requestID, Err: err}
+	case info.statusCode >= http.StatusBadRequest:
+		// body of error response is not json, e.g. from a proxy
+		return &APIError{
+			StatusCode:  info.statusCode,
+			Description: err.Error(),
+			RequestID:   info.requestID,
+			RetryAfter:  info.retryAfter,
+			Err:         err,
+		}
+	}
+
+	return err
+}
+
+// keystoneAPIError converts error response of Keystone to APIError.
+func keystoneAPIError(err error) error {
+	var responseErr gophercloud.ErrUnexpectedResponseCode
+	if !errors.As(err, &responseErr) {
+		return err
+	}
+
+	apiErr := &APIError{
+		StatusCode:  responseErr.Actual,
+		Description: strings.TrimSpace(string(responseErr.Body)),
+		RequestID:   responseErr.ResponseHeader.Get(headerRequestID),
+		RetryAfter:  parseRetryAfter(responseErr.ResponseHeader.Get(headerRetryAfter)),
+		Err:         err,
+	}
+	var body keystoneErrorBody
+	if json.Unmarshal(responseErr.Body, &body) == nil && body.Error.Message != "" {
+		apiErr.Code = body.Error.Title
+		apiErr.Description = body.Error.Message
+	}
+
+	return apiErr
+}
+
+type keystoneErrorBody struct {
+	Error struct {
+		Title   string `json:"title"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// parseRetryAfter supports only delay in seconds, Selectel API doesn't send dates.
+func parseRetryAfter(value string) time.Duration {
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds < 0 {
+		return 0
+	}
+
+	return time.Duration(seconds) * time.Second
+}
@@ -0,0 +1,89 @@
+package selectel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	domainsV2 "github.com/selectel/domains-go/pkg/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrorReason(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		err    error
+		reason string
+	}{
+		{nil, ""},
+		{&APIError{StatusCode: http.StatusUnauthorized}, "Unauthorized"},
+		{&APIError{StatusCode: http.StatusForbidden}, "PermissionDenied"},
+		{&APIError{StatusCode: http.StatusNotFound}, "NotFound"},
+		{&APIError{StatusCode: http.StatusConflict}, "Conflict"},
+		{&APIError{StatusCode: http.StatusTooManyRequests}, "RateLimited"},
+		{&APIError{StatusCode: http.StatusBadRequest}, "ValidationFailed"},
+		{&APIError{StatusCode: http.StatusUnprocessableEntity}, "ValidationFailed"},
+		{&APIError{StatusCode: http.StatusBadGateway}, "ServerError"},
+		{fmt.Errorf("wrapped: %w", &APIError{StatusCode: http.StatusForbidden}), "PermissionDenied"},
+		{&TimeoutError{Stage: TimeoutStageAuth, Err: context.DeadlineExceeded}, "Timeout"},
+		{&APIError{StatusCode: http.StatusTeapot}, "Unknown"},
+		{errors.New("test"), "Unknown"}, //nolint: err113
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.reason, ErrorReason(test.err), test.err)
+	}
+}
+
+func TestToAPIError_NotJSONErrorResponse(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set(headerRequestID, "proxy-request")
+		w.Header().Set(headerRetryAfter, "7")
+		w.WriteHeader(http.StatusBadGateway)
+		_, _ = io.WriteString(w, "<html>bad gateway</html>")
+	}))
+	t.Cleanup(server.Close)
+	httpClient := &http.Client{Transport: &responseInfoTransport{next: http.DefaultTransport}}
+	client := domainsV2.NewClient(server.URL, httpClient, http.Header{})
+
+	ctx, info := withResponseInfo(t.Context())
+	_, err := client.ListZones(ctx, &map[string]string{})
+	err = toAPIError(err, info)
+
+	require.ErrorIs(t, err, ErrServer)
+	var apiErr *APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, "proxy-request", apiErr.RequestID)
+	assert.Equal(t, 7*time.Second, apiErr.RetryAfter)
+}
+
+func TestAuthenticate_KeystoneError(t *testing.T) {
+	t.Parallel()
+	keystone := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set(headerRequestID, "keystone-request")
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = io.WriteString(w, `{"error": {"code": 401, "title": "Unauthorized", "message": "The request you have made requires authentication."}}`)
+	}))
+	t.Cleanup(keystone.Close)
+	config, err := NewConfigForDNS()
+	require.NoError(t, err)
+	config.AuthURL = keystone.URL + "/identity/v3/"
+	config.CredentialsForDNS = CredentialsForDNS{
+		Username:  []byte("user"),
+		Password:  []byte("wrong-password"),
+		AccountID: []byte("123456"),
+		ProjectID: []byte("project-id"),
+	}
+
+	_, err = authenticate(t.Context(), config, http.DefaultClient)
+	require.ErrorIs(t, err, ErrUnauthorized)
+	assert.Equal(t, "keystone authentication: selectel api error 401 Unauthorized: "+
+		"The request you have made requires authentication. (request id: keystone-request)", err.Error())
+}
@@ -0,0 +1,114 @@
+package selectel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/selectel/cert-manager-webhook-selectel/selectel/internal"
+	domainsV2 "github.com/selectel/domains-go/pkg/v2"
+)
+
+var (
+	// ErrZoneNotFound is returned when zone is not found in any project of credentials.
+	ErrZoneNotFound = internal.ErrZoneNotFound
+	// ErrRRSetNotFound is returned when TXT RRSet is not found in zone.
+	ErrRRSetNotFound = internal.ErrRrsetNotFound
+)
+
+// ListZones returns zones of all projects of credentials.
+func (d *DNSProvider) ListZones(ctx context.Context) ([]*domainsV2.Zone, error) {
+	result := []*domainsV2.Zone{}
+	for _, projectID := range d.config.projectIDs() {
+		dnsClient, err := d.projectClient(projectID)
+		if err != nil {
+			return nil, err
+		}
+		zones, err := internal.ListZones(ctx, dnsClient)
+		if err != nil {
+			return nil, fmt.Errorf("list zones of project %s: %w", projectID, err)
+		}
+		result = append(result, zones...)
+	}
+
+	return result, nil
+}
+
+// GetZone returns zone by name like Present looks it up.
+func (d *DNSProvider) GetZone(ctx context.Context, zoneName string) (*domainsV2.Zone, error) {
+	_, zone, err := d.findZone(ctx, zoneName)
+	if err != nil {
+		return nil, fmt.Errorf("get zone by name: %w", err)
+	}
+
+	return zone, nil
+}
+
+// GetRRSet returns zone and TXT RRSet fqdn in it.
+func (d *DNSProvider) GetRRSet(ctx context.Context, zoneName, fqdn string) (*domainsV2.Zone, *domainsV2.RRSet, error) {
+	dnsClient, zone, err := d.findZone(ctx, zoneName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("get zone by name: %w", err)
+	}
+	rrset, err := internal.GetRrsetByNameAndType(ctx, dnsClient, zone.ID, fqdn, string(domainsV2.TXT))
+	if err != nil {
+		return zone, nil, fmt.Errorf("get rrset by name: %w", err)
+	}
+
+	return zone, rrset, nil
+}
+
+// HasRecord reports whether TXT RRSet rrsetID of zone zoneID still has value,
+// e.g. record created by PresentRecord. Zone is looked up by name to pick
+// its project, recreated zone with another id doesn't have the record.
+func (d *DNSProvider) HasRecord(ctx context.Context, zoneName, zoneID, rrsetID, value string) (bool, error) {
+	dnsClient, zone, err := d.findZone(ctx, zoneName)
+	if errors.Is(err, ErrZoneNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("get zone by name: %w", err)
+	}
+	if zone.ID != zoneID {
+		return false, nil
+	}
+	rrset, err := dnsClient.GetRRSet(ctx, zoneID, rrsetID)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("get rrset: %w", err)
+	}
+	// Escaping quotes in TXT record
+	content := fmt.Sprintf("\"%s\"", value)
+	for _, record := range rrset.Records {
+		if record.Content == content {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// FindZone returns the longest zone containing fqdn, e.g. example.com
+// for _acme-challenge.www.example.com.
+func (d *DNSProvider) FindZone(ctx context.Context, fqdn string) (*domainsV2.Zone, error) {
+	labels := strings.Split(normalizeZoneName(fqdn), ".")
+	for i := range len(labels) - 1 {
+		candidate := strings.Join(labels[i:], ".")
+		_, zone, err := d.findZone(ctx, candidate+".")
+		if errors.Is(err, ErrZoneNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		// search by name matches zones with the same prefix too
+		if normalizeZoneName(zone.Name) == candidate {
+			return zone, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w for %s", ErrZoneNotFound, fqdn)
+}
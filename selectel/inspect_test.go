@@ -0,0 +1,109 @@
+package selectel
+
+import (
+	"testing"
+
+	"github.com/selectel/cert-manager-webhook-selectel/internal/fakeselectel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDNSProvider_ListZones(t *testing.T) {
+	t.Parallel()
+	server := fakeselectel.NewServer()
+	t.Cleanup(server.Close)
+	server.AddProjectZone("project-a", "a.example.com.")
+	server.AddProjectZone("project-b", "b.example.com.")
+	config := newFakeServerConfig(t, server)
+	config.CredentialsForDNS.ProjectID = nil
+	config.CredentialsForDNS.ProjectIDs = []byte("project-a,project-b")
+	provider, err := NewDNSProviderFromConfig(config)
+	require.NoError(t, err)
+
+	zones, err := provider.ListZones(t.Context())
+	require.NoError(t, err)
+	require.Len(t, zones, 2)
+	assert.Equal(t, "a.example.com.", zones[0].Name)
+	assert.Equal(t, "b.example.com.", zones[1].Name)
+}
+
+func TestDNSProvider_GetZone(t *testing.T) {
+	t.Parallel()
+	server := fakeselectel.NewServer()
+	t.Cleanup(server.Close)
+	zoneID := server.AddZone("example.com.")
+	provider, err := NewDNSProviderFromConfig(newFakeServerConfig(t, server))
+	require.NoError(t, err)
+
+	zone, err := provider.GetZone(t.Context(), "example.com.")
+	require.NoError(t, err)
+	assert.Equal(t, zoneID, zone.ID)
+	_, err = provider.GetZone(t.Context(), "example.org.")
+	require.ErrorIs(t, err, ErrZoneNotFound)
+}
+
+func TestDNSProvider_GetRRSet(t *testing.T) {
+	t.Parallel()
+	server := fakeselectel.NewServer()
+	t.Cleanup(server.Close)
+	zoneID := server.AddZone("example.com.")
+	provider, err := NewDNSProviderFromConfig(newFakeServerConfig(t, server))
+	require.NoError(t, err)
+
+	_, _, err = provider.GetRRSet(t.Context(), "example.com.", testFQDN)
+	require.ErrorIs(t, err, ErrRRSetNotFound)
+	_, _, err = provider.GetRRSet(t.Context(), "example.org.", testFQDN)
+	require.ErrorIs(t, err, ErrZoneNotFound)
+
+	require.NoError(t, provider.Present("example.com.", testFQDN, "value"))
+	zone, rrset, err := provider.GetRRSet(t.Context(), "example.com.", testFQDN)
+	require.NoError(t, err)
+	assert.Equal(t, zoneID, zone.ID)
+	assert.Equal(t, `"value"`, rrset.Records[0].Content)
+}
+
+func TestDNSProvider_HasRecord(t *testing.T) {
+	t.Parallel()
+	server := fakeselectel.NewServer()
+	t.Cleanup(server.Close)
+	zoneID := server.AddZone("example.com.")
+	provider, err := NewDNSProviderFromConfig(newFakeServerConfig(t, server))
+	require.NoError(t, err)
+
+	record, err := provider.PresentRecord("example.com.", testFQDN, "value")
+	require.NoError(t, err)
+	found, err := provider.HasRecord(t.Context(), "example.com.", record.ZoneID, record.RRSetID, "value")
+	require.NoError(t, err)
+	assert.True(t, found)
+	found, err = provider.HasRecord(t.Context(), "example.com.", record.ZoneID, record.RRSetID, "other")
+	require.NoError(t, err)
+	assert.False(t, found)
+	found, err = provider.HasRecord(t.Context(), "example.com.", "another-zone", record.RRSetID, "value")
+	require.NoError(t, err)
+	assert.False(t, found, "zone is recreated")
+
+	require.NoError(t, provider.CleanUp("example.com.", testFQDN, "value"))
+	found, err = provider.HasRecord(t.Context(), "example.com.", zoneID, record.RRSetID, "value")
+	require.NoError(t, err)
+	assert.False(t, found)
+	found, err = provider.HasRecord(t.Context(), "example.org.", zoneID, record.RRSetID, "value")
+	require.NoError(t, err)
+	assert.False(t, found)
+}
+
+func TestDNSProvider_FindZone(t *testing.T) {
+	t.Parallel()
+	server := fakeselectel.NewServer()
+	t.Cleanup(server.Close)
+	server.AddZone("www.example.com.au.")
+	zoneID := server.AddZone("example.com.")
+	provider, err := NewDNSProviderFromConfig(newFakeServerConfig(t, server))
+	require.NoError(t, err)
+
+	zone, err := provider.FindZone(t.Context(), "_acme-challenge.www.example.com.")
+	require.NoError(t, err)
+	assert.Equal(t, zoneID, zone.ID)
+
+	_, err = provider.FindZone(t.Context(), "_acme-challenge.example.org.")
+	require.ErrorIs(t, err, ErrZoneNotFound)
+}
@@ -50,3 +50,26 @@ func GetZoneByName(ctx context.Context, client domainsV2.DNSClient[domainsV2.Zon
 
 	return nil, ErrZoneNotFound
 }
+
+// ListZones returns all zones visible to client.
+func ListZones(ctx context.Context, client domainsV2.DNSClient[domainsV2.Zone, domainsV2.RRSet]) ([]*domainsV2.Zone, error) {
+	optsForListZones := map[string]string{
+		"limit":  "100",
+		"offset": "0",
+	}
+	result := []*domainsV2.Zone{}
+	for {
+		zones, err := client.ListZones(ctx, &optsForListZones)
+		if err != nil {
+			return nil, fmt.Errorf("list zones: %w", err)
+		}
+		result = append(result, zones.GetItems()...)
+
+		optsForListZones["offset"] = strconv.Itoa(zones.GetNextOffset())
+		if zones.GetNextOffset() == 0 {
+			break
+		}
+	}
+
+	return result, nil
+}
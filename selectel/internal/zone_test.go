@@ -114,3 +114,27 @@ func TestGetZoneByNameWithOffset(t *testing.T) {
 	assert.Equal(t, correctIDForSearch, zone.ID)
 	assert.Equal(t, testZoneName, zone.Name)
 }
+
+func TestListZonesWithOffset(t *testing.T) {
+	t.Parallel()
+	mDNSClient := new(mockedDNSv2ClientZones)
+	ctx := t.Context()
+	firstPage := domainsV2.Listable[domainsV2.Zone](domainsV2.List[domainsV2.Zone]{
+		Count:      2,
+		NextOffset: 1,
+		Items:      []*domainsV2.Zone{{ID: incorrectIDForSearch, Name: "a." + testZoneName}},
+	})
+	secondPage := domainsV2.Listable[domainsV2.Zone](domainsV2.List[domainsV2.Zone]{
+		Count:      2,
+		NextOffset: 0,
+		Items:      []*domainsV2.Zone{{ID: correctIDForSearch, Name: testZoneName}},
+	})
+	mDNSClient.On("ListZones", ctx, &map[string]string{"limit": "100", "offset": "0"}).Return(firstPage, nil)
+	mDNSClient.On("ListZones", ctx, &map[string]string{"limit": "100", "offset": "1"}).Return(secondPage, nil)
+
+	zones, err := ListZones(ctx, mDNSClient)
+	require.NoError(t, err)
+	require.Len(t, zones, 2)
+	assert.Equal(t, incorrectIDForSearch, zones[0].ID)
+	assert.Equal(t, correctIDForSearch, zones[1].ID)
+}
@@ -0,0 +1,90 @@
+package selectel
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack"
+)
+
+// Service type of Domains API in Keystone service catalog,
+// used to discover base url when it is not set.
+const domainsServiceType = "dns"
+
+// keystoneAuthOptions builds token scope from config the way selvpcclient does:
+// project scope if project is set, account scope otherwise.
+// selvpcclient.NewClient can't be used, its ClientOptions have no http client,
+// so it would authenticate without proxy and TLS settings of config.
+func keystoneAuthOptions(config *Config) gophercloud.AuthOptions {
+	authOptions := gophercloud.AuthOptions{
+		IdentityEndpoint: config.AuthURL,
+		Username:         string(config.CredentialsForDNS.Username),
+		Password:         string(config.CredentialsForDNS.Password),
+		DomainName:       string(config.CredentialsForDNS.AccountID),
+		Scope: &gophercloud.AuthScope{
+			ProjectID: string(config.CredentialsForDNS.ProjectID),
+		},
+	}
+	if authOptions.Scope.ProjectID == "" {
+		authOptions.Scope.DomainName = authOptions.DomainName
+	}
+
+	return authOptions
+}
+
+// authenticate issues Keystone token using httpClient, so proxy and TLS settings
+// of Domains API client are applied to identity endpoint too.
+// The whole authentication is limited by auth timeout and fails fast
+// while circuit of identity endpoint is open.
+func authenticate(ctx context.Context, config *Config, httpClient *http.Client) (*gophercloud.ProviderClient, error) {
+	done, err := circuitBreakers.get(config.AuthURL, config.Breaker).allow()
+	if err != nil {
+		return nil, fmt.Errorf("keystone authentication: %w", err)
+	}
+	provider, err := authenticateWithTimeout(ctx, config, httpClient)
+	done(err)
+
+	return provider, err
+}
+
+func authenticateWithTimeout(ctx context.Context, config *Config, httpClient *http.Client) (*gophercloud.ProviderClient, error) {
+	authTimeout := time.Duration(config.AuthTimeout) * time.Second
+	authCtx, cancel := context.WithTimeout(ctx, authTimeout)
+	defer cancel()
+	provider, err := openstack.NewClient(config.AuthURL)
+	if err != nil {
+		return nil, fmt.Errorf("setup keystone client: %w", err)
+	}
+	provider.HTTPClient = *httpClient
+	provider.Context = authCtx
+	provider.UserAgent.Prepend(userAgent)
+
+	err = openstack.Authenticate(provider, keystoneAuthOptions(config))
+	if err != nil {
+		err = wrapTimeout(authCtx, keystoneAPIError(err), TimeoutStageAuth, authTimeout)
+
+		return nil, fmt.Errorf("keystone authentication: %w", err)
+	}
+	// token is issued, auth context must not be used after cancel
+	provider.Context = ctx
+
+	return provider, nil
+}
+
+// discoverBaseURL finds public endpoint of Domains API in service catalog of the token.
+func discoverBaseURL(provider *gophercloud.ProviderClient, region string) (string, error) {
+	endpoint, err := provider.EndpointLocator(gophercloud.EndpointOpts{
+		Type:         domainsServiceType,
+		Region:       region,
+		Availability: gophercloud.AvailabilityPublic,
+	})
+	if err != nil {
+		return "", fmt.Errorf("find %s endpoint in region %s: %w", domainsServiceType, region, err)
+	}
+
+	return strings.TrimSuffix(endpoint, "/"), nil
+}
@@ -0,0 +1,91 @@
+package selectel
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-acme/lego/v4/challenge"
+	"github.com/go-acme/lego/v4/challenge/dns01"
+)
+
+const (
+	defaultLegoPropagationTimeout = 2 * time.Minute
+	defaultLegoPollingInterval    = dns01.DefaultPollingInterval
+)
+
+var _ challenge.ProviderTimeout = (*LegoProvider)(nil)
+
+// LegoProvider implements challenge.Provider and challenge.ProviderTimeout
+// of lego with DNSProvider. Zone of challenge is detected by looking up
+// zones of its fqdn in Domains API.
+type LegoProvider struct {
+	provider *DNSProvider
+
+	// PropagationTimeout and PollingInterval are returned by Timeout
+	// for lego to wait for record on authoritative nameservers.
+	PropagationTimeout time.Duration
+	PollingInterval    time.Duration
+}
+
+// NewLegoProviderFromConfig returns lego provider with DNSProvider of config.
+func NewLegoProviderFromConfig(config *Config) (*LegoProvider, error) {
+	provider, err := NewDNSProviderFromConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewLegoProvider(provider), nil
+}
+
+// NewLegoProvider returns lego provider with default timeouts.
+func NewLegoProvider(provider *DNSProvider) *LegoProvider {
+	return &LegoProvider{
+		provider:           provider,
+		PropagationTimeout: defaultLegoPropagationTimeout,
+		PollingInterval:    defaultLegoPollingInterval,
+	}
+}
+
+// Present creates a record of challenge of domain, fqdn follows CNAME
+// unless it is disabled in lego.
+func (p *LegoProvider) Present(domain, _, keyAuth string) error {
+	info := dns01.GetChallengeInfo(domain, keyAuth)
+	zoneName, err := p.zone(info.EffectiveFQDN)
+	if err != nil {
+		return err
+	}
+	if err = p.provider.Present(zoneName, info.EffectiveFQDN, info.Value); err != nil {
+		return fmt.Errorf("present: %w", err)
+	}
+
+	return nil
+}
+
+// CleanUp removes a record of challenge of domain.
+func (p *LegoProvider) CleanUp(domain, _, keyAuth string) error {
+	info := dns01.GetChallengeInfo(domain, keyAuth)
+	zoneName, err := p.zone(info.EffectiveFQDN)
+	if err != nil {
+		return err
+	}
+	if err = p.provider.CleanUp(zoneName, info.EffectiveFQDN, info.Value); err != nil {
+		return fmt.Errorf("cleanup: %w", err)
+	}
+
+	return nil
+}
+
+// Timeout returns propagation timeout and polling interval of lego.
+func (p *LegoProvider) Timeout() (time.Duration, time.Duration) {
+	return p.PropagationTimeout, p.PollingInterval
+}
+
+func (p *LegoProvider) zone(fqdn string) (string, error) {
+	zone, err := p.provider.FindZone(context.Background(), fqdn)
+	if err != nil {
+		return "", fmt.Errorf("find zone of %s: %w", fqdn, err)
+	}
+
+	return zone.Name, nil
+}
@@ -0,0 +1,43 @@
+package selectel
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-acme/lego/v4/challenge/dns01"
+	"github.com/selectel/cert-manager-webhook-selectel/internal/fakeselectel"
+	domainsV2 "github.com/selectel/domains-go/pkg/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLegoProvider_PresentAndCleanUp(t *testing.T) {
+	// fqdn of challenge is not looked up in public DNS
+	t.Setenv("LEGO_DISABLE_CNAME_SUPPORT", "true")
+	server := fakeselectel.NewServer()
+	t.Cleanup(server.Close)
+	zoneID := server.AddZone("example.com.")
+	provider, err := NewLegoProviderFromConfig(newFakeServerConfig(t, server))
+	require.NoError(t, err)
+	info := dns01.GetChallengeInfo("www.example.com", "key-auth")
+
+	require.NoError(t, provider.Present("www.example.com", "token", "key-auth"))
+	rrsets := server.RRSets(zoneID)
+	require.Len(t, rrsets, 1)
+	assert.Equal(t, "_acme-challenge.www.example.com.", rrsets[0].Name)
+	assert.Equal(t, []domainsV2.RecordItem{{Content: `"` + info.Value + `"`}}, rrsets[0].Records)
+
+	require.NoError(t, provider.CleanUp("www.example.com", "token", "key-auth"))
+	assert.Empty(t, server.RRSets(zoneID))
+
+	err = provider.Present("example.org", "token", "key-auth")
+	require.ErrorIs(t, err, ErrZoneNotFound)
+}
+
+func TestLegoProvider_Timeout(t *testing.T) {
+	t.Parallel()
+	provider := NewLegoProvider(&DNSProvider{})
+	timeout, interval := provider.Timeout()
+	assert.Equal(t, 2*time.Minute, timeout)
+	assert.Equal(t, 2*time.Second, interval)
+}
@@ -0,0 +1,138 @@
+package selectel
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	defaultRateLimit   = 10
+	defaultRateBurst   = 10
+	defaultMaxInFlight = 10
+)
+
+// Limits of requests to Domains API, they are shared by all challenges
+// of the same Selectel account with the same limits.
+type Limits struct {
+	// Rate of requests per second, zero disables rate limiting.
+	Rate float64
+	// Burst of requests above Rate.
+	Burst int
+	// MaxInFlight requests, zero disables the cap.
+	MaxInFlight int
+}
+
+// DefaultLimits returns limits used unless they are set by webhook flags or env.
+func DefaultLimits() Limits {
+	return Limits{
+		Rate:        defaultRateLimit,
+		Burst:       defaultRateBurst,
+		MaxInFlight: defaultMaxInFlight,
+	}
+}
+
+// accountLimiters are shared between providers, as a provider is created per challenge.
+var accountLimiters = newLimiterRegistry()
+
+// accountLimiter is token bucket and semaphore of requests of an account.
+type accountLimiter struct {
+	account  string
+	limits   Limits
+	rate     *rate.Limiter
+	inFlight chan struct{}
+}
+
+func newAccountLimiter(account string, limits Limits) *accountLimiter {
+	limiter := &accountLimiter{
+		account: account,
+		limits:  limits,
+	}
+	if limits.Rate > 0 {
+		limiter.rate = rate.NewLimiter(rate.Limit(limits.Rate), max(limits.Burst, 1))
+	}
+	if limits.MaxInFlight > 0 {
+		limiter.inFlight = make(chan struct{}, limits.MaxInFlight)
+	}
+
+	return limiter
+}
+
+// acquire waits for a slot in flight and a token of rate limiter, release
+// frees the slot after request is done. Waiting ends with error of ctx.
+func (l *accountLimiter) acquire(ctx context.Context) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	start := time.Now()
+	if l.inFlight != nil {
+		select {
+		case l.inFlight <- struct{}{}:
+		case <-ctx.Done():
+			limiterCanceledTotal.WithLabelValues(l.account, "in_flight").Inc()
+
+			return nil, fmt.Errorf("wait for request in flight: %w", ctx.Err())
+		}
+	}
+	if l.rate != nil {
+		if err := l.rate.Wait(ctx); err != nil {
+			l.releaseSlot()
+			limiterCanceledTotal.WithLabelValues(l.account, "rate").Inc()
+
+			return nil, fmt.Errorf("wait for rate limiter: %w", err)
+		}
+	}
+	limiterWaitSeconds.WithLabelValues(l.account).Observe(time.Since(start).Seconds())
+	inFlightRequests.WithLabelValues(l.account).Inc()
+
+	var once sync.Once
+
+	return func() {
+		once.Do(func() {
+			inFlightRequests.WithLabelValues(l.account).Dec()
+			l.releaseSlot()
+		})
+	}, nil
+}
+
+func (l *accountLimiter) releaseSlot() {
+	if l.inFlight != nil {
+		<-l.inFlight
+	}
+}
+
+// limiterKey is account with its limits, solvers with different limits
+// of the same account don't reset limiters of each other.
+type limiterKey struct {
+	account string
+	limits  Limits
+}
+
+type limiterRegistry struct {
+	mu       sync.Mutex
+	limiters map[limiterKey]*accountLimiter
+}
+
+func newLimiterRegistry() *limiterRegistry {
+	return &limiterRegistry{limiters: map[limiterKey]*accountLimiter{}}
+}
+
+// get returns limiter of account with limits.
+func (r *limiterRegistry) get(account string, limits Limits) *accountLimiter {
+	if limits == (Limits{}) {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := limiterKey{account: account, limits: limits}
+	limiter, ok := r.limiters[key]
+	if !ok {
+		limiter = newAccountLimiter(account, limits)
+		r.limiters[key] = limiter
+	}
+
+	return limiter
+}
@@ -0,0 +1,110 @@
+package selectel
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/selectel/cert-manager-webhook-selectel/internal/fakeselectel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/component-base/metrics/testutil"
+)
+
+func TestAccountLimiter_MaxInFlight(t *testing.T) {
+	t.Parallel()
+	RegisterMetrics()
+	limiter := newAccountLimiter("in-flight-account", Limits{MaxInFlight: 2})
+
+	releaseFirst, err := limiter.acquire(t.Context())
+	require.NoError(t, err)
+	releaseSecond, err := limiter.acquire(t.Context())
+	require.NoError(t, err)
+	inFlight, err := testutil.GetGaugeMetricValue(inFlightRequests.WithLabelValues("in-flight-account"))
+	require.NoError(t, err)
+	assert.InDelta(t, 2, inFlight, 0)
+
+	ctx, cancel := context.WithTimeout(t.Context(), 20*time.Millisecond)
+	defer cancel()
+	_, err = limiter.acquire(ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	canceled, err := testutil.GetCounterMetricValue(limiterCanceledTotal.WithLabelValues("in-flight-account", "in_flight"))
+	require.NoError(t, err)
+	assert.InDelta(t, 1, canceled, 0)
+
+	releaseFirst()
+	releaseFirst()
+	releaseThird, err := limiter.acquire(t.Context())
+	require.NoError(t, err)
+	releaseSecond()
+	releaseThird()
+	inFlight, err = testutil.GetGaugeMetricValue(inFlightRequests.WithLabelValues("in-flight-account"))
+	require.NoError(t, err)
+	assert.InDelta(t, 0, inFlight, 0)
+}
+
+func TestAccountLimiter_Rate(t *testing.T) {
+	t.Parallel()
+	limiter := newAccountLimiter("rate-account", Limits{Rate: 1, Burst: 1, MaxInFlight: 1})
+
+	release, err := limiter.acquire(t.Context())
+	require.NoError(t, err)
+	release()
+
+	// the next token is in a second
+	ctx, cancel := context.WithTimeout(t.Context(), 20*time.Millisecond)
+	defer cancel()
+	_, err = limiter.acquire(ctx)
+	require.Error(t, err)
+	// slot in flight is released after rate limiter wait is canceled
+	assert.Empty(t, limiter.inFlight)
+}
+
+func TestLimiterRegistry(t *testing.T) {
+	t.Parallel()
+	registry := newLimiterRegistry()
+	limiter := registry.get("account", DefaultLimits())
+	assert.Same(t, limiter, registry.get("account", DefaultLimits()))
+	assert.NotSame(t, limiter, registry.get("another-account", DefaultLimits()))
+	assert.NotSame(t, limiter, registry.get("account", Limits{Rate: 1, Burst: 1}))
+	assert.Nil(t, registry.get("account", Limits{}))
+}
+
+func TestLimiterRegistry_SolversOfAccount(t *testing.T) {
+	t.Parallel()
+	registry := newLimiterRegistry()
+	prodLimits, stagingLimits := Limits{MaxInFlight: 1}, Limits{Rate: 1, Burst: 1, MaxInFlight: 2}
+
+	prod := registry.get("shared-account", prodLimits)
+	release, err := prod.acquire(t.Context())
+	require.NoError(t, err)
+	defer release()
+
+	// limiter of another solver of the account doesn't replace one held by request
+	staging := registry.get("shared-account", stagingLimits)
+	assert.NotSame(t, prod, staging)
+	assert.Same(t, prod, registry.get("shared-account", prodLimits))
+	assert.Same(t, staging, registry.get("shared-account", stagingLimits))
+
+	ctx, cancel := context.WithTimeout(t.Context(), 20*time.Millisecond)
+	defer cancel()
+	_, err = registry.get("shared-account", prodLimits).acquire(ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestAPIClient_LimiterCanceled(t *testing.T) {
+	t.Parallel()
+	server := fakeselectel.NewServer()
+	t.Cleanup(server.Close)
+	client := newTestAPIClient(t, server)
+	client.limiter = newAccountLimiter("canceled-account", Limits{MaxInFlight: 1})
+	release, err := client.limiter.acquire(t.Context())
+	require.NoError(t, err)
+	defer release()
+
+	ctx, cancel := context.WithTimeout(t.Context(), 20*time.Millisecond)
+	defer cancel()
+	_, err = client.ListZones(ctx, &map[string]string{})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, 0, server.APIRequests())
+}
@@ -0,0 +1,25 @@
+package selectel
+
+import (
+	"context"
+	"fmt"
+)
+
+// Locker takes distributed lock of key, e.g. Lease in Kubernetes.
+type Locker interface {
+	Lock(ctx context.Context, key string) (unlock func(), err error)
+}
+
+// lock serializes read-modify-write of RRSet fqdn in zone, so records
+// added by concurrent challenges of other replicas are not lost.
+func (d *DNSProvider) lock(ctx context.Context, zoneName, fqdn string) (func(), error) {
+	if d.config.Locker == nil {
+		return func() {}, nil
+	}
+	unlock, err := d.config.Locker.Lock(ctx, normalizeZoneName(zoneName)+"/"+normalizeZoneName(fqdn))
+	if err != nil {
+		return nil, fmt.Errorf("lock rrset %s: %w", fqdn, err)
+	}
+
+	return unlock, nil
+}
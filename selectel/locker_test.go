@@ -0,0 +1,86 @@
+package selectel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/selectel/cert-manager-webhook-selectel/internal/fakeselectel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testLocker locks keys in memory and records them.
+type testLocker struct {
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+	keys  []string
+	err   error
+}
+
+func (l *testLocker) Lock(_ context.Context, key string) (func(), error) {
+	l.mu.Lock()
+	if l.err != nil {
+		l.mu.Unlock()
+
+		return nil, l.err
+	}
+	if l.locks == nil {
+		l.locks = map[string]*sync.Mutex{}
+	}
+	keyLock, ok := l.locks[key]
+	if !ok {
+		keyLock = &sync.Mutex{}
+		l.locks[key] = keyLock
+	}
+	l.keys = append(l.keys, key)
+	l.mu.Unlock()
+	keyLock.Lock()
+
+	return keyLock.Unlock, nil
+}
+
+func TestDNSProvider_LockRRSet(t *testing.T) {
+	t.Parallel()
+	server := fakeselectel.NewServer()
+	t.Cleanup(server.Close)
+	zoneID := server.AddZone("example.com.")
+	locker := &testLocker{}
+
+	const replicas = 5
+	var wg sync.WaitGroup
+	for i := range replicas {
+		config := newFakeServerConfig(t, server)
+		config.Locker = locker
+		provider, err := NewDNSProviderFromConfig(config)
+		require.NoError(t, err)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, provider.Present("example.com.", testFQDN, fmt.Sprintf("value-%d", i)))
+		}()
+	}
+	wg.Wait()
+
+	rrsets := server.RRSets(zoneID)
+	require.Len(t, rrsets, 1)
+	assert.Len(t, rrsets[0].Records, replicas)
+	assert.Equal(t, "example.com/_acme-challenge.example.com", locker.keys[0])
+}
+
+func TestDNSProvider_LockError(t *testing.T) {
+	t.Parallel()
+	server := fakeselectel.NewServer()
+	t.Cleanup(server.Close)
+	zoneID := server.AddZone("example.com.")
+	errLock := errors.New("timeout waiting for lock")
+	config := newFakeServerConfig(t, server)
+	config.Locker = &testLocker{err: errLock}
+	provider, err := NewDNSProviderFromConfig(config)
+	require.NoError(t, err)
+
+	require.ErrorIs(t, provider.Present("example.com.", testFQDN, "value"), errLock)
+	assert.Empty(t, server.RRSets(zoneID))
+}
@@ -0,0 +1,72 @@
+package selectel
+
+import (
+	"sync"
+
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+)
+
+const metricsSubsystem = "selectel_api"
+
+var (
+	limiterWaitSeconds = metrics.NewHistogramVec(&metrics.HistogramOpts{
+		Subsystem:      metricsSubsystem,
+		Name:           "limiter_wait_seconds",
+		Help:           "Time requests to Domains API wait for rate limiter and in-flight cap.",
+		Buckets:        []float64{0.01, 0.05, 0.1, 0.5, 1, 2.5, 5, 10, 30, 60},
+		StabilityLevel: metrics.ALPHA,
+	}, []string{"account"})
+	inFlightRequests = metrics.NewGaugeVec(&metrics.GaugeOpts{
+		Subsystem:      metricsSubsystem,
+		Name:           "in_flight_requests",
+		Help:           "Requests to Domains API in flight.",
+		StabilityLevel: metrics.ALPHA,
+	}, []string{"account"})
+	limiterCanceledTotal = metrics.NewCounterVec(&metrics.CounterOpts{
+		Subsystem:      metricsSubsystem,
+		Name:           "limiter_canceled_total",
+		Help:           "Requests to Domains API canceled while waiting for limiter.",
+		StabilityLevel: metrics.ALPHA,
+	}, []string{"account", "limit"})
+	circuitState = metrics.NewGaugeVec(&metrics.GaugeOpts{
+		Subsystem:      metricsSubsystem,
+		Name:           "circuit_state",
+		Help:           "State of circuit breaker of Selectel API endpoint: 0 closed, 1 half-open, 2 open.",
+		StabilityLevel: metrics.ALPHA,
+	}, []string{"endpoint"})
+	circuitRejectedTotal = metrics.NewCounterVec(&metrics.CounterOpts{
+		Subsystem:      metricsSubsystem,
+		Name:           "circuit_rejected_total",
+		Help:           "Requests to Selectel API endpoint failed fast by open circuit breaker.",
+		StabilityLevel: metrics.ALPHA,
+	}, []string{"endpoint"})
+	challengesTotal = metrics.NewCounterVec(&metrics.CounterOpts{
+		Subsystem:      metricsSubsystem,
+		Name:           "challenges_total",
+		Help:           "Present and CleanUp of challenge records by result, ErrorReason of failed ones.",
+		StabilityLevel: metrics.ALPHA,
+	}, []string{"action", "result"})
+
+	registerMetrics sync.Once
+)
+
+// RegisterMetrics registers metrics of Selectel API clients in the registry
+// served by webhook at /metrics, metrics aren't recorded until it is called.
+func RegisterMetrics() {
+	registerMetrics.Do(func() {
+		legacyregistry.MustRegister(limiterWaitSeconds, inFlightRequests, limiterCanceledTotal,
+			circuitState, circuitRejectedTotal, challengesTotal)
+	})
+}
+
+const resultSuccess = "Success"
+
+// observeChallenge counts action on challenge record labeled by ErrorReason of err.
+func observeChallenge(action string, err error) {
+	result := resultSuccess
+	if err != nil {
+		result = ErrorReason(err)
+	}
+	challengesTotal.WithLabelValues(action, result).Inc()
+}
@@ -0,0 +1,244 @@
+package selectel
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/selectel/go-selvpcclient/v3/selvpcclient"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// CloudsYAMLKey is key of Secret with clouds.yaml of OpenStack clients,
+	// cloud is selected by cloud field of config.
+	CloudsYAMLKey = "clouds.yaml"
+	// OpenRCKey is key of Secret with openrc file, e.g. rc.sh of control panel.
+	OpenRCKey = "rc.sh"
+)
+
+var (
+	errCloudNotFound         = errors.New("cloud not found in clouds.yaml")
+	errCloudNotSelected      = errors.New("clouds.yaml has several clouds, select one with cloud field of config")
+	errIncompleteCredentials = errors.New("incomplete credentials")
+	errEndpointMismatch      = errors.New("endpoint of config differs from credentials file")
+)
+
+// cloudsYAML is clouds.yaml, only auth and region of clouds are used.
+type cloudsYAML struct {
+	Clouds map[string]struct {
+		Auth       cloudAuth `json:"auth"`
+		RegionName string    `json:"region_name"`
+	} `json:"clouds"`
+}
+
+type cloudAuth struct {
+	AuthURL           string `json:"auth_url"`
+	Username          string `json:"username"`
+	Password          string `json:"password"`
+	UserDomainName    string `json:"user_domain_name"`
+	ProjectDomainName string `json:"project_domain_name"`
+	DomainName        string `json:"domain_name"`
+	ProjectID         string `json:"project_id"`
+}
+
+// credentialsFields are names of required fields of credentials in source format
+// and endpoint of Keystone set in the source.
+type credentialsFields struct {
+	username  string
+	password  string
+	accountID string
+
+	authURL      string
+	authURLField string
+	region       string
+	regionField  string
+}
+
+// FromSecretData reads credentials from clouds.yaml or openrc file in Secret
+// or from keys of Secret otherwise, cloud of clouds.yaml is selected by Cloud.
+// Keys of Secret override values of the file, e.g. password key completes openrc
+// which prompts for password. Auth url and region of the file are used unless
+// config sets other ones.
+func (config *Config) FromSecretData(dataFromSecret map[string][]byte) error {
+	source, fields, err := config.CredentialsForDNS.fromSecretData(dataFromSecret, config.Cloud)
+	if err != nil || source == "" {
+		return err
+	}
+	authURL, err := endpointOf(config.AuthURL, selvpcclient.DefaultAuthURL, "authUrl",
+		fields.authURL, fields.authURLField, source)
+	if err != nil {
+		return err
+	}
+	region, err := endpointOf(config.Region, selvpcclient.DefaultAuthRegion, "region",
+		fields.region, fields.regionField, source)
+	if err != nil {
+		return err
+	}
+	config.AuthURL, config.Region = authURL, region
+
+	return nil
+}
+
+// endpointOf returns value of source file if config has default value,
+// value of config differing from the file is rejected.
+func endpointOf(value, defaultValue, field, sourceValue, sourceField, source string) (string, error) {
+	switch {
+	case sourceValue == "" || strings.TrimSuffix(sourceValue, "/") == strings.TrimSuffix(value, "/"):
+		return value, nil
+	case value == defaultValue:
+		return sourceValue, nil
+	}
+
+	return "", fmt.Errorf("%w: %s %s, %s in %s %s", errEndpointMismatch, field, value, sourceField, source, sourceValue)
+}
+
+// fromSecretData returns name of file credentials are read from, empty for keys of Secret.
+func (credentials *CredentialsForDNS) fromSecretData(dataFromSecret map[string][]byte, cloud string) (string, credentialsFields, error) {
+	var (
+		source string
+		fields credentialsFields
+		err    error
+	)
+	switch {
+	case dataFromSecret[CloudsYAMLKey] != nil:
+		source = CloudsYAMLKey
+		fields, err = credentials.fromCloudsYAML(dataFromSecret[CloudsYAMLKey], cloud)
+	case dataFromSecret[OpenRCKey] != nil:
+		source = OpenRCKey
+		fields = credentials.fromOpenRC(dataFromSecret[OpenRCKey])
+	default:
+		return "", credentialsFields{}, credentials.FromMapBytes(dataFromSecret)
+	}
+	if err != nil {
+		return "", credentialsFields{}, err
+	}
+	keys := make(map[string][]byte, len(dataFromSecret))
+	for key, value := range dataFromSecret {
+		if key != source {
+			keys[key] = value
+		}
+	}
+	if err = credentials.FromMapBytes(keys); err != nil {
+		return "", credentialsFields{}, err
+	}
+
+	return source, fields, credentials.validateSource(source, fields)
+}
+
+func (credentials *CredentialsForDNS) fromCloudsYAML(data []byte, cloud string) (credentialsFields, error) {
+	clouds := cloudsYAML{}
+	if err := yaml.Unmarshal(data, &clouds); err != nil {
+		return credentialsFields{}, fmt.Errorf("parse %s: %w", CloudsYAMLKey, err)
+	}
+	names := make([]string, 0, len(clouds.Clouds))
+	for name := range clouds.Clouds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if cloud == "" {
+		if len(names) != 1 {
+			return credentialsFields{}, fmt.Errorf("%w: %s", errCloudNotSelected, strings.Join(names, ", "))
+		}
+		cloud = names[0]
+	}
+	entry, ok := clouds.Clouds[cloud]
+	if !ok {
+		return credentialsFields{}, fmt.Errorf("%w: %s, clouds are: %s", errCloudNotFound, cloud, strings.Join(names, ", "))
+	}
+	auth := entry.Auth
+	credentials.Username = []byte(auth.Username)
+	credentials.Password = []byte(auth.Password)
+	// account id is name of domain of user in Keystone
+	credentials.AccountID = []byte(firstNonEmpty(auth.UserDomainName, auth.ProjectDomainName, auth.DomainName))
+	credentials.ProjectID = []byte(auth.ProjectID)
+	prefix := "clouds." + cloud + ".auth."
+
+	return credentialsFields{
+		username:     prefix + "username",
+		password:     prefix + "password",
+		accountID:    prefix + "user_domain_name",
+		authURL:      auth.AuthURL,
+		authURLField: prefix + "auth_url",
+		region:       entry.RegionName,
+		regionField:  "clouds." + cloud + ".region_name",
+	}, nil
+}
+
+// fromOpenRC reads OS_* variables assigned in openrc. Values referencing
+// other variables, e.g. password read from prompt, are ignored.
+func (credentials *CredentialsForDNS) fromOpenRC(data []byte) credentialsFields {
+	variables := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+		name, value, ok := strings.Cut(line, "=")
+		if !ok || !strings.HasPrefix(name, "OS_") {
+			continue
+		}
+		value = unquote(strings.TrimSpace(value))
+		if strings.ContainsAny(value, "$`") {
+			continue
+		}
+		variables[name] = value
+	}
+	credentials.Username = []byte(variables["OS_USERNAME"])
+	credentials.Password = []byte(variables["OS_PASSWORD"])
+	credentials.AccountID = []byte(firstNonEmpty(variables["OS_USER_DOMAIN_NAME"], variables["OS_PROJECT_DOMAIN_NAME"]))
+	credentials.ProjectID = []byte(firstNonEmpty(variables["OS_PROJECT_ID"], variables["OS_TENANT_ID"]))
+
+	return credentialsFields{
+		username:     "OS_USERNAME",
+		password:     "OS_PASSWORD",
+		accountID:    "OS_USER_DOMAIN_NAME",
+		authURL:      variables["OS_AUTH_URL"],
+		authURLField: "OS_AUTH_URL",
+		region:       variables["OS_REGION_NAME"],
+		regionField:  "OS_REGION_NAME",
+	}
+}
+
+// validateSource reports required credentials missing in file by their names in it.
+func (credentials *CredentialsForDNS) validateSource(source string, fields credentialsFields) error {
+	missing := []string{}
+	for _, field := range []struct {
+		value []byte
+		name  string
+		key   string
+	}{
+		{credentials.Username, fields.username, "username"},
+		{credentials.Password, fields.password, "password"},
+		{credentials.AccountID, fields.accountID, "account_id"},
+	} {
+		if len(field.value) == 0 {
+			missing = append(missing, fmt.Sprintf("setup %s in %s or %s key", field.name, source, field.key))
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: %s", errIncompleteCredentials, strings.Join(missing, "; "))
+	}
+
+	return nil
+}
+
+func unquote(value string) string {
+	if len(value) >= 2 && (value[0] == '\'' || value[0] == '"') && value[len(value)-1] == value[0] {
+		return value[1 : len(value)-1]
+	}
+
+	return value
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+
+	return ""
+}
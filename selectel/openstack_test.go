@@ -0,0 +1,159 @@
+package selectel
+
+import (
+	"testing"
+
+	"github.com/selectel/go-selvpcclient/v3/selvpcclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testCloudsYAML = `
+clouds:
+  selectel-prod:
+    auth:
+      auth_url: https://cloud.api.selcloud.ru/identity/v3
+      username: prod-user
+      password: prod-password
+      user_domain_name: "123456"
+      project_id: prod-project
+    region_name: ru-9
+  selectel-staging:
+    auth:
+      username: staging-user
+      password: staging-password
+      project_domain_name: "654321"
+      project_id: staging-project
+`
+
+const testOpenRC = `#!/usr/bin/env bash
+export OS_AUTH_URL="https://cloud.api.selcloud.ru/identity/v3"
+export OS_IDENTITY_API_VERSION=3
+export OS_PROJECT_DOMAIN_NAME='123456'
+export OS_PROJECT_ID='project-id'
+export OS_USER_DOMAIN_NAME='123456'
+export OS_USERNAME='user'
+echo "Please enter your OpenStack Password: "
+read -sr OS_PASSWORD_INPUT
+export OS_PASSWORD=$OS_PASSWORD_INPUT
+`
+
+// fromSecretData reads credentials with default config.
+func fromSecretData(t *testing.T, data map[string][]byte, cloud string) (*Config, error) {
+	t.Helper()
+	config, err := NewConfigForDNS()
+	require.NoError(t, err)
+	config.Cloud = cloud
+
+	return config, config.FromSecretData(data)
+}
+
+func TestConfig_FromSecretData_CloudsYAML(t *testing.T) {
+	t.Parallel()
+	data := map[string][]byte{CloudsYAMLKey: []byte(testCloudsYAML)}
+
+	config, err := fromSecretData(t, data, "selectel-prod")
+	require.NoError(t, err)
+	assert.Equal(t, CredentialsForDNS{
+		Username:  []byte("prod-user"),
+		Password:  []byte("prod-password"),
+		AccountID: []byte("123456"),
+		ProjectID: []byte("prod-project"),
+	}, config.CredentialsForDNS)
+	// region of cloud is used, auth url of cloud is the default one
+	assert.Equal(t, "ru-9", config.Region)
+	assert.Equal(t, selvpcclient.DefaultAuthURL, config.AuthURL)
+
+	config, err = fromSecretData(t, data, "selectel-staging")
+	require.NoError(t, err)
+	assert.Equal(t, "654321", string(config.CredentialsForDNS.AccountID))
+	assert.Equal(t, selvpcclient.DefaultAuthRegion, config.Region)
+
+	_, err = fromSecretData(t, data, "")
+	require.ErrorIs(t, err, errCloudNotSelected)
+	assert.Contains(t, err.Error(), "selectel-prod, selectel-staging")
+	_, err = fromSecretData(t, data, "unknown")
+	require.ErrorIs(t, err, errCloudNotFound)
+
+	// the only cloud is selected by default
+	single := map[string][]byte{CloudsYAMLKey: []byte(`{clouds: {selectel: {auth: {username: user}}}}`)}
+	_, err = fromSecretData(t, single, "")
+	require.ErrorIs(t, err, errIncompleteCredentials)
+	assert.Equal(t, "incomplete credentials: "+
+		"setup clouds.selectel.auth.password in clouds.yaml or password key; "+
+		"setup clouds.selectel.auth.user_domain_name in clouds.yaml or account_id key", err.Error())
+}
+
+func TestConfig_FromSecretData_Endpoint(t *testing.T) {
+	t.Parallel()
+	data := map[string][]byte{CloudsYAMLKey: []byte(`
+clouds:
+  private:
+    auth:
+      auth_url: https://identity.private.example.com/v3
+      username: user
+      password: password
+      user_domain_name: "123456"
+    region_name: private-1
+`)}
+
+	config, err := fromSecretData(t, data, "")
+	require.NoError(t, err)
+	assert.Equal(t, "https://identity.private.example.com/v3", config.AuthURL)
+	assert.Equal(t, "private-1", config.Region)
+
+	// config may repeat the file, but can't point to another endpoint
+	config, err = NewConfigForDNS()
+	require.NoError(t, err)
+	config.Region = "private-1"
+	require.NoError(t, config.FromSecretData(data))
+	config.AuthURL = "https://identity.example.com/v3/"
+	err = config.FromSecretData(data)
+	require.ErrorIs(t, err, errEndpointMismatch)
+	assert.Equal(t, "endpoint of config differs from credentials file: "+
+		"authUrl https://identity.example.com/v3/, clouds.private.auth.auth_url in clouds.yaml "+
+		"https://identity.private.example.com/v3", err.Error())
+
+	config, err = NewConfigForDNS()
+	require.NoError(t, err)
+	config.Region = "ru-9"
+	err = config.FromSecretData(map[string][]byte{
+		OpenRCKey:  []byte(testOpenRC + "export OS_REGION_NAME='ru-3'\n"),
+		"password": []byte("password"),
+	})
+	require.ErrorIs(t, err, errEndpointMismatch)
+	assert.Contains(t, err.Error(), "region ru-9, OS_REGION_NAME in rc.sh ru-3")
+}
+
+func TestConfig_FromSecretData_OpenRC(t *testing.T) {
+	t.Parallel()
+	_, err := fromSecretData(t, map[string][]byte{OpenRCKey: []byte(testOpenRC)}, "")
+	require.ErrorIs(t, err, errIncompleteCredentials)
+	assert.Equal(t, "incomplete credentials: setup OS_PASSWORD in rc.sh or password key", err.Error())
+
+	// password prompted by openrc is taken from key of Secret
+	config, err := fromSecretData(t, map[string][]byte{
+		OpenRCKey:  []byte(testOpenRC),
+		"password": []byte("password"),
+	}, "")
+	require.NoError(t, err)
+	assert.Equal(t, CredentialsForDNS{
+		Username:  []byte("user"),
+		Password:  []byte("password"),
+		AccountID: []byte("123456"),
+		ProjectID: []byte("project-id"),
+	}, config.CredentialsForDNS)
+	assert.Equal(t, selvpcclient.DefaultAuthURL, config.AuthURL)
+}
+
+func TestConfig_FromSecretData_Keys(t *testing.T) {
+	t.Parallel()
+	config, err := fromSecretData(t, map[string][]byte{
+		"username":   []byte("user"),
+		"password":   []byte("password"),
+		"account_id": []byte("123456"),
+	}, "")
+	require.NoError(t, err)
+	assert.Equal(t, "user", string(config.CredentialsForDNS.Username))
+	assert.Empty(t, config.CredentialsForDNS.ProjectID)
+}
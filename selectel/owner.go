@@ -0,0 +1,79 @@
+package selectel
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	domainsV2 "github.com/selectel/domains-go/pkg/v2"
+)
+
+// Behaviors with RRSets which are not created by webhook of the same cluster.
+const (
+	// ForeignRRSetsShare adds records to foreign RRSet and keeps its comment.
+	ForeignRRSetsShare = "share"
+	// ForeignRRSetsRefuse fails challenge if RRSet is foreign.
+	ForeignRRSetsRefuse = "refuse"
+	// ForeignRRSetsTakeover adds records to foreign RRSet and marks it as owned.
+	ForeignRRSetsTakeover = "takeover"
+)
+
+const ownerCommentPrefix = "cert-manager-webhook-selectel"
+
+// ErrForeignRRSet is returned when RRSet is owned by another system or cluster
+// and foreignRRSets is refuse.
+var ErrForeignRRSet = errors.New("rrset is not owned by webhook of this cluster")
+
+// Owner identifies webhook in comment of RRSets created by it.
+// RRSets with the same cluster id are owned regardless of instance.
+type Owner struct {
+	ClusterID string
+	// Instance is informational, e.g. name of webhook pod.
+	Instance string
+}
+
+func (o Owner) comment() string {
+	return fmt.Sprintf("%s cluster=%s instance=%s", ownerCommentPrefix, o.ClusterID, o.Instance)
+}
+
+// parseOwnerComment returns owner from comment of RRSet, ok is false
+// if RRSet is not created by webhook.
+func parseOwnerComment(comment string) (Owner, bool) {
+	fields := strings.Fields(comment)
+	if len(fields) == 0 || fields[0] != ownerCommentPrefix {
+		return Owner{}, false
+	}
+	owner := Owner{}
+	for _, field := range fields[1:] {
+		key, value, _ := strings.Cut(field, "=")
+		switch key {
+		case "cluster":
+			owner.ClusterID = value
+		case "instance":
+			owner.Instance = value
+		}
+	}
+
+	return owner, true
+}
+
+// rrsetComment returns comment of existing RRSet after record of challenge
+// is added to it, it depends on owner of RRSet and foreignRRSets.
+func (d *DNSProvider) rrsetComment(rrset *domainsV2.RRSet) (string, error) {
+	owner, ok := parseOwnerComment(rrset.Comment)
+	if ok && owner.ClusterID == d.config.Owner.ClusterID {
+		return rrset.Comment, nil
+	}
+	switch d.config.ForeignRRSets {
+	case ForeignRRSetsRefuse:
+		if ok {
+			return "", fmt.Errorf("%w: %s is owned by cluster %q", ErrForeignRRSet, rrset.Name, owner.ClusterID)
+		}
+
+		return "", fmt.Errorf("%w: %s is created by another system", ErrForeignRRSet, rrset.Name)
+	case ForeignRRSetsTakeover:
+		return d.config.Owner.comment(), nil
+	}
+
+	return rrset.Comment, nil
+}
@@ -0,0 +1,138 @@
+package selectel
+
+import (
+	"testing"
+
+	"github.com/selectel/cert-manager-webhook-selectel/internal/fakeselectel"
+	domainsV2 "github.com/selectel/domains-go/pkg/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testFQDN = "_acme-challenge.example.com."
+
+func TestParseOwnerComment(t *testing.T) {
+	t.Parallel()
+	owner := Owner{ClusterID: "prod", Instance: "webhook-0"}
+	parsed, ok := parseOwnerComment(owner.comment())
+	require.True(t, ok)
+	assert.Equal(t, owner, parsed)
+
+	_, ok = parseOwnerComment("managed by terraform")
+	assert.False(t, ok)
+	_, ok = parseOwnerComment("")
+	assert.False(t, ok)
+}
+
+func newTestOwnerProvider(t *testing.T, server *fakeselectel.Server, clusterID, foreignRRSets string) *DNSProvider {
+	t.Helper()
+	config := newFakeServerConfig(t, server)
+	config.Owner = Owner{ClusterID: clusterID, Instance: clusterID + "-webhook"}
+	config.ForeignRRSets = foreignRRSets
+	provider, err := NewDNSProviderFromConfig(config)
+	require.NoError(t, err)
+
+	return provider
+}
+
+func TestDNSProvider_ForeignRRSets(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		foreignRRSets   string
+		expectedErr     error
+		expectedComment string
+		expectedRecords []domainsV2.RecordItem
+	}{
+		{
+			foreignRRSets:   ForeignRRSetsShare,
+			expectedComment: "managed by terraform",
+			expectedRecords: []domainsV2.RecordItem{{Content: `"foreign"`}, {Content: `"value"`}},
+		},
+		{
+			foreignRRSets:   ForeignRRSetsRefuse,
+			expectedErr:     ErrForeignRRSet,
+			expectedComment: "managed by terraform",
+			expectedRecords: []domainsV2.RecordItem{{Content: `"foreign"`}},
+		},
+		{
+			foreignRRSets:   ForeignRRSetsTakeover,
+			expectedComment: "cert-manager-webhook-selectel cluster=a instance=a-webhook",
+			expectedRecords: []domainsV2.RecordItem{{Content: `"foreign"`}, {Content: `"value"`}},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.foreignRRSets, func(t *testing.T) {
+			t.Parallel()
+			server := fakeselectel.NewServer()
+			t.Cleanup(server.Close)
+			zoneID := server.AddZone("example.com.")
+			server.AddRRSet(zoneID, domainsV2.RRSet{
+				Name:    testFQDN,
+				Type:    domainsV2.TXT,
+				TTL:     minTTL,
+				Comment: "managed by terraform",
+				Records: []domainsV2.RecordItem{{Content: `"foreign"`}},
+			})
+			provider := newTestOwnerProvider(t, server, "a", testCase.foreignRRSets)
+
+			err := provider.Present("example.com.", testFQDN, "value")
+			if testCase.expectedErr != nil {
+				require.ErrorIs(t, err, testCase.expectedErr)
+			} else {
+				require.NoError(t, err)
+			}
+			rrsets := server.RRSets(zoneID)
+			require.Len(t, rrsets, 1)
+			assert.Equal(t, testCase.expectedComment, rrsets[0].Comment)
+			assert.Equal(t, testCase.expectedRecords, rrsets[0].Records)
+
+			// foreign record is kept after clean up
+			require.NoError(t, provider.CleanUp("example.com.", testFQDN, "value"))
+			rrsets = server.RRSets(zoneID)
+			require.Len(t, rrsets, 1)
+			assert.Equal(t, []domainsV2.RecordItem{{Content: `"foreign"`}}, rrsets[0].Records)
+		})
+	}
+}
+
+func TestDNSProvider_TwoClusters(t *testing.T) {
+	t.Parallel()
+	server := fakeselectel.NewServer()
+	t.Cleanup(server.Close)
+	zoneID := server.AddZone("example.com.")
+	clusterA := newTestOwnerProvider(t, server, "a", ForeignRRSetsShare)
+	clusterB := newTestOwnerProvider(t, server, "b", ForeignRRSetsShare)
+
+	require.NoError(t, clusterA.Present("example.com.", testFQDN, "a"))
+	require.NoError(t, clusterB.Present("example.com.", testFQDN, "b"))
+	rrsets := server.RRSets(zoneID)
+	require.Len(t, rrsets, 1)
+	assert.Equal(t, "cert-manager-webhook-selectel cluster=a instance=a-webhook", rrsets[0].Comment)
+
+	// clean up of cluster a keeps record of cluster b
+	require.NoError(t, clusterA.CleanUp("example.com.", testFQDN, "a"))
+	rrsets = server.RRSets(zoneID)
+	require.Len(t, rrsets, 1)
+	assert.Equal(t, []domainsV2.RecordItem{{Content: `"b"`}}, rrsets[0].Records)
+	// repeated clean up doesn't delete foreign record
+	require.NoError(t, clusterA.CleanUp("example.com.", testFQDN, "a"))
+	assert.Len(t, server.RRSets(zoneID), 1)
+
+	require.NoError(t, clusterB.CleanUp("example.com.", testFQDN, "b"))
+	assert.Empty(t, server.RRSets(zoneID))
+}
+
+func TestDNSProvider_RefuseRRSetOfAnotherCluster(t *testing.T) {
+	t.Parallel()
+	server := fakeselectel.NewServer()
+	t.Cleanup(server.Close)
+	server.AddZone("example.com.")
+	clusterA := newTestOwnerProvider(t, server, "a", ForeignRRSetsRefuse)
+	clusterB := newTestOwnerProvider(t, server, "b", ForeignRRSetsRefuse)
+
+	require.NoError(t, clusterA.Present("example.com.", testFQDN, "first"))
+	require.NoError(t, clusterA.Present("example.com.", testFQDN, "second"))
+	err := clusterB.Present("example.com.", testFQDN, "b")
+	require.ErrorIs(t, err, ErrForeignRRSet)
+	assert.ErrorContains(t, err, `owned by cluster "a"`)
+}
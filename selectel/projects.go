@@ -0,0 +1,219 @@
+package selectel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/selectel/cert-manager-webhook-selectel/selectel/internal"
+	domainsV2 "github.com/selectel/domains-go/pkg/v2"
+)
+
+// zoneProjectsCacheTTL limits how long a zone is considered to belong to
+// the found project, so zones moved between projects are found again.
+const zoneProjectsCacheTTL = time.Hour
+
+var (
+	errProjectNotSetup = errors.New("setup project_id, project_ids or zoneProjects")
+
+	// providers are created for every challenge, so found projects of zones
+	// are shared between them.
+	zoneProjects = newZoneProjectCache()
+)
+
+// projectIDs returns projects which may own zones: project_id, project_ids
+// and projects of zoneProjects without duplicates.
+func (config *Config) projectIDs() []string {
+	candidates := []string{string(config.CredentialsForDNS.ProjectID)}
+	candidates = append(candidates, strings.Split(string(config.CredentialsForDNS.ProjectIDs), ",")...)
+	for _, projectID := range config.ZoneProjects {
+		candidates = append(candidates, projectID)
+	}
+
+	projectIDs := []string{}
+	seen := map[string]bool{}
+	for _, projectID := range candidates {
+		projectID = strings.TrimSpace(projectID)
+		if projectID == "" || seen[projectID] {
+			continue
+		}
+		seen[projectID] = true
+		projectIDs = append(projectIDs, projectID)
+	}
+
+	return projectIDs
+}
+
+// forProject returns copy of config with credentials scoped to project.
+func (config *Config) forProject(projectID string) *Config {
+	projectConfig := *config
+	projectConfig.CredentialsForDNS.ProjectID = []byte(projectID)
+
+	return &projectConfig
+}
+
+// configuredProject returns project of the longest zone suffix in zoneProjects
+// which matches zone.
+func (config *Config) configuredProject(zoneName string) (string, bool) {
+	zoneName = normalizeZoneName(zoneName)
+	projectID, longest := "", -1
+	for suffix, suffixProjectID := range config.ZoneProjects {
+		suffix = normalizeZoneName(suffix)
+		if zoneName != suffix && !strings.HasSuffix(zoneName, "."+suffix) {
+			continue
+		}
+		if len(suffix) > longest {
+			projectID, longest = suffixProjectID, len(suffix)
+		}
+	}
+
+	return projectID, longest >= 0
+}
+
+func normalizeZoneName(zoneName string) string {
+	return strings.ToLower(strings.TrimSuffix(zoneName, "."))
+}
+
+// projectDNSClient is Domains API client of project, it is created under
+// its own lock, so authentication in one project doesn't block others.
+type projectDNSClient struct {
+	mu     sync.Mutex
+	client domainsV2.DNSClient[domainsV2.Zone, domainsV2.RRSet]
+}
+
+// projectClient returns Domains API client with token of project, clients
+// are created on first use, failed creation is retried by the next call.
+func (d *DNSProvider) projectClient(projectID string) (domainsV2.DNSClient[domainsV2.Zone, domainsV2.RRSet], error) {
+	d.mu.Lock()
+	project, ok := d.dnsClients[projectID]
+	if !ok {
+		project = &projectDNSClient{}
+		d.dnsClients[projectID] = project
+	}
+	d.mu.Unlock()
+
+	project.mu.Lock()
+	defer project.mu.Unlock()
+	if project.client != nil {
+		return project.client, nil
+	}
+	dnsClient, err := getDNSClientFromConfig(d.config.forProject(projectID))
+	if err != nil {
+		return nil, fmt.Errorf("setup client of project %s: %w", projectID, err)
+	}
+	project.client = dnsClient
+
+	return dnsClient, nil
+}
+
+// findZone returns zone and client of the project owning it. Project is taken
+// from zoneProjects, from cache or found by looking for zone in every project.
+func (d *DNSProvider) findZone(ctx context.Context, zoneName string) (domainsV2.DNSClient[domainsV2.Zone, domainsV2.RRSet], *domainsV2.Zone, error) {
+	if projectID, ok := d.config.configuredProject(zoneName); ok {
+		return d.projectZone(ctx, projectID, zoneName)
+	}
+
+	cacheKey := d.zoneCacheKey(zoneName)
+	if projectID, ok := zoneProjects.get(cacheKey); ok {
+		dnsClient, zone, err := d.projectZone(ctx, projectID, zoneName)
+		if !errors.Is(err, internal.ErrZoneNotFound) {
+			return dnsClient, zone, err
+		}
+		zoneProjects.forget(cacheKey)
+	}
+
+	// projects not accessible by user are skipped, zone may be in another one
+	var projectErrs []error
+	for _, projectID := range d.config.projectIDs() {
+		dnsClient, zone, err := d.projectZone(ctx, projectID, zoneName)
+		if errors.Is(err, internal.ErrZoneNotFound) {
+			continue
+		}
+		if errors.Is(err, ErrPermissionDenied) || errors.Is(err, ErrNotFound) {
+			projectErrs = append(projectErrs, err)
+
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		zoneProjects.set(cacheKey, projectID)
+
+		return dnsClient, zone, nil
+	}
+	if len(projectErrs) > 0 {
+		return nil, nil, fmt.Errorf("%w: %w", internal.ErrZoneNotFound, errors.Join(projectErrs...))
+	}
+
+	return nil, nil, internal.ErrZoneNotFound
+}
+
+func (d *DNSProvider) projectZone(ctx context.Context, projectID, zoneName string) (domainsV2.DNSClient[domainsV2.Zone, domainsV2.RRSet], *domainsV2.Zone, error) {
+	dnsClient, err := d.projectClient(projectID)
+	if err != nil {
+		return nil, nil, err
+	}
+	zone, err := internal.GetZoneByName(ctx, dnsClient, zoneName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("get zone in project %s: %w", projectID, err)
+	}
+
+	return dnsClient, zone, nil
+}
+
+// zoneCacheKey identifies zone of the account, zones of different
+// Keystone endpoints are cached separately.
+func (d *DNSProvider) zoneCacheKey(zoneName string) string {
+	return strings.Join([]string{
+		d.config.AuthURL,
+		string(d.config.CredentialsForDNS.AccountID),
+		normalizeZoneName(zoneName),
+	}, "/")
+}
+
+type zoneProjectCache struct {
+	mu      sync.Mutex
+	now     func() time.Time
+	entries map[string]zoneProjectEntry
+}
+
+type zoneProjectEntry struct {
+	projectID string
+	expiresAt time.Time
+}
+
+func newZoneProjectCache() *zoneProjectCache {
+	return &zoneProjectCache{
+		now:     time.Now,
+		entries: map[string]zoneProjectEntry{},
+	}
+}
+
+func (c *zoneProjectCache) get(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || c.now().After(entry.expiresAt) {
+		return "", false
+	}
+
+	return entry.projectID, true
+}
+
+func (c *zoneProjectCache) set(key, projectID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = zoneProjectEntry{
+		projectID: projectID,
+		expiresAt: c.now().Add(zoneProjectsCacheTTL),
+	}
+}
+
+func (c *zoneProjectCache) forget(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+}
@@ -0,0 +1,173 @@
+package selectel
+
+import (
+	"testing"
+	"time"
+
+	"github.com/selectel/cert-manager-webhook-selectel/internal/fakeselectel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfig_ProjectIDs(t *testing.T) {
+	t.Parallel()
+	config, err := NewConfigForDNS()
+	require.NoError(t, err)
+	config.CredentialsForDNS.ProjectID = []byte("project-a")
+	config.CredentialsForDNS.ProjectIDs = []byte("project-b, project-a,,project-c")
+	config.ZoneProjects = map[string]string{"example.com": "project-c"}
+
+	assert.Equal(t, []string{"project-a", "project-b", "project-c"}, config.projectIDs())
+}
+
+func TestConfig_ConfiguredProject(t *testing.T) {
+	t.Parallel()
+	config, err := NewConfigForDNS()
+	require.NoError(t, err)
+	config.ZoneProjects = map[string]string{
+		"example.com":      "project-a",
+		"prod.example.com": "project-b",
+	}
+
+	tests := map[string]string{
+		"example.com.":          "project-a",
+		"dev.example.com.":      "project-a",
+		"prod.example.com.":     "project-b",
+		"api.prod.example.com.": "project-b",
+		"Prod.Example.Com":      "project-b",
+	}
+	for zoneName, expected := range tests {
+		projectID, ok := config.configuredProject(zoneName)
+		assert.True(t, ok, zoneName)
+		assert.Equal(t, expected, projectID, zoneName)
+	}
+
+	_, ok := config.configuredProject("notexample.com.")
+	assert.False(t, ok)
+}
+
+func TestNewDNSProviderFromConfig_ProjectNotSetup(t *testing.T) {
+	t.Parallel()
+	server := fakeselectel.NewServer()
+	t.Cleanup(server.Close)
+	config := newFakeServerConfig(t, server)
+	config.CredentialsForDNS.ProjectID = nil
+
+	_, err := NewDNSProviderFromConfig(config)
+	assert.ErrorIs(t, err, errProjectNotSetup)
+}
+
+func TestDNSProvider_FindsZoneInAnotherProject(t *testing.T) {
+	t.Parallel()
+	server := fakeselectel.NewServer()
+	t.Cleanup(server.Close)
+	zoneID := server.AddProjectZone("project-b", "example.com.")
+	config := newFakeServerConfig(t, server)
+	config.CredentialsForDNS.ProjectID = nil
+	config.CredentialsForDNS.ProjectIDs = []byte("project-a,project-b")
+	fqdn := "_acme-challenge.example.com."
+
+	provider, err := NewDNSProviderFromConfig(config)
+	require.NoError(t, err)
+	require.NoError(t, provider.Present("example.com.", fqdn, "first"))
+	assert.Len(t, server.RRSets(zoneID), 1)
+	assert.Equal(t, 2, server.AuthRequests())
+	// zones of project-a and project-b, rrsets, creation of rrset
+	assert.Equal(t, 4, server.APIRequests())
+
+	// zone is not looked for in project-a again
+	provider, err = NewDNSProviderFromConfig(config)
+	require.NoError(t, err)
+	require.NoError(t, provider.CleanUp("example.com.", fqdn, "first"))
+	assert.Empty(t, server.RRSets(zoneID))
+	assert.Equal(t, 7, server.APIRequests())
+}
+
+func TestDNSProvider_ZoneNotFoundInProjects(t *testing.T) {
+	t.Parallel()
+	server := fakeselectel.NewServer()
+	t.Cleanup(server.Close)
+	server.AddProjectZone("project-c", "example.com.")
+	config := newFakeServerConfig(t, server)
+	config.CredentialsForDNS.ProjectIDs = []byte("project-a,project-b")
+
+	provider, err := NewDNSProviderFromConfig(config)
+	require.NoError(t, err)
+	err = provider.Present("example.com.", "_acme-challenge.example.com.", "value")
+	assert.ErrorContains(t, err, "zone not found")
+}
+
+func TestDNSProvider_SkipsDeniedProject(t *testing.T) {
+	t.Parallel()
+	server := fakeselectel.NewServer()
+	t.Cleanup(server.Close)
+	zoneID := server.AddProjectZone("project-b", "example.com.")
+	server.DenyProject("project-a")
+	config := newFakeServerConfig(t, server)
+	config.CredentialsForDNS.ProjectID = nil
+	config.CredentialsForDNS.ProjectIDs = []byte("project-a,project-b")
+
+	provider, err := NewDNSProviderFromConfig(config)
+	require.NoError(t, err)
+	require.NoError(t, provider.Present("example.com.", "_acme-challenge.example.com.", "value"))
+	assert.Len(t, server.RRSets(zoneID), 1)
+
+	// errors of skipped projects are returned if zone is not found
+	err = provider.Present("example.org.", "_acme-challenge.example.org.", "value")
+	require.ErrorIs(t, err, ErrPermissionDenied)
+	assert.ErrorContains(t, err, "zone not found")
+	assert.ErrorContains(t, err, "get zone in project project-a")
+}
+
+func TestDNSProvider_ZoneProjects(t *testing.T) {
+	t.Parallel()
+	server := fakeselectel.NewServer()
+	t.Cleanup(server.Close)
+	server.AddProjectZone("project-a", "example.com.")
+	zoneID := server.AddProjectZone("project-b", "sub.example.com.")
+	config := newFakeServerConfig(t, server)
+	config.CredentialsForDNS.ProjectID = nil
+	config.ZoneProjects = map[string]string{
+		"example.com":     "project-a",
+		"sub.example.com": "project-b",
+	}
+
+	provider, err := NewDNSProviderFromConfig(config)
+	require.NoError(t, err)
+	require.NoError(t, provider.Present("sub.example.com.", "_acme-challenge.sub.example.com.", "value"))
+	assert.Len(t, server.RRSets(zoneID), 1)
+}
+
+func TestDNSProvider_ProjectClientsAuthenticateConcurrently(t *testing.T) {
+	t.Parallel()
+	server := fakeselectel.NewServer()
+	t.Cleanup(server.Close)
+	config := newFakeServerConfig(t, server)
+	config.CredentialsForDNS.ProjectID = nil
+	config.CredentialsForDNS.ProjectIDs = []byte("project-a,project-b,project-c")
+	provider, err := NewDNSProviderFromConfig(config)
+	require.NoError(t, err)
+
+	release := server.BlockAuth("project-b")
+	t.Cleanup(release)
+	blocked := make(chan error, 1)
+	go func() {
+		_, err := provider.projectClient("project-b")
+		blocked <- err
+	}()
+	require.Eventually(t, func() bool {
+		provider.mu.Lock()
+		defer provider.mu.Unlock()
+		_, ok := provider.dnsClients["project-b"]
+
+		return ok
+	}, 5*time.Second, 10*time.Millisecond)
+	// authentication in project-b doesn't block project-c
+	_, err = provider.projectClient("project-c")
+	require.NoError(t, err)
+	assert.Empty(t, blocked)
+
+	release()
+	require.NoError(t, <-blocked)
+	assert.Equal(t, 3, server.AuthRequests())
+}
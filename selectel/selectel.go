@@ -8,9 +8,14 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
 	"time"
 
+	"github.com/go-playground/validator/v10"
 	"github.com/selectel/cert-manager-webhook-selectel/selectel/internal"
+	"github.com/selectel/cert-manager-webhook-selectel/utils"
 	domainsV2 "github.com/selectel/domains-go/pkg/v2"
 	"github.com/selectel/go-selvpcclient/v3/selvpcclient"
 )
@@ -18,27 +23,213 @@ import (
 const (
 	defaultBaseURL     = "https://api.selectel.ru/domains/v2"
 	minTTL             = 60
+	maxTTL             = 604800
 	defaultHTTPTimeout = 40
+	minHTTPTimeout     = 1
+	maxHTTPTimeout     = 300
+
+	defaultConnectTimeout = 10
+	defaultAuthTimeout    = 30
 
 	userAgent               = "cert-manager-webhook-selectel"
 	headerForOSProjectToken = "X-Auth-Token"
 )
 
-var errTTLMustBeGreaterOrEqualsMinTTL = fmt.Errorf("ttl must be greater or equals min ttl: %d", minTTL)
+var (
+	errConvertToValidator = errors.New("convert to validator")
+
+	// ErrDomainNotAllowed is returned when domain of challenge is denied
+	// by allowedDomains or deniedDomains.
+	ErrDomainNotAllowed = errors.New("domain is not allowed by issuer config")
+
+	// use a single instance of Validate, it caches struct info.
+	validate = newConfigValidator()
+)
 
 // Config is used to configure the creation of the DNSProvider.
 type Config struct {
-	BaseURL           string            `json:"baseUrl"     validate:"required,gt=0"`
-	TTL               int               `json:"ttl"         validate:"required"`
-	HTTPTimeout       int               `json:"httpTimeout" validate:"required"`
-	CredentialsForDNS CredentialsForDNS `json:"-"`
+	// BaseURL of Domains API v2. If empty, it is discovered
+	// from Keystone service catalog in Region.
+	BaseURL              string `json:"baseUrl"              validate:"omitempty,http_url"`
+	AllowInsecureBaseURL bool   `json:"allowInsecureBaseUrl"`
+	// AuthURL of Keystone identity endpoint. Default is selvpcclient.DefaultAuthURL.
+	AuthURL              string `json:"authUrl"              validate:"required,http_url"`
+	AllowInsecureAuthURL bool   `json:"allowInsecureAuthUrl"`
+	// Region of endpoints in Keystone service catalog. Default is selvpcclient.DefaultAuthRegion.
+	Region string `json:"region" validate:"required"`
+	TTL    int    `json:"ttl"    validate:"required"`
+	// HTTPTimeout limits a single request to Domains API, in seconds.
+	HTTPTimeout int `json:"httpTimeout" validate:"required"`
+	// ConnectTimeout limits establishing of connection to Selectel API, in seconds.
+	ConnectTimeout int `json:"connectTimeout" validate:"required"`
+	// AuthTimeout limits issuing of Keystone token, in seconds.
+	AuthTimeout int `json:"authTimeout" validate:"required"`
+	// MaxRetries of requests to Domains API failed with rate limit,
+	// server error or timeout. Zero disables retries.
+	MaxRetries int `json:"maxRetries"`
+	// ProxyURL for Keystone and Domains API requests.
+	// If empty, proxy is taken from HTTPS_PROXY and NO_PROXY env.
+	ProxyURL string `json:"proxyUrl" validate:"omitempty,url"`
+	// ZoneProjects maps zone suffix to project owning zones, e.g. "example.com"
+	// to project of example.com and its subzones. Projects of other zones
+	// are found by looking for zone in every project.
+	ZoneProjects map[string]string `json:"zoneProjects" validate:"omitempty,dive,keys,required,endkeys,required"`
+	// AllowedDomains are patterns of domains allowed for challenges, any domain
+	// is allowed if empty. DeniedDomains take precedence over allowed ones.
+	AllowedDomains []string `json:"allowedDomains" validate:"omitempty,dive,domain_pattern"`
+	DeniedDomains  []string `json:"deniedDomains"  validate:"omitempty,dive,domain_pattern"`
+	// ForeignRRSets is behavior with existing RRSet which is not created by webhook
+	// of the same cluster: share, refuse or takeover.
+	ForeignRRSets string `json:"foreignRRSets" validate:"required,oneof=share refuse takeover"`
+	// Cloud selects credentials in clouds.yaml of Secret, it may be empty
+	// if clouds.yaml has a single cloud.
+	Cloud string `json:"cloud"`
+	// Owner marks RRSets created by webhook.
+	Owner Owner `json:"-" validate:"-"`
+	// Limits of requests to Domains API per account, they are set by webhook flags or env.
+	Limits Limits `json:"-" validate:"-"`
+	// Breaker settings of circuit breakers of Keystone and Domains API endpoints.
+	Breaker BreakerSettings `json:"-" validate:"-"`
+	// Locker serializes changes of RRSet between replicas of webhook, nil disables locking.
+	Locker            Locker            `json:"-" validate:"-"`
+	CredentialsForDNS CredentialsForDNS `json:"-"        validate:"-"`
+	ProxyCredentials  ProxyCredentials  `json:"-"        validate:"-"`
+	// CABundle is PEM encoded certificates trusted in addition to system ones.
+	CABundle          []byte            `json:"-" validate:"-"`
+	ClientCertificate ClientCertificate `json:"-" validate:"-"`
+}
+
+// Validate checks endpoint, TTL and timeout settings of the config.
+// Credentials are validated separately, after they are read from the secret.
+func (config *Config) Validate() error {
+	err := validate.Struct(config)
+	if err == nil {
+		return nil
+	}
+	//nolint: errorlint
+	validationErrors, ok := err.(validator.ValidationErrors)
+	if !ok {
+		return errConvertToValidator
+	}
+
+	//nolint: wrapcheck
+	return utils.BuildErrFromValidator(validationErrors)
+}
+
+func newConfigValidator() *validator.Validate {
+	v := validator.New(validator.WithRequiredStructEnabled())
+	// use name in json tag as field name for validate output errors
+	v.RegisterTagNameFunc(utils.JSONFieldNameForValidator)
+	v.RegisterStructValidation(configStructLevelValidation, Config{})
+	err := v.RegisterValidation("domain_pattern", func(fl validator.FieldLevel) bool {
+		return utils.ValidateDomainPattern(fl.Field().String()) == nil
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	return v
+}
+
+// configStructLevelValidation checks bounds of TTL and timeout and requires
+// https scheme in base and auth urls unless it is explicitly allowed,
+// e.g. for a local fake of Selectel API.
+func configStructLevelValidation(sl validator.StructLevel) {
+	config, ok := sl.Current().Interface().(Config)
+	if !ok {
+		return
+	}
+	reportOutOfRange(sl, config.TTL, "ttl", "TTL", minTTL, maxTTL)
+	reportOutOfRange(sl, config.HTTPTimeout, "httpTimeout", "HTTPTimeout", minHTTPTimeout, maxHTTPTimeout)
+	reportOutOfRange(sl, config.ConnectTimeout, "connectTimeout", "ConnectTimeout", minHTTPTimeout, maxHTTPTimeout)
+	reportOutOfRange(sl, config.AuthTimeout, "authTimeout", "AuthTimeout", minHTTPTimeout, maxHTTPTimeout)
+	reportOutOfRange(sl, config.MaxRetries, "maxRetries", "MaxRetries", 0, maxMaxRetries)
+
+	if !config.AllowInsecureBaseURL {
+		reportInsecureURL(sl, config.BaseURL, "baseUrl", "BaseURL")
+	}
+	if !config.AllowInsecureAuthURL {
+		reportInsecureURL(sl, config.AuthURL, "authUrl", "AuthURL")
+	}
+}
+
+func reportInsecureURL(sl validator.StructLevel, value, fieldName, structFieldName string) {
+	// malformed url or url with another scheme is reported by http_url tag
+	parsedURL, err := url.Parse(value)
+	if err != nil {
+		return
+	}
+	if parsedURL.Scheme == "http" {
+		sl.ReportError(value, fieldName, structFieldName, "https", "")
+	}
+}
+
+func reportOutOfRange(sl validator.StructLevel, value int, fieldName, structFieldName string, minValue, maxValue int) {
+	// zero value is reported by required tag
+	if value == 0 {
+		return
+	}
+	if value < minValue {
+		sl.ReportError(value, fieldName, structFieldName, "gte", strconv.Itoa(minValue))
+	}
+	if value > maxValue {
+		sl.ReportError(value, fieldName, structFieldName, "lte", strconv.Itoa(maxValue))
+	}
+}
+
+// CheckChallenge checks domains of challenge with CheckDomain: domain of its record
+// resolvedFQDN, which may be changed by CNAME, and DNS name of certificate.
+func (config *Config) CheckChallenge(dnsName, resolvedFQDN string) error {
+	domain := utils.ChallengeDomain(resolvedFQDN)
+	if err := config.CheckDomain(domain); err != nil {
+		return err
+	}
+	if dnsName == "" || utils.ChallengeDomain(dnsName) == domain {
+		return nil
+	}
+
+	return config.CheckDomain(dnsName)
+}
+
+// CheckDomain returns ErrDomainNotAllowed if domain of challenge matches
+// deniedDomains or doesn't match allowedDomains. Challenge of wildcard certificate
+// has DNS name without "*.", so both lists are matched with
+// utils.MatchAnyChallengeDomain.
+func (config *Config) CheckDomain(domain string) error {
+	if utils.MatchAnyChallengeDomain(config.DeniedDomains, domain) {
+		return fmt.Errorf("%w: %s matches deniedDomains", ErrDomainNotAllowed, domain)
+	}
+	if len(config.AllowedDomains) > 0 && !utils.MatchAnyChallengeDomain(config.AllowedDomains, domain) {
+		return fmt.Errorf("%w: %s doesn't match allowedDomains", ErrDomainNotAllowed, domain)
+	}
+
+	return nil
 }
 
 type CredentialsForDNS struct {
 	Username  []byte `json:"username"   validate:"required,gt=0"`
 	Password  []byte `json:"password"   validate:"required,gt=0"`
 	AccountID []byte `json:"account_id" validate:"required,gt=0"`
-	ProjectID []byte `json:"project_id" validate:"required,gt=0"`
+	// ProjectID is required unless ProjectIDs or Config.ZoneProjects is set.
+	ProjectID []byte `json:"project_id"`
+	// ProjectIDs is comma separated list of projects owning zones.
+	ProjectIDs []byte `json:"project_ids"`
+}
+
+// Validate checks that credentials required to issue Keystone token are set.
+func (credentials *CredentialsForDNS) Validate() error {
+	err := validate.Struct(credentials)
+	if err == nil {
+		return nil
+	}
+	//nolint: errorlint
+	validationErrors, ok := err.(validator.ValidationErrors)
+	if !ok {
+		return errConvertToValidator
+	}
+
+	//nolint: wrapcheck
+	return utils.BuildErrFromValidator(validationErrors)
 }
 
 func (credentials *CredentialsForDNS) FromMapBytes(dataFromSecret map[string][]byte) error {
@@ -57,51 +248,94 @@ func (credentials *CredentialsForDNS) FromMapBytes(dataFromSecret map[string][]b
 // NewDefaultConfig returns a default configuration for the DNSProvider.
 func NewConfigForDNS() (*Config, error) {
 	cfg := &Config{
-		BaseURL:     defaultBaseURL,
-		TTL:         minTTL,
-		HTTPTimeout: defaultHTTPTimeout,
+		BaseURL:        defaultBaseURL,
+		AuthURL:        selvpcclient.DefaultAuthURL,
+		Region:         selvpcclient.DefaultAuthRegion,
+		TTL:            minTTL,
+		HTTPTimeout:    defaultHTTPTimeout,
+		ConnectTimeout: defaultConnectTimeout,
+		AuthTimeout:    defaultAuthTimeout,
+		MaxRetries:     defaultMaxRetries,
+		ForeignRRSets:  ForeignRRSetsShare,
 	}
 
 	return cfg, nil
 }
 
-// DNSProvider is an implementation of the acme.ChallengeProvider interface.
+// DNSProvider presents records of DNS-01 challenges in zones of Selectel DNS Hosting,
+// LegoProvider adapts it to challenge.Provider interface of lego.
 type DNSProvider struct {
-	config    *Config
-	dnsClient domainsV2.DNSClient[domainsV2.Zone, domainsV2.RRSet]
+	config *Config
+
+	mu         sync.Mutex
+	dnsClients map[string]*projectDNSClient
 }
 
 // NewDNSProviderFromConfig return a DNSProvider instance configured for selectel.
 func NewDNSProviderFromConfig(config *Config) (*DNSProvider, error) {
-	if config.TTL < minTTL {
-		return nil, errTTLMustBeGreaterOrEqualsMinTTL
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("validate config: %w", err)
+	}
+
+	projectIDs := config.projectIDs()
+	if len(projectIDs) == 0 {
+		return nil, errProjectNotSetup
 	}
 
-	dnsClient, err := getDNSClientFromConfig(config)
+	provider := &DNSProvider{
+		config:     config,
+		dnsClients: map[string]*projectDNSClient{},
+	}
+	// clients of other projects are created on demand,
+	// the first one is created beforehand to fail fast on wrong credentials
+	dnsClient, err := getDNSClientFromConfig(config.forProject(projectIDs[0]))
 	if err != nil {
 		return nil, err
 	}
+	provider.dnsClients[projectIDs[0]] = &projectDNSClient{client: dnsClient}
+
+	return provider, nil
+}
 
-	return &DNSProvider{
-		config:    config,
-		dnsClient: dnsClient,
-	}, nil
+// Record identifies TXT RRSet with record of challenge.
+type Record struct {
+	ZoneID  string
+	RRSetID string
 }
 
 // Present creates a recor in TXT RRSet to fulfill DNS-01 challenge.
 func (d *DNSProvider) Present(zoneName, fqdn, value string) error {
+	_, err := d.PresentRecord(zoneName, fqdn, value)
+
+	return err
+}
+
+// PresentRecord is Present returning RRSet with created record.
+func (d *DNSProvider) PresentRecord(zoneName, fqdn, value string) (*Record, error) {
+	record, err := d.presentRecord(zoneName, fqdn, value)
+	observeChallenge("present", err)
+
+	return record, err
+}
+
+func (d *DNSProvider) presentRecord(zoneName, fqdn, value string) (*Record, error) {
 	ctx := context.Background()
-	zone, err := internal.GetZoneByName(ctx, d.dnsClient, zoneName)
+	unlock, err := d.lock(ctx, zoneName, fqdn)
 	if err != nil {
-		return fmt.Errorf("get zone by name: %w", err)
+		return nil, err
+	}
+	defer unlock()
+	dnsClient, zone, err := d.findZone(ctx, zoneName)
+	if err != nil {
+		return nil, fmt.Errorf("get zone by name: %w", err)
 	}
-	rrset, err := internal.GetRrsetByNameAndType(ctx, d.dnsClient, zone.ID, fqdn, string(domainsV2.TXT))
+	rrset, err := internal.GetRrsetByNameAndType(ctx, dnsClient, zone.ID, fqdn, string(domainsV2.TXT))
 	if err != nil && !errors.Is(err, internal.ErrRrsetNotFound) {
-		return fmt.Errorf("get rrset by name: %w", err)
+		return nil, fmt.Errorf("get rrset by name: %w", err)
 	}
 	// Escaping quotes in TXT record
 	content := fmt.Sprintf("\"%s\"", value)
-	// Create RRSet if not exists
+	// Create RRSet marked as owned if not exists
 	// else added one record to existing RRSet
 	if errors.Is(err, internal.ErrRrsetNotFound) {
 		createRrsetOpts := &domainsV2.RRSet{
@@ -110,61 +344,86 @@ func (d *DNSProvider) Present(zoneName, fqdn, value string) error {
 			Records: []domainsV2.RecordItem{
 				{Content: content},
 			},
-			Type: domainsV2.TXT,
-		}
-		_, err = d.dnsClient.CreateRRSet(ctx, zone.ID, createRrsetOpts)
-		if err != nil {
-			return fmt.Errorf("create new rrset: %w", err)
-		}
-	} else {
-		record := domainsV2.RecordItem{
-			Content: content,
-		}
-		rrset.Records = append(rrset.Records, record)
-		updateRrsetOpts := &domainsV2.RRSet{
-			TTL:     rrset.TTL,
-			Records: rrset.Records,
 			Type:    domainsV2.TXT,
+			Comment: d.config.Owner.comment(),
 		}
-		err = d.dnsClient.UpdateRRSet(ctx, zone.ID, rrset.ID, updateRrsetOpts)
+		created, err := dnsClient.CreateRRSet(ctx, zone.ID, createRrsetOpts)
 		if err != nil {
-			return fmt.Errorf("added record to existsing rrset: %w", err)
+			return nil, fmt.Errorf("create new rrset: %w", err)
 		}
+
+		return &Record{ZoneID: zone.ID, RRSetID: created.ID}, nil
+	}
+	comment, err := d.rrsetComment(rrset)
+	if err != nil {
+		return nil, err
+	}
+	record := domainsV2.RecordItem{
+		Content: content,
+	}
+	rrset.Records = append(rrset.Records, record)
+	updateRrsetOpts := &domainsV2.RRSet{
+		TTL:     rrset.TTL,
+		Records: rrset.Records,
+		Type:    domainsV2.TXT,
+		Comment: comment,
+	}
+	err = dnsClient.UpdateRRSet(ctx, zone.ID, rrset.ID, updateRrsetOpts)
+	if err != nil {
+		return nil, fmt.Errorf("added record to existsing rrset: %w", err)
 	}
 
-	return nil
+	return &Record{ZoneID: zone.ID, RRSetID: rrset.ID}, nil
 }
 
 // CleanUp removes a record from TXT RRSet used for DNS-01 challenge.
 func (d *DNSProvider) CleanUp(zoneName, fqdn, value string) error {
+	err := d.cleanUp(zoneName, fqdn, value)
+	observeChallenge("cleanup", err)
+
+	return err
+}
+
+func (d *DNSProvider) cleanUp(zoneName, fqdn, value string) error {
 	ctx := context.Background()
-	zone, err := internal.GetZoneByName(ctx, d.dnsClient, zoneName)
+	unlock, err := d.lock(ctx, zoneName, fqdn)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	dnsClient, zone, err := d.findZone(ctx, zoneName)
 	if err != nil {
 		return fmt.Errorf("get zone by name: %w", err)
 	}
-	rrset, err := internal.GetRrsetByNameAndType(ctx, d.dnsClient, zone.ID, fqdn, string(domainsV2.TXT))
+	rrset, err := internal.GetRrsetByNameAndType(ctx, dnsClient, zone.ID, fqdn, string(domainsV2.TXT))
 	if err != nil {
 		return fmt.Errorf("get rrset by name and type: %w", err)
 	}
-	// if RRSet has one records delete rrset
+	// Escaping quotes in TXT record
+	content := fmt.Sprintf("\"%s\"", value)
+	newRecords := []domainsV2.RecordItem{}
+	for i := range rrset.Records {
+		if rrset.Records[i].Content != content {
+			newRecords = append(newRecords, rrset.Records[i])
+		}
+	}
+	// RRSet without record of challenge is not touched,
+	// it may be created by another system or cluster
+	if len(newRecords) == len(rrset.Records) {
+		return nil
+	}
+	// if record of challenge is the last one delete rrset
 	// else remove one record from RRSet
-	if len(rrset.Records) == 1 {
-		err = d.dnsClient.DeleteRRSet(ctx, zone.ID, rrset.ID)
+	if len(newRecords) == 0 {
+		err = dnsClient.DeleteRRSet(ctx, zone.ID, rrset.ID)
 		if err != nil {
 			return fmt.Errorf("delete rrset: %w", err)
 		}
 	} else {
-		newRecords := []domainsV2.RecordItem{}
-		for i := range rrset.Records {
-			// Escaping quotes in TXT record
-			content := fmt.Sprintf("\"%s\"", value)
-			if rrset.Records[i].Content != content {
-				newRecords = append(newRecords, rrset.Records[i])
-			}
-		}
-		err = d.dnsClient.UpdateRRSet(ctx, zone.ID, rrset.ID, &domainsV2.RRSet{
+		err = dnsClient.UpdateRRSet(ctx, zone.ID, rrset.ID, &domainsV2.RRSet{
 			TTL:     rrset.TTL,
 			Records: newRecords,
+			Comment: rrset.Comment,
 		})
 		if err != nil {
 			return fmt.Errorf("delete one record from rrset: %w", err)
@@ -176,28 +435,44 @@ func (d *DNSProvider) CleanUp(zoneName, fqdn, value string) error {
 
 func getDNSClientFromConfig(config *Config) (domainsV2.DNSClient[domainsV2.Zone, domainsV2.RRSet], error) {
 	ctx := context.Background()
-	options := &selvpcclient.ClientOptions{
-		Context:    ctx,
-		DomainName: string(config.CredentialsForDNS.AccountID),
-		Username:   string(config.CredentialsForDNS.Username),
-		Password:   string(config.CredentialsForDNS.Password),
-		ProjectID:  string(config.CredentialsForDNS.ProjectID),
+	transport, err := transports.get(config)
+	if err != nil {
+		return nil, fmt.Errorf("setup http transport: %w", err)
 	}
 
-	client, err := selvpcclient.NewClient(options)
-	if err != nil {
-		return nil, fmt.Errorf("setup selvpc client: %w", err)
+	tokenSource := newKeystoneTokenSource(config, &http.Client{Transport: transport})
+	// issue token beforehand to fail fast on wrong credentials
+	if _, err = tokenSource.Token(ctx); err != nil {
+		return nil, err
+	}
+
+	baseURL := config.BaseURL
+	if baseURL == "" {
+		baseURL, err = tokenSource.discoverBaseURL(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("discover domains api endpoint: %w", err)
+		}
 	}
 
-	projectToken := client.GetXAuthToken()
 	hdrs := http.Header{}
-	hdrs.Add(headerForOSProjectToken, projectToken)
 	hdrs.Add("User-Agent", userAgent)
 
 	httpClient := &http.Client{
-		Timeout: time.Duration(config.HTTPTimeout) * time.Second,
+		Transport: &responseInfoTransport{
+			next: &tokenTransport{
+				source: tokenSource,
+				next: &requestTimeoutTransport{
+					next:    transport,
+					timeout: time.Duration(config.HTTPTimeout) * time.Second,
+				},
+			},
+		},
 	}
-	domainsClient := domainsV2.NewClient(config.BaseURL, httpClient, hdrs)
+	domainsClient := domainsV2.NewClient(baseURL, httpClient, hdrs)
+
+	client := newAPIClient(domainsClient, config.MaxRetries)
+	client.limiter = accountLimiters.get(string(config.CredentialsForDNS.AccountID), config.Limits)
+	client.breaker = circuitBreakers.get(baseURL, config.Breaker)
 
-	return domainsClient, nil
+	return client, nil
 }
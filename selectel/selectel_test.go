@@ -3,8 +3,12 @@ package selectel
 import (
 	"testing"
 
+	"github.com/selectel/cert-manager-webhook-selectel/internal/fakeselectel"
+	domainsV2 "github.com/selectel/domains-go/pkg/v2"
+	"github.com/selectel/go-selvpcclient/v3/selvpcclient"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"k8s.io/component-base/metrics/testutil"
 )
 
 func TestNewConfigForDNS_setupDefaultValues(t *testing.T) {
@@ -13,8 +17,13 @@ func TestNewConfigForDNS_setupDefaultValues(t *testing.T) {
 	require.NoError(t, err)
 
 	assert.Equal(t, defaultBaseURL, cfg.BaseURL)
+	assert.Equal(t, selvpcclient.DefaultAuthURL, cfg.AuthURL)
+	assert.Equal(t, selvpcclient.DefaultAuthRegion, cfg.Region)
 	assert.Equal(t, defaultHTTPTimeout, cfg.HTTPTimeout)
 	assert.Equal(t, minTTL, cfg.TTL)
+	assert.Equal(t, defaultConnectTimeout, cfg.ConnectTimeout)
+	assert.Zero(t, cfg.MaxRetries)
+	assert.Equal(t, defaultAuthTimeout, cfg.AuthTimeout)
 }
 
 func TestNewDNSProviderConfig_BadTTL(t *testing.T) {
@@ -26,5 +35,316 @@ func TestNewDNSProviderConfig_BadTTL(t *testing.T) {
 	config.TTL = testTTL
 
 	_, err = NewDNSProviderFromConfig(config)
-	assert.ErrorIs(t, err, errTTLMustBeGreaterOrEqualsMinTTL)
+	assert.ErrorContains(t, err, "validate config: ttl must be greater or equals 60")
+}
+
+func TestConfigValidate_Valid(t *testing.T) {
+	t.Parallel()
+	config, err := NewConfigForDNS()
+	require.NoError(t, err)
+
+	require.NoError(t, config.Validate())
+
+	// base url is discovered from service catalog
+	config.BaseURL = ""
+	require.NoError(t, config.Validate())
+
+	config.BaseURL = "http://127.0.0.1:8080/domains/v2"
+	config.AllowInsecureBaseURL = true
+	config.AuthURL = "http://127.0.0.1:5000/identity/v3/"
+	config.AllowInsecureAuthURL = true
+	config.TTL = maxTTL
+	config.HTTPTimeout = maxHTTPTimeout
+	require.NoError(t, config.Validate())
+}
+
+func TestConfigValidate_Invalid(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name          string
+		modify        func(config *Config)
+		expectedError string
+	}{
+		{
+			name:          "malformed base url",
+			modify:        func(config *Config) { config.BaseURL = "api.selectel.ru/domains/v2" },
+			expectedError: "baseUrl must be valid url",
+		},
+		{
+			name:          "http base url",
+			modify:        func(config *Config) { config.BaseURL = "http://api.selectel.ru/domains/v2" },
+			expectedError: "baseUrl must use https scheme",
+		},
+		{
+			name:          "malformed auth url",
+			modify:        func(config *Config) { config.AuthURL = "cloud.api.selcloud.ru/identity/v3/" },
+			expectedError: "authUrl must be valid url",
+		},
+		{
+			name:          "http auth url",
+			modify:        func(config *Config) { config.AuthURL = "http://cloud.api.selcloud.ru/identity/v3/" },
+			expectedError: "authUrl must use https scheme",
+		},
+		{
+			name:          "empty ttl",
+			modify:        func(config *Config) { config.TTL = 0 },
+			expectedError: "setup ttl field",
+		},
+		{
+			name:          "ttl less than min",
+			modify:        func(config *Config) { config.TTL = minTTL - 1 },
+			expectedError: "ttl must be greater or equals 60",
+		},
+		{
+			name:          "ttl greater than max",
+			modify:        func(config *Config) { config.TTL = maxTTL + 1 },
+			expectedError: "ttl must be less or equals 604800",
+		},
+		{
+			name:          "empty http timeout",
+			modify:        func(config *Config) { config.HTTPTimeout = 0 },
+			expectedError: "setup httpTimeout field",
+		},
+		{
+			name:          "negative http timeout",
+			modify:        func(config *Config) { config.HTTPTimeout = -1 },
+			expectedError: "httpTimeout must be greater or equals 1",
+		},
+		{
+			name:          "http timeout greater than max",
+			modify:        func(config *Config) { config.HTTPTimeout = maxHTTPTimeout + 1 },
+			expectedError: "httpTimeout must be less or equals 300",
+		},
+		{
+			name:          "empty connect timeout",
+			modify:        func(config *Config) { config.ConnectTimeout = 0 },
+			expectedError: "setup connectTimeout field",
+		},
+		{
+			name:          "connect timeout greater than max",
+			modify:        func(config *Config) { config.ConnectTimeout = maxHTTPTimeout + 1 },
+			expectedError: "connectTimeout must be less or equals 300",
+		},
+		{
+			name:          "negative auth timeout",
+			modify:        func(config *Config) { config.AuthTimeout = -1 },
+			expectedError: "authTimeout must be greater or equals 1",
+		},
+		{
+			name:          "max retries greater than max",
+			modify:        func(config *Config) { config.MaxRetries = maxMaxRetries + 1 },
+			expectedError: "maxRetries must be less or equals 10",
+		},
+		{
+			name:          "empty project of zone suffix",
+			modify:        func(config *Config) { config.ZoneProjects = map[string]string{"example.com": ""} },
+			expectedError: "setup zoneProjects[example.com] field",
+		},
+		{
+			name:          "invalid allowed domain pattern",
+			modify:        func(config *Config) { config.AllowedDomains = []string{"example.com", "[.example.com"} },
+			expectedError: "allowedDomains[1] must be valid domain pattern",
+		},
+		{
+			name:          "unknown foreign rrsets behavior",
+			modify:        func(config *Config) { config.ForeignRRSets = "ignore" },
+			expectedError: "foreignRRSets must be one of: share refuse takeover",
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+			config, err := NewConfigForDNS()
+			require.NoError(t, err)
+			testCase.modify(config)
+
+			err = config.Validate()
+			require.Error(t, err)
+			assert.Equal(t, testCase.expectedError, err.Error())
+		})
+	}
+}
+
+func TestNewDNSProviderConfig_InvalidConfig(t *testing.T) {
+	t.Parallel()
+	config, err := NewConfigForDNS()
+	require.NoError(t, err)
+
+	config.HTTPTimeout = maxHTTPTimeout + 1
+
+	_, err = NewDNSProviderFromConfig(config)
+	assert.ErrorContains(t, err, "validate config: httpTimeout must be less or equals 300")
+}
+
+func TestConfigCheckDomain(t *testing.T) {
+	t.Parallel()
+	config, err := NewConfigForDNS()
+	require.NoError(t, err)
+	require.NoError(t, config.CheckDomain("example.com"))
+
+	config.AllowedDomains = []string{"*.dev.example.com", "dev.example.com"}
+	config.DeniedDomains = []string{"db.dev.example.com"}
+	require.NoError(t, config.CheckDomain("dev.example.com"))
+	require.NoError(t, config.CheckDomain("api.dev.example.com"))
+
+	err = config.CheckDomain("example.com")
+	require.ErrorIs(t, err, ErrDomainNotAllowed)
+	assert.Equal(t, "domain is not allowed by issuer config: example.com doesn't match allowedDomains", err.Error())
+	err = config.CheckDomain("db.dev.example.com")
+	require.ErrorIs(t, err, ErrDomainNotAllowed)
+	assert.Equal(t, "domain is not allowed by issuer config: db.dev.example.com matches deniedDomains", err.Error())
+
+	config.AllowedDomains = nil
+	config.DeniedDomains = []string{"example.com"}
+	require.ErrorIs(t, config.CheckDomain("example.com"), ErrDomainNotAllowed)
+	require.NoError(t, config.CheckDomain("www.example.com"))
+}
+
+func TestConfigCheckChallenge(t *testing.T) {
+	t.Parallel()
+	config, err := NewConfigForDNS()
+	require.NoError(t, err)
+	config.AllowedDomains = []string{"*.dev.example.com"}
+
+	// cert-manager sends DNS name of wildcard certificate *.dev.example.com without "*."
+	require.NoError(t, config.CheckChallenge("dev.example.com", "_acme-challenge.dev.example.com."))
+	require.NoError(t, config.CheckChallenge("api.dev.example.com", "_acme-challenge.api.dev.example.com."))
+	require.ErrorIs(t, config.CheckChallenge("example.com", "_acme-challenge.example.com."), ErrDomainNotAllowed)
+
+	// record followed by CNAME into another zone is checked as well
+	err = config.CheckChallenge("api.dev.example.com", "_acme-challenge.example.com.")
+	require.ErrorIs(t, err, ErrDomainNotAllowed)
+	assert.Equal(t, "domain is not allowed by issuer config: example.com doesn't match allowedDomains", err.Error())
+	config.AllowedDomains = append(config.AllowedDomains, "acme.example.net")
+	require.NoError(t, config.CheckChallenge("api.dev.example.com", "acme.example.net."))
+
+	config.DeniedDomains = []string{"*.dev.example.com"}
+	err = config.CheckChallenge("dev.example.com", "_acme-challenge.dev.example.com.")
+	require.ErrorIs(t, err, ErrDomainNotAllowed)
+	assert.Equal(t, "domain is not allowed by issuer config: dev.example.com matches deniedDomains", err.Error())
+	require.ErrorIs(t, config.CheckChallenge("api.dev.example.com", "acme.example.net."), ErrDomainNotAllowed)
+}
+
+func TestKeystoneAuthOptions(t *testing.T) {
+	t.Parallel()
+	config, err := NewConfigForDNS()
+	require.NoError(t, err)
+	config.CredentialsForDNS = CredentialsForDNS{
+		Username:  []byte("user"),
+		Password:  []byte("password"),
+		AccountID: []byte("123456"),
+		ProjectID: []byte("project-id"),
+	}
+
+	options := keystoneAuthOptions(config)
+	assert.Equal(t, selvpcclient.DefaultAuthURL, options.IdentityEndpoint)
+	assert.Equal(t, "user", options.Username)
+	assert.Equal(t, "password", options.Password)
+	assert.Equal(t, "123456", options.DomainName)
+	assert.Equal(t, "project-id", options.Scope.ProjectID)
+
+	// token is scoped to account without project
+	config.CredentialsForDNS.ProjectID = nil
+	config.AuthURL = "https://identity.example.com/v3/"
+	options = keystoneAuthOptions(config)
+	assert.Equal(t, "https://identity.example.com/v3/", options.IdentityEndpoint)
+	assert.Empty(t, options.Scope.ProjectID)
+	assert.Equal(t, "123456", options.Scope.DomainName)
+}
+
+// newFakeServerConfig returns config for Keystone and Domains API of fake server.
+func newFakeServerConfig(t *testing.T, server *fakeselectel.Server) *Config {
+	t.Helper()
+	config, err := NewConfigForDNS()
+	require.NoError(t, err)
+	config.BaseURL = server.BaseURL()
+	config.AllowInsecureBaseURL = true
+	config.AuthURL = server.AuthURL()
+	config.AllowInsecureAuthURL = true
+	config.CredentialsForDNS = CredentialsForDNS{
+		Username:  []byte("user"),
+		Password:  []byte("password"),
+		AccountID: []byte("123456"),
+		ProjectID: []byte("project-id"),
+	}
+
+	return config
+}
+
+func TestDNSProvider_PresentAndCleanUp(t *testing.T) {
+	t.Parallel()
+	server := fakeselectel.NewServer()
+	t.Cleanup(server.Close)
+	zoneID := server.AddZone("example.com.")
+	provider, err := NewDNSProviderFromConfig(newFakeServerConfig(t, server))
+	require.NoError(t, err)
+	fqdn := "_acme-challenge.example.com."
+
+	require.NoError(t, provider.Present("example.com.", fqdn, "first"))
+	require.NoError(t, provider.Present("example.com.", fqdn, "second"))
+	rrsets := server.RRSets(zoneID)
+	require.Len(t, rrsets, 1)
+	assert.Equal(t, []domainsV2.RecordItem{{Content: `"first"`}, {Content: `"second"`}}, rrsets[0].Records)
+
+	require.NoError(t, provider.CleanUp("example.com.", fqdn, "first"))
+	rrsets = server.RRSets(zoneID)
+	require.Len(t, rrsets, 1)
+	assert.Equal(t, []domainsV2.RecordItem{{Content: `"second"`}}, rrsets[0].Records)
+
+	require.NoError(t, provider.CleanUp("example.com.", fqdn, "second"))
+	assert.Empty(t, server.RRSets(zoneID))
+}
+
+func TestDNSProvider_PresentRecord(t *testing.T) {
+	t.Parallel()
+	server := fakeselectel.NewServer()
+	t.Cleanup(server.Close)
+	zoneID := server.AddZone("example.com.")
+	provider, err := NewDNSProviderFromConfig(newFakeServerConfig(t, server))
+	require.NoError(t, err)
+	fqdn := "_acme-challenge.example.com."
+
+	created, err := provider.PresentRecord("example.com.", fqdn, "first")
+	require.NoError(t, err)
+	updated, err := provider.PresentRecord("example.com.", fqdn, "second")
+	require.NoError(t, err)
+	rrsets := server.RRSets(zoneID)
+	require.Len(t, rrsets, 1)
+	expected := &Record{ZoneID: zoneID, RRSetID: rrsets[0].ID}
+	assert.Equal(t, expected, created)
+	assert.Equal(t, expected, updated)
+}
+
+func TestDNSProvider_DiscoverBaseURL(t *testing.T) {
+	t.Parallel()
+	server := fakeselectel.NewServer()
+	t.Cleanup(server.Close)
+	zoneID := server.AddZone("example.com.")
+	config := newFakeServerConfig(t, server)
+	config.BaseURL = ""
+	provider, err := NewDNSProviderFromConfig(config)
+	require.NoError(t, err)
+
+	require.NoError(t, provider.Present("example.com.", "_acme-challenge.example.com.", "value"))
+	assert.Len(t, server.RRSets(zoneID), 1)
+}
+
+func TestDNSProvider_ChallengesMetric(t *testing.T) {
+	t.Parallel()
+	RegisterMetrics()
+	server := fakeselectel.NewServer()
+	t.Cleanup(server.Close)
+	server.AddProjectZone("project-metric", "example.com.")
+	server.DenyProject("project-metric")
+	config := newFakeServerConfig(t, server)
+	config.CredentialsForDNS.ProjectID = []byte("project-metric")
+	provider, err := NewDNSProviderFromConfig(config)
+	require.NoError(t, err)
+
+	// failure is labeled by ErrorReason, no other test fails cleanup with it
+	err = provider.CleanUp("example.com.", "_acme-challenge.example.com.", "value")
+	require.ErrorIs(t, err, ErrPermissionDenied)
+	denied, err := testutil.GetCounterMetricValue(challengesTotal.WithLabelValues("cleanup", "PermissionDenied"))
+	require.NoError(t, err)
+	assert.InDelta(t, 1, denied, 0)
 }
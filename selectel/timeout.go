@@ -0,0 +1,124 @@
+package selectel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// TimeoutStage is a step of interaction with Selectel API which has not finished in time.
+type TimeoutStage string
+
+const (
+	// TimeoutStageConnect is establishing of TCP connection to Keystone or Domains API.
+	TimeoutStageConnect TimeoutStage = "connect"
+	// TimeoutStageAuth is issuing of Keystone token.
+	TimeoutStageAuth TimeoutStage = "auth"
+	// TimeoutStageRequest is a single request to Domains API.
+	TimeoutStageRequest TimeoutStage = "request"
+)
+
+// TimeoutError is returned when Selectel API has not responded in time.
+// Stage allows to tell slow authentication from slow DNS API.
+type TimeoutError struct {
+	Stage TimeoutStage
+	Limit time.Duration
+	Err   error
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("%s timeout %s exceeded: %v", e.Stage, e.Limit, e.Err)
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// Timeout reports the error as timeout like net.Error does.
+func (e *TimeoutError) Timeout() bool {
+	return true
+}
+
+// wrapTimeout converts err to TimeoutError of the stage if ctx deadline is exceeded.
+// Timeout of an earlier stage, e.g. connect during auth, is kept as is.
+func wrapTimeout(ctx context.Context, err error, stage TimeoutStage, timeout time.Duration) error {
+	var timeoutErr *TimeoutError
+	if errors.As(err, &timeoutErr) {
+		return err
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return &TimeoutError{Stage: stage, Limit: timeout, Err: err}
+	}
+
+	return err
+}
+
+// dialContextWithTimeout limits connection establishment with connect timeout.
+func dialContextWithTimeout(dialer *net.Dialer, timeout time.Duration) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		conn, err := dialer.DialContext(dialCtx, network, addr)
+		if err != nil {
+			// deadline of parent context belongs to the caller's stage
+			if ctx.Err() == nil {
+				return nil, wrapTimeout(dialCtx, err, TimeoutStageConnect, timeout)
+			}
+
+			return nil, err //nolint: wrapcheck
+		}
+
+		return conn, nil
+	}
+}
+
+// requestTimeoutTransport limits every request to Domains API with timeout,
+// including reading of response body.
+type requestTimeoutTransport struct {
+	next    http.RoundTripper
+	timeout time.Duration
+}
+
+func (t *requestTimeoutTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(request.Context(), t.timeout)
+	response, err := t.next.RoundTrip(request.WithContext(ctx))
+	if err != nil {
+		defer cancel()
+
+		return nil, wrapTimeout(ctx, err, TimeoutStageRequest, t.timeout)
+	}
+	response.Body = &cancelOnCloseBody{
+		ReadCloser: response.Body,
+		ctx:        ctx,
+		cancel:     cancel,
+		timeout:    t.timeout,
+	}
+
+	return response, nil
+}
+
+type cancelOnCloseBody struct {
+	io.ReadCloser
+	ctx     context.Context //nolint: containedctx
+	cancel  context.CancelFunc
+	timeout time.Duration
+}
+
+func (b *cancelOnCloseBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return n, wrapTimeout(b.ctx, err, TimeoutStageRequest, b.timeout)
+	}
+
+	return n, err //nolint: wrapcheck
+}
+
+func (b *cancelOnCloseBody) Close() error {
+	defer b.cancel()
+
+	return b.ReadCloser.Close() //nolint: wrapcheck
+}
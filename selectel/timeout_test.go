@@ -0,0 +1,115 @@
+package selectel
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newStalledServer starts server which doesn't respond until request is canceled.
+func newStalledServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// closing of connection by client is noticed only after body is read
+		_, _ = io.Copy(io.Discard, r.Body)
+		select {
+		case <-r.Context().Done():
+		case <-time.After(10 * time.Second):
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestAuthenticate_Timeout(t *testing.T) {
+	t.Parallel()
+	keystone := newStalledServer(t)
+	config, err := NewConfigForDNS()
+	require.NoError(t, err)
+	config.AuthURL = keystone.URL + "/identity/v3/"
+	config.AuthTimeout = 1
+	config.CredentialsForDNS = CredentialsForDNS{
+		Username:  []byte("user"),
+		Password:  []byte("password"),
+		AccountID: []byte("123456"),
+		ProjectID: []byte("project-id"),
+	}
+	transport, err := newHTTPTransport(config)
+	require.NoError(t, err)
+
+	_, err = authenticate(t.Context(), config, &http.Client{Transport: transport})
+	var timeoutErr *TimeoutError
+	require.ErrorAs(t, err, &timeoutErr)
+	assert.Equal(t, TimeoutStageAuth, timeoutErr.Stage)
+	assert.Equal(t, time.Second, timeoutErr.Limit)
+}
+
+func TestRequestTimeoutTransport_Timeout(t *testing.T) {
+	t.Parallel()
+	server := newStalledServer(t)
+	transport := &requestTimeoutTransport{
+		next:    http.DefaultTransport,
+		timeout: 50 * time.Millisecond,
+	}
+
+	err := doGet(t, transport, server.URL)
+	var timeoutErr *TimeoutError
+	require.ErrorAs(t, err, &timeoutErr)
+	assert.Equal(t, TimeoutStageRequest, timeoutErr.Stage)
+}
+
+func TestRequestTimeoutTransport_BodyIsReadableAfterRoundTrip(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, "response body")
+	}))
+	t.Cleanup(server.Close)
+	transport := &requestTimeoutTransport{
+		next:    http.DefaultTransport,
+		timeout: time.Second,
+	}
+	request, err := http.NewRequestWithContext(t.Context(), http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+
+	response, err := transport.RoundTrip(request)
+	require.NoError(t, err)
+	body, err := io.ReadAll(response.Body)
+	require.NoError(t, err)
+	require.NoError(t, response.Body.Close())
+	assert.Equal(t, "response body", string(body))
+}
+
+func TestDialContextWithTimeout_Timeout(t *testing.T) {
+	t.Parallel()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+	dial := dialContextWithTimeout(&net.Dialer{}, time.Nanosecond)
+
+	_, err = dial(t.Context(), "tcp", listener.Addr().String())
+	var timeoutErr *TimeoutError
+	require.ErrorAs(t, err, &timeoutErr)
+	assert.Equal(t, TimeoutStageConnect, timeoutErr.Stage)
+}
+
+func TestDialContextWithTimeout_CanceledByCaller(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	dial := dialContextWithTimeout(&net.Dialer{}, time.Second)
+
+	_, err := dial(ctx, "tcp", "127.0.0.1:1")
+	require.Error(t, err)
+	var timeoutErr *TimeoutError
+	assert.False(t, errors.As(err, &timeoutErr))
+}
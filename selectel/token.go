@@ -0,0 +1,161 @@
+package selectel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/identity/v3/tokens"
+)
+
+// tokenExpiryMargin is a time before token expiry when a new token is issued,
+// so long requests don't fail in the middle.
+const tokenExpiryMargin = 5 * time.Minute
+
+var errUnexpectedAuthResult = errors.New("unexpected type of keystone auth result")
+
+// TokenSource provides Keystone token for requests to Domains API.
+type TokenSource interface {
+	// Token returns valid token, a new token is issued if the current one
+	// is close to expiry or invalidated.
+	Token(ctx context.Context) (string, error)
+	// Invalidate marks token as rejected by API, so next call of Token issues a new one.
+	Invalidate(token string)
+}
+
+// keystoneTokenSource issues project scoped tokens of service user.
+type keystoneTokenSource struct {
+	config     *Config
+	httpClient *http.Client
+	now        func() time.Time
+
+	mu        sync.Mutex
+	provider  *gophercloud.ProviderClient
+	token     string
+	expiresAt time.Time
+}
+
+func newKeystoneTokenSource(config *Config, httpClient *http.Client) *keystoneTokenSource {
+	return &keystoneTokenSource{
+		config:     config,
+		httpClient: httpClient,
+		now:        time.Now,
+	}
+}
+
+func (s *keystoneTokenSource) Token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.valid() {
+		return s.token, nil
+	}
+	provider, err := authenticate(ctx, s.config, s.httpClient)
+	if err != nil {
+		return "", err
+	}
+	expiresAt, err := tokenExpiresAt(provider)
+	if err != nil {
+		return "", err
+	}
+	s.provider = provider
+	s.token = provider.Token()
+	s.expiresAt = expiresAt
+
+	return s.token, nil
+}
+
+func (s *keystoneTokenSource) Invalidate(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token == token {
+		s.token = ""
+	}
+}
+
+// discoverBaseURL finds Domains API endpoint in service catalog of the current token.
+func (s *keystoneTokenSource) discoverBaseURL(ctx context.Context) (string, error) {
+	if _, err := s.Token(ctx); err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return discoverBaseURL(s.provider, s.config.Region)
+}
+
+func (s *keystoneTokenSource) valid() bool {
+	if s.token == "" {
+		return false
+	}
+	// expiry is unknown, token is refreshed only after rejection
+	if s.expiresAt.IsZero() {
+		return true
+	}
+
+	return s.now().Add(tokenExpiryMargin).Before(s.expiresAt)
+}
+
+func tokenExpiresAt(provider *gophercloud.ProviderClient) (time.Time, error) {
+	result, ok := provider.GetAuthResult().(tokens.CreateResult)
+	if !ok {
+		return time.Time{}, errUnexpectedAuthResult
+	}
+	token, err := result.ExtractToken()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("extract keystone token: %w", err)
+	}
+
+	return token.ExpiresAt, nil
+}
+
+// tokenTransport sets token from source to every request and repeats request
+// once with a new token if API responds with 401.
+type tokenTransport struct {
+	next   http.RoundTripper
+	source TokenSource
+}
+
+func (t *tokenTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	token, err := t.source.Token(request.Context())
+	if err != nil {
+		return nil, fmt.Errorf("get token: %w", err)
+	}
+	response, err := t.next.RoundTrip(withToken(request, token))
+	if err != nil || response.StatusCode != http.StatusUnauthorized {
+		return response, err //nolint: wrapcheck
+	}
+	// body of request is already consumed and can't be sent again
+	if request.Body != nil && request.GetBody == nil {
+		return response, nil
+	}
+	_, _ = io.Copy(io.Discard, response.Body)
+	response.Body.Close()
+
+	t.source.Invalidate(token)
+	token, err = t.source.Token(request.Context())
+	if err != nil {
+		return nil, fmt.Errorf("refresh token: %w", err)
+	}
+	retry := withToken(request, token)
+	if request.GetBody != nil {
+		retry.Body, err = request.GetBody()
+		if err != nil {
+			return nil, fmt.Errorf("get request body for retry: %w", err)
+		}
+	}
+
+	return t.next.RoundTrip(retry) //nolint: wrapcheck
+}
+
+// withToken clones request, RoundTripper must not modify the original one.
+func withToken(request *http.Request, token string) *http.Request {
+	clone := request.Clone(request.Context())
+	clone.Header.Set(headerForOSProjectToken, token)
+
+	return clone
+}
@@ -0,0 +1,138 @@
+package selectel
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/selectel/cert-manager-webhook-selectel/internal/fakeselectel"
+	domainsV2 "github.com/selectel/domains-go/pkg/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenTransport_ReauthenticatesOnExpiredToken(t *testing.T) {
+	t.Parallel()
+	server := fakeselectel.NewServer()
+	t.Cleanup(server.Close)
+	server.AddZone("example.com.")
+	dnsClient, err := getDNSClientFromConfig(newFakeServerConfig(t, server))
+	require.NoError(t, err)
+
+	_, err = dnsClient.ListZones(t.Context(), &map[string]string{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, server.AuthRequests())
+
+	server.ExpireTokens()
+	zones, err := dnsClient.ListZones(t.Context(), &map[string]string{})
+	require.NoError(t, err)
+	assert.Len(t, zones.GetItems(), 1)
+	assert.Equal(t, 2, server.AuthRequests())
+	// rejected request and its retry
+	assert.Equal(t, 3, server.APIRequests())
+}
+
+func TestTokenTransport_RetriesRequestWithBody(t *testing.T) {
+	t.Parallel()
+	server := fakeselectel.NewServer()
+	t.Cleanup(server.Close)
+	zoneID := server.AddZone("example.com.")
+	dnsClient, err := getDNSClientFromConfig(newFakeServerConfig(t, server))
+	require.NoError(t, err)
+
+	server.ExpireTokens()
+	_, err = dnsClient.CreateRRSet(t.Context(), zoneID, &domainsV2.RRSet{
+		Name:    "_acme-challenge.example.com.",
+		Type:    domainsV2.TXT,
+		TTL:     minTTL,
+		Records: []domainsV2.RecordItem{{Content: `"value"`}},
+	})
+	require.NoError(t, err)
+
+	rrsets := server.RRSets(zoneID)
+	require.Len(t, rrsets, 1)
+	assert.Equal(t, []domainsV2.RecordItem{{Content: `"value"`}}, rrsets[0].Records)
+	assert.Equal(t, 2, server.AuthRequests())
+}
+
+func TestTokenTransport_RetriesOnlyOnce(t *testing.T) {
+	t.Parallel()
+	keystone := fakeselectel.NewServer()
+	t.Cleanup(keystone.Close)
+	requests := &atomic.Int32{}
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	t.Cleanup(api.Close)
+	config := newFakeServerConfig(t, keystone)
+	config.BaseURL = api.URL
+	dnsClient, err := getDNSClientFromConfig(config)
+	require.NoError(t, err)
+
+	_, err = dnsClient.ListZones(t.Context(), &map[string]string{})
+	require.Error(t, err)
+	assert.Equal(t, int32(2), requests.Load())
+	assert.Equal(t, 2, keystone.AuthRequests())
+}
+
+func TestKeystoneTokenSource_RefreshesNearExpiry(t *testing.T) {
+	t.Parallel()
+	server := fakeselectel.NewServer()
+	t.Cleanup(server.Close)
+	server.TokenTTL = time.Hour
+	source := newKeystoneTokenSource(newFakeServerConfig(t, server), http.DefaultClient)
+	now := time.Now()
+	source.now = func() time.Time { return now }
+
+	first, err := source.Token(t.Context())
+	require.NoError(t, err)
+	now = now.Add(30 * time.Minute)
+	second, err := source.Token(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, first, second)
+	assert.Equal(t, 1, server.AuthRequests())
+
+	now = now.Add(time.Hour - tokenExpiryMargin)
+	third, err := source.Token(t.Context())
+	require.NoError(t, err)
+	assert.NotEqual(t, first, third)
+	assert.Equal(t, 2, server.AuthRequests())
+}
+
+func TestKeystoneTokenSource_Invalidate(t *testing.T) {
+	t.Parallel()
+	server := fakeselectel.NewServer()
+	t.Cleanup(server.Close)
+	source := newKeystoneTokenSource(newFakeServerConfig(t, server), http.DefaultClient)
+
+	first, err := source.Token(t.Context())
+	require.NoError(t, err)
+	source.Invalidate("another-token")
+	second, err := source.Token(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, first, second)
+
+	source.Invalidate(first)
+	third, err := source.Token(t.Context())
+	require.NoError(t, err)
+	assert.NotEqual(t, first, third)
+	assert.Equal(t, 2, server.AuthRequests())
+}
+
+func TestDNSProvider_PresentAfterTokenExpiry(t *testing.T) {
+	t.Parallel()
+	server := fakeselectel.NewServer()
+	t.Cleanup(server.Close)
+	zoneID := server.AddZone("example.com.")
+	provider, err := NewDNSProviderFromConfig(newFakeServerConfig(t, server))
+	require.NoError(t, err)
+
+	server.ExpireTokens()
+	require.NoError(t, provider.Present("example.com.", "_acme-challenge.example.com.", "value"))
+	server.ExpireTokens()
+	require.NoError(t, provider.CleanUp("example.com.", "_acme-challenge.example.com.", "value"))
+	assert.Empty(t, server.RRSets(zoneID))
+}
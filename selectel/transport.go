@@ -0,0 +1,244 @@
+package selectel
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	dialKeepAlive = 30 * time.Second
+
+	maxIdleConns        = 100
+	maxIdleConnsPerHost = 20
+	idleConnTimeout     = 90 * time.Second
+
+	// maxCachedTransports bounds transports of configs, e.g. left by rotated
+	// proxy credentials or client certificates, the least recently used is evicted.
+	maxCachedTransports = 32
+)
+
+var (
+	errNoCertificatesInCABundle   = errors.New("no certificates found in ca bundle")
+	errUnexpectedDefaultTransport = errors.New("unexpected type of default transport")
+
+	// transports are shared between providers, so connections to Keystone
+	// and Domains API are reused by all challenges.
+	transports = newTransportCache(maxCachedTransports)
+)
+
+// ProxyCredentials are used for basic authentication on outbound proxy.
+type ProxyCredentials struct {
+	Username []byte `json:"username"`
+	Password []byte `json:"password"`
+}
+
+func (credentials *ProxyCredentials) FromMapBytes(dataFromSecret map[string][]byte) error {
+	b, err := json.Marshal(dataFromSecret)
+	if err != nil {
+		return fmt.Errorf("marshal secret data: %w", err)
+	}
+	err = json.Unmarshal(b, credentials)
+	if err != nil {
+		return fmt.Errorf("parse proxy credentials: %w", err)
+	}
+
+	return nil
+}
+
+// ClientCertificate is a PEM encoded certificate and key for mTLS,
+// keys are the same as in kubernetes.io/tls secret.
+type ClientCertificate struct {
+	Certificate []byte `json:"tls.crt"`
+	Key         []byte `json:"tls.key"`
+}
+
+func (certificate *ClientCertificate) FromMapBytes(dataFromSecret map[string][]byte) error {
+	b, err := json.Marshal(dataFromSecret)
+	if err != nil {
+		return fmt.Errorf("marshal secret data: %w", err)
+	}
+	err = json.Unmarshal(b, certificate)
+	if err != nil {
+		return fmt.Errorf("parse client certificate: %w", err)
+	}
+
+	return nil
+}
+
+// newHTTPTransport returns transport for Keystone and Domains API clients
+// with proxy, extra CA bundle and client certificate from config.
+// If proxy url is not set, proxy is taken from HTTPS_PROXY and NO_PROXY env.
+func newHTTPTransport(config *Config) (*http.Transport, error) {
+	transport, ok := http.DefaultTransport.(*http.Transport)
+	if !ok {
+		return nil, errUnexpectedDefaultTransport
+	}
+	transport = transport.Clone()
+	connectTimeout := time.Duration(config.ConnectTimeout) * time.Second
+	transport.DialContext = dialContextWithTimeout(&net.Dialer{KeepAlive: dialKeepAlive}, connectTimeout)
+	transport.TLSHandshakeTimeout = connectTimeout
+	transport.ForceAttemptHTTP2 = true
+	transport.MaxIdleConns = maxIdleConns
+	transport.MaxIdleConnsPerHost = maxIdleConnsPerHost
+	transport.IdleConnTimeout = idleConnTimeout
+
+	proxy, err := proxyFromConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	transport.Proxy = proxy
+
+	tlsConfig, err := tlsConfigFromConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	return transport, nil
+}
+
+func proxyFromConfig(config *Config) (func(*http.Request) (*url.URL, error), error) {
+	if config.ProxyURL == "" {
+		return http.ProxyFromEnvironment, nil
+	}
+	proxyURL, err := url.Parse(config.ProxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("parse proxy url: %w", err)
+	}
+	if len(config.ProxyCredentials.Username) > 0 {
+		proxyURL.User = url.UserPassword(
+			string(config.ProxyCredentials.Username),
+			string(config.ProxyCredentials.Password),
+		)
+	}
+
+	return http.ProxyURL(proxyURL), nil
+}
+
+func tlsConfigFromConfig(config *Config) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if len(config.CABundle) > 0 {
+		rootCAs, err := x509.SystemCertPool()
+		if err != nil {
+			rootCAs = x509.NewCertPool()
+		}
+		if !rootCAs.AppendCertsFromPEM(config.CABundle) {
+			return nil, errNoCertificatesInCABundle
+		}
+		tlsConfig.RootCAs = rootCAs
+	}
+
+	if len(config.ClientCertificate.Certificate) > 0 || len(config.ClientCertificate.Key) > 0 {
+		certificate, err := tls.X509KeyPair(config.ClientCertificate.Certificate, config.ClientCertificate.Key)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	return tlsConfig, nil
+}
+
+// transportCache keeps a transport per distinct proxy, TLS and connect
+// timeout settings of configs, up to size least recently used ones.
+type transportCache struct {
+	mu         sync.Mutex
+	size       int
+	transports map[[sha256.Size]byte]*cachedTransport
+	// used counts gets, it orders transports by last use.
+	used uint64
+}
+
+type cachedTransport struct {
+	transport *http.Transport
+	lastUsed  uint64
+}
+
+func newTransportCache(size int) *transportCache {
+	return &transportCache{size: size, transports: map[[sha256.Size]byte]*cachedTransport{}}
+}
+
+// get returns transport shared by configs with the same transport settings.
+// Idle connections of evicted transport are closed, requests in flight
+// and providers holding it are not affected.
+func (c *transportCache) get(config *Config) (*http.Transport, error) {
+	key := transportKey(config)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.used++
+	if cached, ok := c.transports[key]; ok {
+		cached.lastUsed = c.used
+
+		return cached.transport, nil
+	}
+	transport, err := newHTTPTransport(config)
+	if err != nil {
+		return nil, err
+	}
+	if len(c.transports) >= c.size {
+		c.evict()
+	}
+	c.transports[key] = &cachedTransport{transport: transport, lastUsed: c.used}
+
+	return transport, nil
+}
+
+// evict removes the least recently used transport.
+func (c *transportCache) evict() {
+	var (
+		oldestKey [sha256.Size]byte
+		oldest    *cachedTransport
+	)
+	for key, cached := range c.transports {
+		if oldest == nil || cached.lastUsed < oldest.lastUsed {
+			oldestKey, oldest = key, cached
+		}
+	}
+	if oldest != nil {
+		oldest.transport.CloseIdleConnections()
+		delete(c.transports, oldestKey)
+	}
+}
+
+// reset closes idle connections and forgets transports.
+func (c *transportCache) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, cached := range c.transports {
+		cached.transport.CloseIdleConnections()
+		delete(c.transports, key)
+	}
+}
+
+// transportKey is a hash of settings of transport, it keeps secrets
+// of proxy and client certificate out of memory of the cache.
+func transportKey(config *Config) [sha256.Size]byte {
+	hash := sha256.New()
+	for _, field := range [][]byte{
+		[]byte(fmt.Sprint(config.ConnectTimeout)),
+		[]byte(config.ProxyURL),
+		config.ProxyCredentials.Username,
+		config.ProxyCredentials.Password,
+		config.CABundle,
+		config.ClientCertificate.Certificate,
+		config.ClientCertificate.Key,
+	} {
+		// length prefix keeps boundaries of fields
+		_, _ = fmt.Fprintf(hash, "%d:", len(field))
+		_, _ = hash.Write(field)
+	}
+
+	return [sha256.Size]byte(hash.Sum(nil))
+}
@@ -0,0 +1,397 @@
+package selectel
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/selectel/cert-manager-webhook-selectel/internal/fakeselectel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testProxyUsername = "proxy-user"
+	testProxyPassword = "proxy-password"
+)
+
+// newTestConnectProxy starts http proxy supporting CONNECT method
+// with basic authentication and counts tunnels.
+func newTestConnectProxy(t *testing.T) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	tunnels := &atomic.Int32{}
+	expectedAuth := "Basic " + base64.StdEncoding.EncodeToString([]byte(testProxyUsername+":"+testProxyPassword))
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+
+			return
+		}
+		if r.Header.Get("Proxy-Authorization") != expectedAuth {
+			w.WriteHeader(http.StatusProxyAuthRequired)
+
+			return
+		}
+		upstream, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+
+			return
+		}
+		hijacker, ok := w.(http.Hijacker)
+		if !ok {
+			w.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		conn, _, err := hijacker.Hijack()
+		if err != nil {
+			return
+		}
+		tunnels.Add(1)
+		go func() {
+			defer conn.Close()
+			defer upstream.Close()
+			go func() { _, _ = io.Copy(upstream, conn) }()
+			_, _ = io.Copy(conn, upstream)
+		}()
+	}))
+	t.Cleanup(proxy.Close)
+
+	return proxy, tunnels
+}
+
+type testCertificate struct {
+	certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+	certPEM     []byte
+	keyPEM      []byte
+}
+
+// newTestCertificate issues certificate signed by parent or self signed CA if parent is nil.
+func newTestCertificate(t *testing.T, parent *testCertificate) *testCertificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "cert-manager-webhook-selectel-test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+	} else {
+		signer, signerKey = parent.certificate, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	certificate, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	return &testCertificate{
+		certificate: certificate,
+		key:         key,
+		certPEM:     pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:      pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+func newTestTLSServer(t *testing.T, serverCert *testCertificate, clientCA *testCertificate, handler http.Handler) *httptest.Server {
+	t.Helper()
+	keyPair, err := tls.X509KeyPair(serverCert.certPEM, serverCert.keyPEM)
+	require.NoError(t, err)
+	server := httptest.NewUnstartedServer(handler)
+	server.TLS = &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{keyPair},
+	}
+	if clientCA != nil {
+		clientCAs := x509.NewCertPool()
+		clientCAs.AddCert(clientCA.certificate)
+		server.TLS.ClientAuth = tls.RequireAndVerifyClientCert
+		server.TLS.ClientCAs = clientCAs
+	}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func okHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+func doGet(t *testing.T, transport http.RoundTripper, url string) error {
+	t.Helper()
+	request, err := http.NewRequestWithContext(t.Context(), http.MethodGet, url, nil)
+	require.NoError(t, err)
+	response, err := (&http.Client{Transport: transport}).Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+
+	return nil
+}
+
+func TestNewHTTPTransport_ProxyAndCABundle(t *testing.T) {
+	t.Parallel()
+	ca := newTestCertificate(t, nil)
+	server := newTestTLSServer(t, newTestCertificate(t, ca), nil, okHandler())
+	proxy, tunnels := newTestConnectProxy(t)
+
+	config, err := NewConfigForDNS()
+	require.NoError(t, err)
+	config.ProxyURL = proxy.URL
+	config.ProxyCredentials = ProxyCredentials{
+		Username: []byte(testProxyUsername),
+		Password: []byte(testProxyPassword),
+	}
+	config.CABundle = ca.certPEM
+
+	transport, err := newHTTPTransport(config)
+	require.NoError(t, err)
+	require.NoError(t, doGet(t, transport, server.URL))
+	assert.Equal(t, int32(1), tunnels.Load())
+}
+
+func TestNewHTTPTransport_ProxyWithoutCredentials(t *testing.T) {
+	t.Parallel()
+	ca := newTestCertificate(t, nil)
+	server := newTestTLSServer(t, newTestCertificate(t, ca), nil, okHandler())
+	proxy, tunnels := newTestConnectProxy(t)
+
+	config, err := NewConfigForDNS()
+	require.NoError(t, err)
+	config.ProxyURL = proxy.URL
+	config.CABundle = ca.certPEM
+
+	transport, err := newHTTPTransport(config)
+	require.NoError(t, err)
+	require.Error(t, doGet(t, transport, server.URL))
+	assert.Equal(t, int32(0), tunnels.Load())
+}
+
+func TestNewHTTPTransport_UnknownCA(t *testing.T) {
+	t.Parallel()
+	ca := newTestCertificate(t, nil)
+	server := newTestTLSServer(t, newTestCertificate(t, ca), nil, okHandler())
+
+	config, err := NewConfigForDNS()
+	require.NoError(t, err)
+
+	transport, err := newHTTPTransport(config)
+	require.NoError(t, err)
+	err = doGet(t, transport, server.URL)
+	var unknownAuthorityErr x509.UnknownAuthorityError
+	assert.ErrorAs(t, err, &unknownAuthorityErr)
+}
+
+func TestNewHTTPTransport_InvalidCABundle(t *testing.T) {
+	t.Parallel()
+	config, err := NewConfigForDNS()
+	require.NoError(t, err)
+	config.CABundle = []byte("not a certificate")
+
+	_, err = newHTTPTransport(config)
+	assert.ErrorIs(t, err, errNoCertificatesInCABundle)
+}
+
+func TestNewHTTPTransport_ClientCertificate(t *testing.T) {
+	t.Parallel()
+	ca := newTestCertificate(t, nil)
+	server := newTestTLSServer(t, newTestCertificate(t, ca), ca, okHandler())
+	clientCert := newTestCertificate(t, ca)
+
+	config, err := NewConfigForDNS()
+	require.NoError(t, err)
+	config.CABundle = ca.certPEM
+
+	transport, err := newHTTPTransport(config)
+	require.NoError(t, err)
+	require.Error(t, doGet(t, transport, server.URL), "server must require client certificate")
+
+	config.ClientCertificate = ClientCertificate{
+		Certificate: clientCert.certPEM,
+		Key:         clientCert.keyPEM,
+	}
+	transport, err = newHTTPTransport(config)
+	require.NoError(t, err)
+	require.NoError(t, doGet(t, transport, server.URL))
+}
+
+func TestAuthenticate_ThroughProxyWithCABundle(t *testing.T) {
+	t.Parallel()
+	ca := newTestCertificate(t, nil)
+	keystone := newTestTLSServer(t, newTestCertificate(t, ca), nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/identity/v3/auth/tokens" {
+			w.WriteHeader(http.StatusNotFound)
+
+			return
+		}
+		w.Header().Set("X-Subject-Token", "test-token")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = io.WriteString(w, `{"token": {"expires_at": "2100-01-01T00:00:00Z", "catalog": []}}`)
+	}))
+	proxy, tunnels := newTestConnectProxy(t)
+
+	config, err := NewConfigForDNS()
+	require.NoError(t, err)
+	config.AuthURL = keystone.URL + "/identity/v3/"
+	config.CredentialsForDNS = CredentialsForDNS{
+		Username:  []byte("user"),
+		Password:  []byte("password"),
+		AccountID: []byte("123456"),
+		ProjectID: []byte("project-id"),
+	}
+	config.ProxyURL = proxy.URL
+	config.ProxyCredentials = ProxyCredentials{
+		Username: []byte(testProxyUsername),
+		Password: []byte(testProxyPassword),
+	}
+	config.CABundle = ca.certPEM
+	transport, err := newHTTPTransport(config)
+	require.NoError(t, err)
+
+	provider, err := authenticate(t.Context(), config, &http.Client{Transport: transport})
+	require.NoError(t, err)
+	assert.Equal(t, "test-token", provider.Token())
+	assert.Equal(t, int32(1), tunnels.Load())
+}
+
+func TestTransportCache(t *testing.T) {
+	t.Parallel()
+	cache := newTransportCache(maxCachedTransports)
+	config := &Config{ConnectTimeout: defaultConnectTimeout}
+	transport, err := cache.get(config)
+	require.NoError(t, err)
+	assert.Equal(t, maxIdleConnsPerHost, transport.MaxIdleConnsPerHost)
+	assert.True(t, transport.ForceAttemptHTTP2)
+
+	same, err := cache.get(&Config{ConnectTimeout: defaultConnectTimeout})
+	require.NoError(t, err)
+	assert.Same(t, transport, same)
+
+	serverCert := newTestCertificate(t, nil)
+	other, err := cache.get(&Config{ConnectTimeout: defaultConnectTimeout, CABundle: serverCert.certPEM})
+	require.NoError(t, err)
+	assert.NotSame(t, transport, other)
+	other, err = cache.get(&Config{ConnectTimeout: defaultConnectTimeout, ProxyURL: "http://proxy.example.com:3128"})
+	require.NoError(t, err)
+	assert.NotSame(t, transport, other)
+
+	cache.reset()
+	fresh, err := cache.get(config)
+	require.NoError(t, err)
+	assert.NotSame(t, transport, fresh)
+}
+
+func TestTransportCache_Evict(t *testing.T) {
+	t.Parallel()
+	var closed atomic.Int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateClosed {
+			closed.Add(1)
+		}
+	}
+	server.Start()
+	t.Cleanup(server.Close)
+
+	cache := newTransportCache(2)
+	rotated := func(password string) *Config {
+		return &Config{
+			ConnectTimeout:   defaultConnectTimeout,
+			ProxyURL:         "http://proxy.example.com:3128",
+			ProxyCredentials: ProxyCredentials{Username: []byte("proxy"), Password: []byte(password)},
+		}
+	}
+	first, err := cache.get(&Config{ConnectTimeout: defaultConnectTimeout})
+	require.NoError(t, err)
+	// idle connection of the first transport is closed on eviction
+	response, err := (&http.Client{Transport: first}).Get(server.URL)
+	require.NoError(t, err)
+	require.NoError(t, response.Body.Close())
+	_, err = cache.get(rotated("first"))
+	require.NoError(t, err)
+	_, err = cache.get(rotated("second"))
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return closed.Load() == 1 }, 5*time.Second, 10*time.Millisecond)
+	assert.Len(t, cache.transports, 2)
+
+	// recently used transport is kept
+	second, err := cache.get(rotated("second"))
+	require.NoError(t, err)
+	_, err = cache.get(rotated("third"))
+	require.NoError(t, err)
+	same, err := cache.get(rotated("second"))
+	require.NoError(t, err)
+	assert.Same(t, second, same)
+	fresh, err := cache.get(&Config{ConnectTimeout: defaultConnectTimeout})
+	require.NoError(t, err)
+	assert.NotSame(t, first, fresh)
+}
+
+// BenchmarkDNSProvider_PresentAndCleanUp compares challenges sharing transport
+// with challenges creating a new one, like every challenge did before.
+func BenchmarkDNSProvider_PresentAndCleanUp(b *testing.B) {
+	server := fakeselectel.NewTLSServer()
+	b.Cleanup(server.Close)
+	server.AddZone("example.com.")
+	config, err := NewConfigForDNS()
+	require.NoError(b, err)
+	config.BaseURL = server.BaseURL()
+	config.AuthURL = server.AuthURL()
+	config.CABundle = server.CABundle()
+	config.CredentialsForDNS = CredentialsForDNS{
+		Username:  []byte("user"),
+		Password:  []byte("password"),
+		AccountID: []byte("123456"),
+		ProjectID: []byte("project-id"),
+	}
+
+	for _, shared := range []bool{true, false} {
+		name := "fresh transport"
+		if shared {
+			name = "shared transport"
+		}
+		b.Run(name, func(b *testing.B) {
+			transports.reset()
+			for range b.N {
+				if !shared {
+					transports.reset()
+				}
+				provider, err := NewDNSProviderFromConfig(config)
+				require.NoError(b, err)
+				require.NoError(b, provider.Present("example.com.", "_acme-challenge.example.com.", "value"))
+				require.NoError(b, provider.CleanUp("example.com.", "_acme-challenge.example.com.", "value"))
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"errors"
+	"path"
+	"strings"
+)
+
+const challengeLabel = "_acme-challenge."
+
+var errEmptyDomainPattern = errors.New("empty domain pattern")
+
+// ChallengeDomain returns domain of challenge record fqdn without _acme-challenge label.
+func ChallengeDomain(fqdn string) string {
+	return strings.TrimPrefix(normalizeDomain(fqdn), challengeLabel)
+}
+
+// MatchDomain reports whether domain matches pattern. Leading "*." matches
+// one or more labels, so "*.example.com" matches any subdomain of example.com,
+// but not example.com itself. Other "*" match characters within a single label,
+// e.g. "api-*.example.com". Case and trailing dot are ignored.
+func MatchDomain(pattern, domain string) bool {
+	pattern = normalizeDomain(pattern)
+	domain = normalizeDomain(domain)
+	if pattern == "*" {
+		return true
+	}
+	patternLabels := strings.Split(pattern, ".")
+	domainLabels := strings.Split(domain, ".")
+	anyDepth := len(patternLabels) > 1 && patternLabels[0] == "*"
+	if anyDepth {
+		patternLabels = patternLabels[1:]
+		if len(domainLabels) <= len(patternLabels) {
+			return false
+		}
+		domainLabels = domainLabels[len(domainLabels)-len(patternLabels):]
+	}
+	if len(patternLabels) != len(domainLabels) {
+		return false
+	}
+	for i := range patternLabels {
+		matched, err := path.Match(patternLabels[i], domainLabels[i])
+		if err != nil || !matched {
+			return false
+		}
+	}
+
+	return true
+}
+
+// MatchAnyDomain reports whether domain matches any of patterns.
+func MatchAnyDomain(patterns []string, domain string) bool {
+	for _, pattern := range patterns {
+		if MatchDomain(pattern, domain) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// MatchAnyChallengeDomain reports whether challenge for domain matches any of patterns.
+// Challenge of wildcard certificate has the same record as challenge of its base
+// domain and its DNS name may come without "*.", so the challenge matches
+// if the domain or its wildcard does.
+func MatchAnyChallengeDomain(patterns []string, domain string) bool {
+	domain = strings.TrimPrefix(normalizeDomain(domain), "*.")
+
+	return MatchAnyDomain(patterns, domain) || MatchAnyDomain(patterns, "*."+domain)
+}
+
+// ValidateDomainPattern checks that pattern can be matched.
+func ValidateDomainPattern(pattern string) error {
+	if normalizeDomain(pattern) == "" {
+		return errEmptyDomainPattern
+	}
+	for _, label := range strings.Split(normalizeDomain(pattern), ".") {
+		if _, err := path.Match(label, ""); err != nil {
+			return err //nolint: wrapcheck
+		}
+	}
+
+	return nil
+}
+
+func normalizeDomain(domain string) string {
+	return strings.ToLower(strings.TrimSuffix(domain, "."))
+}
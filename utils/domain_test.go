@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchDomain(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		pattern string
+		domain  string
+		matched bool
+	}{
+		{"example.com", "example.com", true},
+		{"example.com", "Example.COM.", true},
+		{"example.com.", "example.com", true},
+		{"example.com", "www.example.com", false},
+		{"*.example.com", "www.example.com", true},
+		{"*.example.com", "a.b.example.com", true},
+		{"*.example.com", "example.com", false},
+		{"*.example.com", "notexample.com", false},
+		{"api-*.example.com", "api-dev.example.com", true},
+		{"api-*.example.com", "web.example.com", false},
+		{"api-*.example.com", "x.api-dev.example.com", false},
+		{"www.*.com", "www.example.com", true},
+		{"*", "anything.example.com", true},
+	}
+	for _, testCase := range testCases {
+		assert.Equal(t, testCase.matched, MatchDomain(testCase.pattern, testCase.domain),
+			"%s ~ %s", testCase.pattern, testCase.domain)
+	}
+}
+
+func TestChallengeDomain(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, "example.com", ChallengeDomain("_acme-challenge.example.com."))
+	assert.Equal(t, "www.example.com", ChallengeDomain("_ACME-Challenge.www.example.com"))
+	assert.Equal(t, "example.com", ChallengeDomain("example.com."))
+}
+
+func TestMatchAnyChallengeDomain(t *testing.T) {
+	t.Parallel()
+	patterns := []string{"*.dev.example.com"}
+	assert.True(t, MatchAnyChallengeDomain(patterns, "api.dev.example.com"))
+	// challenge of *.dev.example.com certificate
+	assert.True(t, MatchAnyChallengeDomain(patterns, "dev.example.com"))
+	assert.True(t, MatchAnyChallengeDomain(patterns, "*.dev.example.com"))
+	assert.False(t, MatchAnyChallengeDomain(patterns, "example.com"))
+}
+
+func TestValidateDomainPattern(t *testing.T) {
+	t.Parallel()
+	assert.NoError(t, ValidateDomainPattern("*.example.com"))
+	assert.ErrorIs(t, ValidateDomainPattern(""), errEmptyDomainPattern)
+	assert.Error(t, ValidateDomainPattern("[.example.com"))
+}
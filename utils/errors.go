@@ -16,8 +16,21 @@ func BuildErrFromValidator(validationErrors validator.ValidationErrors) error {
 	preparedErrors := []string{}
 	for _, fieldErr := range validationErrors {
 		preparedError := fieldErr.Error()
-		if fieldErr.Tag() == "required" || fieldErr.Tag() == "gt" {
+		switch fieldErr.Tag() {
+		case "required", "gt":
 			preparedError = fmt.Sprintf("setup %s field", fieldErr.Field())
+		case "gte":
+			preparedError = fmt.Sprintf("%s must be greater or equals %s", fieldErr.Field(), fieldErr.Param())
+		case "lte":
+			preparedError = fmt.Sprintf("%s must be less or equals %s", fieldErr.Field(), fieldErr.Param())
+		case "url", "http_url":
+			preparedError = fmt.Sprintf("%s must be valid url", fieldErr.Field())
+		case "https":
+			preparedError = fmt.Sprintf("%s must use https scheme", fieldErr.Field())
+		case "oneof":
+			preparedError = fmt.Sprintf("%s must be one of: %s", fieldErr.Field(), fieldErr.Param())
+		case "domain_pattern":
+			preparedError = fmt.Sprintf("%s must be valid domain pattern", fieldErr.Field())
 		}
 		preparedErrors = append(preparedErrors, preparedError)
 	}